@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ActionsSettings is an organization's GitHub Actions policy.
+type ActionsSettings struct {
+	// EnabledRepositories is which repositories may run Actions:
+	// "all", "none", or "selected".
+	EnabledRepositories string `json:"enabled_repositories"`
+	// AllowedActions is which actions and reusable workflows may be
+	// used: "all", "local_only", or "selected".
+	AllowedActions string `json:"allowed_actions"`
+	// SelectedActions is only filled in if AllowedActions is
+	// "selected".
+	SelectedActions *struct {
+		GithubOwnedAllowed bool     `json:"github_owned_allowed"`
+		VerifiedAllowed    bool     `json:"verified_allowed"`
+		PatternsAllowed    []string `json:"patterns_allowed"`
+	}
+	// DefaultWorkflowPermissions is the access that a workflow's
+	// GITHUB_TOKEN gets unless the workflow says otherwise: "read"
+	// or "write".
+	DefaultWorkflowPermissions   string `json:"default_workflow_permissions"`
+	CanApprovePullRequestReviews bool   `json:"can_approve_pull_request_reviews"`
+}
+
+// OrgSecret is an organization-level Actions secret.
+type OrgSecret struct {
+	Name string `json:"name"`
+	// Visibility is which repositories can use the secret: "all",
+	// "private", or "selected".
+	Visibility string    `json:"visibility"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Repos is only filled in if Visibility is "selected".
+	Repos []string `json:"-"`
+}
+
+func getActionsSettings(ctx context.Context, orgname string) (ActionsSettings, error) {
+	var settings ActionsSettings
+	if err := restGet(ctx, &settings, "/orgs/%s/actions/permissions", orgname); err != nil {
+		return settings, fmt.Errorf("getActionsSettings: %w", err)
+	}
+	if settings.AllowedActions == "selected" {
+		if err := restGet(ctx, &settings.SelectedActions, "/orgs/%s/actions/permissions/selected-actions", orgname); err != nil {
+			return settings, fmt.Errorf("getActionsSettings: %w", err)
+		}
+	}
+	if err := restGet(ctx, &settings, "/orgs/%s/actions/permissions/workflow", orgname); err != nil {
+		return settings, fmt.Errorf("getActionsSettings: %w", err)
+	}
+	return settings, nil
+}
+
+func getOrgSecrets(ctx context.Context, orgname string) ([]OrgSecret, error) {
+	var ret []OrgSecret
+	for page := 1; ; page++ {
+		if ctx.Err() != nil {
+			return ret, errInterrupted
+		}
+		var rawSecrets struct {
+			TotalCount int         `json:"total_count"`
+			Secrets    []OrgSecret `json:"secrets"`
+		}
+		if err := restGet(ctx, &rawSecrets, "/orgs/%s/actions/secrets?per_page=100&page=%d", orgname, page); err != nil {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			return nil, fmt.Errorf("getOrgSecrets: %w", err)
+		}
+		ret = append(ret, rawSecrets.Secrets...)
+		if len(rawSecrets.Secrets) == 0 || len(ret) >= rawSecrets.TotalCount {
+			break
+		}
+	}
+
+	for i := range ret {
+		if ret[i].Visibility != "selected" {
+			continue
+		}
+		for page := 1; ; page++ {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			var rawRepos struct {
+				TotalCount   int `json:"total_count"`
+				Repositories []struct {
+					Name string `json:"name"`
+				} `json:"repositories"`
+			}
+			if err := restGet(ctx, &rawRepos, "/orgs/%s/actions/secrets/%s/repositories?per_page=100&page=%d", orgname, ret[i].Name, page); err != nil {
+				if ctx.Err() != nil {
+					return ret, errInterrupted
+				}
+				return nil, fmt.Errorf("getOrgSecrets: %q: %w", ret[i].Name, err)
+			}
+			for _, repo := range rawRepos.Repositories {
+				ret[i].Repos = append(ret[i].Repos, repo.Name)
+			}
+			sort.Strings(ret[i].Repos)
+			if len(rawRepos.Repositories) == 0 || len(ret[i].Repos) >= rawRepos.TotalCount {
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+// EnvironmentSecret is a deployment environment secret, along with
+// every environment (in any of an organization's repositories) that has
+// a secret of that name.  Environment secrets can't be shared, so the
+// same secret in more than one repository means that it was copied to
+// each of them.
+type EnvironmentSecret struct {
+	Name string
+	// Environments are "REPO/ENVIRONMENT".
+	Environments []string
+	// Repos is the distinct repositories in Environments.
+	Repos int
+}
+
+// getEnvironmentSecrets returns the secrets of every deployment
+// environment in repos, grouped by name.
+func getEnvironmentSecrets(ctx context.Context, orgname string, repos []RepoHandle) ([]EnvironmentSecret, error) {
+	byName := make(map[string]map[string]bool)
+	for i, repo := range repos {
+		fmt.Fprintf(os.Stderr, "inspecting repo %d/%d %q\n", i, len(repos), repo.Name)
+		var envs []string
+		for page := 1; ; page++ {
+			if ctx.Err() != nil {
+				return nil, errInterrupted
+			}
+			var rawEnvs struct {
+				TotalCount   int `json:"total_count"`
+				Environments []struct {
+					Name string `json:"name"`
+				} `json:"environments"`
+			}
+			if err := restGet(ctx, &rawEnvs, "/repos/%s/%s/environments?per_page=100&page=%d", orgname, repo.Name, page); err != nil {
+				if ctx.Err() != nil {
+					return nil, errInterrupted
+				}
+				return nil, fmt.Errorf("getEnvironmentSecrets: %q: %w", repo.Name, err)
+			}
+			for _, env := range rawEnvs.Environments {
+				envs = append(envs, env.Name)
+			}
+			if len(rawEnvs.Environments) == 0 || len(envs) >= rawEnvs.TotalCount {
+				break
+			}
+		}
+		for _, env := range envs {
+			seen := 0
+			for page := 1; ; page++ {
+				if ctx.Err() != nil {
+					return nil, errInterrupted
+				}
+				var rawSecrets struct {
+					TotalCount int `json:"total_count"`
+					Secrets    []struct {
+						Name string `json:"name"`
+					} `json:"secrets"`
+				}
+				if err := restGet(ctx, &rawSecrets, "/repos/%s/%s/environments/%s/secrets?per_page=100&page=%d", orgname, repo.Name, env, page); err != nil {
+					if ctx.Err() != nil {
+						return nil, errInterrupted
+					}
+					return nil, fmt.Errorf("getEnvironmentSecrets: %q: %q: %w", repo.Name, env, err)
+				}
+				for _, secret := range rawSecrets.Secrets {
+					if byName[secret.Name] == nil {
+						byName[secret.Name] = make(map[string]bool)
+					}
+					byName[secret.Name][repo.Name+"/"+env] = true
+				}
+				seen += len(rawSecrets.Secrets)
+				if len(rawSecrets.Secrets) == 0 || seen >= rawSecrets.TotalCount {
+					break
+				}
+			}
+		}
+	}
+
+	ret := make([]EnvironmentSecret, 0, len(byName))
+	for name, envSet := range byName {
+		secret := EnvironmentSecret{Name: name}
+		repoSet := make(map[string]bool)
+		for env := range envSet {
+			secret.Environments = append(secret.Environments, env)
+			repoSet[strings.SplitN(env, "/", 2)[0]] = true
+		}
+		sort.Strings(secret.Environments)
+		secret.Repos = len(repoSet)
+		ret = append(ret, secret)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+var actionsCommand = &command{
+	Name:    "actions",
+	Args:    []string{"ORGNAME"},
+	Summary: "Audit organization-level Actions settings and secrets",
+	Description: `
+Shows the organization's GitHub Actions policy (which repositories may
+run Actions, which actions they may use, and what access a workflow's
+GITHUB_TOKEN gets by default), followed by every organization-level
+Actions secret and the repositories that can use it.
+
+This matters for reading the main report: anyone who can push a
+workflow to a repository can read every secret available to that
+repository, so a secret shared with all repositories is effectively
+readable by everyone with WRITE on any of them.  Secrets like that, a
+secret shared with more than --max-selected selected repositories,
+and a read-write default GITHUB_TOKEN, are called out on stderr.
+
+With --environments, it also lists the secrets of every deployment
+environment in every non-archived repository, grouped by name, with
+each repository and environment that has a secret of that name.  An
+environment secret can't be shared, so one that turns up in more than
+--max-selected repositories has been copied around, and is called out
+too.  This takes a couple of requests per repository.
+
+Dependabot and Codespaces secrets are not included.`,
+	Examples: []example{
+		{"Audit the Actions settings of the datawire organization.", progName + " actions datawire"},
+		{"Also audit environment secrets, and flag secrets in more than 5 repositories.", progName + " actions --environments --max-selected=5 datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		maxSelected := fs.Int("max-selected", 10, "warn about secrets available to more than `N` selected repositories")
+		withEnvironments := fs.Bool("environments", false, "also list the secrets of every repository's deployment environments")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			settings, err := getActionsSettings(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			secrets, err := getOrgSecrets(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+
+			allowed := settings.AllowedActions
+			if sel := settings.SelectedActions; sel != nil {
+				var parts []string
+				if sel.GithubOwnedAllowed {
+					parts = append(parts, "GitHub-owned")
+				}
+				if sel.VerifiedAllowed {
+					parts = append(parts, "verified creators")
+				}
+				parts = append(parts, sel.PatternsAllowed...)
+				allowed += ": " + strings.Join(parts, ", ")
+			}
+			output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(output, "Actions enabled in repositories:\t%s\n", settings.EnabledRepositories)
+			fmt.Fprintf(output, "Allowed actions:\t%s\n", allowed)
+			fmt.Fprintf(output, "Default GITHUB_TOKEN permission:\t%s\n", settings.DefaultWorkflowPermissions)
+			fmt.Fprintf(output, "Workflows can approve pull requests:\t%s\n", yesNo(settings.CanApprovePullRequestReviews))
+			output.Flush()
+
+			fmt.Fprintf(os.Stdout, "\n")
+			output = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(output, "Secret\t| Visibility\t| Updated\t| Repositories\n")
+			fmt.Fprintf(output, "------\t| ----------\t| -------\t| ------------\n")
+			for _, secret := range secrets {
+				var repos string
+				switch secret.Visibility {
+				case "all":
+					repos = "(every repository)"
+				case "private":
+					repos = "(every private repository)"
+				default:
+					repos = strings.Join(secret.Repos, " ")
+				}
+				fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\n", secret.Name, secret.Visibility, formatDate(secret.UpdatedAt), repos)
+			}
+			output.Flush()
+
+			if settings.DefaultWorkflowPermissions == "write" {
+				fmt.Fprintf(os.Stderr, "warning: workflows get a read-write GITHUB_TOKEN unless they ask for less\n")
+			}
+			for _, secret := range secrets {
+				switch secret.Visibility {
+				case "all":
+					fmt.Fprintf(os.Stderr, "warning: secret %s is readable by anyone with WRITE on any repository\n", secret.Name)
+				case "private":
+					fmt.Fprintf(os.Stderr, "warning: secret %s is readable by anyone with WRITE on any private repository\n", secret.Name)
+				case "selected":
+					if len(secret.Repos) > *maxSelected {
+						fmt.Fprintf(os.Stderr, "warning: secret %s is shared with %d selected repositories (more than --max-selected=%d)\n",
+							secret.Name, len(secret.Repos), *maxSelected)
+					}
+				}
+			}
+
+			if !*withEnvironments {
+				return nil
+			}
+			repos, _, err := getRepos(ctx, orgname, false)
+			if err != nil {
+				return err
+			}
+			sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+			envSecrets, err := getEnvironmentSecrets(ctx, orgname, repos)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "\n")
+			output = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(output, "Environment secret\t| Repositories\t| Environments\n")
+			fmt.Fprintf(output, "------------------\t| ------------\t| ------------\n")
+			for _, secret := range envSecrets {
+				fmt.Fprintf(output, "%s\t| %d\t| %s\n", secret.Name, secret.Repos, strings.Join(secret.Environments, " "))
+			}
+			output.Flush()
+			for _, secret := range envSecrets {
+				if secret.Repos > *maxSelected {
+					fmt.Fprintf(os.Stderr, "warning: environment secret %s is in %d repositories (more than --max-selected=%d); it may be one credential copied to all of them\n",
+						secret.Name, secret.Repos, *maxSelected)
+				}
+			}
+			return nil
+		}
+	},
+}
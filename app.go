@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// githubApp is set if --app-id is given, in which case every API
+// request is made with a token for an installation of that GitHub App
+// rather than with githubToken.
+var githubApp *appAuth
+
+// appAuth makes installation tokens for a GitHub App, for orgs whose
+// policy doesn't allow long-lived personal access tokens with
+// admin:org.  An installation token lasts an hour, so a long run gets
+// a new one whenever the one it has is about to expire.
+type appAuth struct {
+	id             string
+	key            *rsa.PrivateKey
+	installationID int64 // 0 until it is looked up
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// appTokenRefresh is how long before an installation token expires
+// that it gets replaced, so that a request doesn't start with a token
+// that expires before it is answered.
+const appTokenRefresh = 5 * time.Minute
+
+// newAppAuth returns the appAuth for the GitHub App with the given ID,
+// whose private key is the PEM file keyFile.  installationID may be 0
+// if the app has only one installation.
+func newAppAuth(id, keyFile string, installationID int64) (*appAuth, error) {
+	content, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("--app-private-key-file: %w", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("--app-private-key-file: %s: not a PEM file", keyFile)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if err8 != nil || !ok {
+			return nil, fmt.Errorf("--app-private-key-file: %s: not an RSA private key: %w", keyFile, err)
+		}
+		key = rsaKey
+	}
+	return &appAuth{id: id, key: key, installationID: installationID}, nil
+}
+
+// jwt returns a JSON Web Token that authenticates as the app itself,
+// which is only good for asking for installation tokens.  It is
+// backdated a minute to allow for clock drift, and expires a little
+// under the 10 minutes that GitHub allows.
+func (app *appAuth) jwt(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": app.id,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, app.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// request makes a REST API request as the app itself.  It doesn't go
+// through httpClient, so that installation tokens are never written
+// to a --record-bundle.
+func (app *appAuth) request(ctx context.Context, method, path string, out interface{}) error {
+	jwt, err := app.jwt(time.Now())
+	if err != nil {
+		return err
+	}
+	httpreq, err := http.NewRequestWithContext(ctx, method, restURL+path, nil)
+	if err != nil {
+		return err
+	}
+	httpreq.Header.Add("Authorization", "Bearer "+jwt)
+	httpreq.Header.Add("Accept", "application/vnd.github+json")
+	httpreq.Header.Add("X-GitHub-Api-Version", "2022-11-28")
+	client := &http.Client{Timeout: httpClient.Timeout}
+	httpresp, err := client.Do(httpreq)
+	if err != nil {
+		return err
+	}
+	defer httpresp.Body.Close()
+	respbody, err := ioutil.ReadAll(httpresp.Body)
+	if err != nil {
+		return err
+	}
+	switch httpresp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	default:
+		return fmt.Errorf("HTTP %s: %s", httpresp.Status, bytes.TrimSpace(respbody))
+	}
+	return json.Unmarshal(respbody, out)
+}
+
+// Token returns an installation token that is good for at least
+// appTokenRefresh, getting a new one if need be.
+func (app *appAuth) Token(ctx context.Context) (string, error) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if app.token != "" && time.Until(app.expires) > appTokenRefresh {
+		return app.token, nil
+	}
+	if app.installationID == 0 {
+		var installations []struct {
+			ID      int64 `json:"id"`
+			Account struct {
+				Login string `json:"login"`
+			} `json:"account"`
+		}
+		if err := app.request(ctx, http.MethodGet, "/app/installations?per_page=100", &installations); err != nil {
+			return "", fmt.Errorf("GitHub App %s: listing installations: %w", app.id, err)
+		}
+		if len(installations) != 1 {
+			var found []string
+			for _, installation := range installations {
+				found = append(found, fmt.Sprintf("%d (%s)", installation.ID, installation.Account.Login))
+			}
+			return "", fmt.Errorf("GitHub App %s has %d installations, so give --app-installation-id: %s", app.id, len(installations), strings.Join(found, ", "))
+		}
+		app.installationID = installations[0].ID
+	}
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := app.request(ctx, http.MethodPost, fmt.Sprintf("/app/installations/%d/access_tokens", app.installationID), &resp); err != nil {
+		return "", fmt.Errorf("GitHub App %s: installation %d: %w", app.id, app.installationID, err)
+	}
+	if flagDebug {
+		fmt.Fprintf(os.Stderr, "debug: new token for GitHub App %s installation %d, expiring %s\n", app.id, app.installationID, resp.ExpiresAt.Format(time.RFC3339))
+	}
+	app.token, app.expires = resp.Token, resp.ExpiresAt
+	return app.token, nil
+}
+
+// appInstallation is what the REST API says about an installation of
+// a GitHub App.
+type appInstallation struct {
+	ID      int64  `json:"id"`
+	AppSlug string `json:"app_slug"`
+	Account struct {
+		Login string `json:"login"`
+	} `json:"account"`
+	// RepositorySelection is "all" or "selected".
+	RepositorySelection string `json:"repository_selection"`
+	// Permissions maps each permission that the installation has
+	// (say, "members") to "read" or "write".
+	Permissions map[string]string `json:"permissions"`
+}
+
+// Installation returns the installation that app's tokens are for.
+func (app *appAuth) Installation(ctx context.Context) (appInstallation, error) {
+	// Getting a token looks up the installation if it wasn't given.
+	if _, err := app.Token(ctx); err != nil {
+		return appInstallation{}, err
+	}
+	var installation appInstallation
+	if err := app.request(ctx, http.MethodGet, fmt.Sprintf("/app/installations/%d", app.installationID), &installation); err != nil {
+		return appInstallation{}, fmt.Errorf("GitHub App %s: installation %d: %w", app.id, app.installationID, err)
+	}
+	return installation, nil
+}
+
+// authorization returns the Authorization header to send with an API
+// request.
+func authorization(ctx context.Context) (string, error) {
+	if githubApp != nil {
+		token, err := githubApp.Token(ctx)
+		if err != nil {
+			return "", err
+		}
+		return "bearer " + token, nil
+	}
+	return "bearer " + githubToken, nil
+}
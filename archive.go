@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// archiveProposalTitle is the title of the issues that
+// --create-issues files; it is also how we recognize that a proposal
+// has already been filed.
+const archiveProposalTitle = "Proposal: archive this repository"
+
+// ArchiveCandidate is a repository that looks like it is no longer in
+// use.
+type ArchiveCandidate struct {
+	Repo   RepoHandle
+	NodeID string
+
+	LastPush time.Time
+	// LastPullRequestActivity is when any pull request (open or
+	// closed) was last updated; zero if there have never been any.
+	LastPullRequestActivity time.Time
+	OpenPullRequests        int
+	// LastCommitter is the login of the author of the most recent
+	// commit on the default branch, if it can be tied to a GitHub
+	// user.
+	LastCommitter string
+	HasIssues     bool
+
+	// Writers are the logins of the users who can push to the
+	// repository, and ActiveWriters are those of them who have
+	// contributed anything to the org lately; see
+	// getWriterActivity.
+	Writers       []string
+	ActiveWriters []string
+}
+
+// getArchiveCandidates returns every non-archived repository in an
+// organization that hasn't been pushed to, and hasn't had any pull
+// request activity, since staleBefore.
+func getArchiveCandidates(ctx context.Context, orgname string, staleBefore time.Time) ([]ArchiveCandidate, error) {
+	query := `
+query getArchiveCandidates($orgname: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    repositories(first: $pageSize, after: $cursor, orderBy: {field: PUSHED_AT, direction: ASC}) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        id
+        name
+        url
+        isArchived
+        hasIssuesEnabled
+        pushedAt
+        openPullRequests: pullRequests(states: OPEN) {
+          totalCount
+        }
+        recentPullRequests: pullRequests(first: 1, orderBy: {field: UPDATED_AT, direction: DESC}) {
+          nodes {
+            updatedAt
+          }
+        }
+        defaultBranchRef {
+          target {
+            ... on Commit {
+              author {
+                user {
+                  login
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+	var rawRepos struct {
+		Organization struct {
+			Repositories struct {
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+				Nodes []struct {
+					ID               string
+					Name             string
+					URL              string
+					IsArchived       bool
+					HasIssuesEnabled bool
+					PushedAt         time.Time
+					OpenPullRequests struct {
+						TotalCount int
+					}
+					RecentPullRequests struct {
+						Nodes []struct {
+							UpdatedAt time.Time
+						}
+					}
+					DefaultBranchRef *struct {
+						Target struct {
+							Author *struct {
+								User *struct {
+									Login string
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+	}
+	var ret []ArchiveCandidate
+	for args["cursor"] == nil || rawRepos.Organization.Repositories.PageInfo.HasNextPage {
+		if ctx.Err() != nil {
+			return ret, errInterrupted
+		}
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawRepos, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			return nil, fmt.Errorf("getArchiveCandidates: %w", err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawRepos.Organization.Repositories.PageInfo.EndCursor
+
+		for _, repoInfo := range rawRepos.Organization.Repositories.Nodes {
+			if repoInfo.IsArchived || !repoInfo.PushedAt.Before(staleBefore) {
+				continue
+			}
+			candidate := ArchiveCandidate{
+				Repo:             RepoHandle{Name: repoInfo.Name, URL: repoInfo.URL},
+				NodeID:           repoInfo.ID,
+				LastPush:         repoInfo.PushedAt,
+				OpenPullRequests: repoInfo.OpenPullRequests.TotalCount,
+				HasIssues:        repoInfo.HasIssuesEnabled,
+			}
+			if prs := repoInfo.RecentPullRequests.Nodes; len(prs) > 0 {
+				candidate.LastPullRequestActivity = prs[0].UpdatedAt
+			}
+			if !candidate.LastPullRequestActivity.Before(staleBefore) {
+				// Somebody is still working on it, even if
+				// nothing has been merged lately.
+				continue
+			}
+			if ref := repoInfo.DefaultBranchRef; ref != nil && ref.Target.Author != nil && ref.Target.Author.User != nil {
+				candidate.LastCommitter = ref.Target.Author.User.Login
+			}
+			ret = append(ret, candidate)
+		}
+	}
+	return ret, nil
+}
+
+// fileArchiveProposal opens an issue in the candidate's repository
+// proposing that it be archived, unless there is already an open one.
+// It returns the URL of the issue, and whether it was newly created.
+func fileArchiveProposal(ctx context.Context, orgname string, candidate ArchiveCandidate, staleAfter time.Duration) (string, bool, error) {
+	var existing struct {
+		Search struct {
+			Nodes []struct {
+				URL string
+			}
+		}
+	}
+	err := graphql(ctx, &existing, `
+query findArchiveProposal($search: String!) {
+  search(query: $search, type: ISSUE, first: 1) {
+    nodes {
+      ... on Issue {
+        url
+      }
+    }
+  }
+}`, map[string]interface{}{
+		"search": fmt.Sprintf("repo:%s/%s is:issue is:open in:title %q", orgname, candidate.Repo.Name, archiveProposalTitle),
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("fileArchiveProposal: %q: %w", candidate.Repo.Name, err)
+	}
+	if len(existing.Search.Nodes) > 0 && existing.Search.Nodes[0].URL != "" {
+		return existing.Search.Nodes[0].URL, false, nil
+	}
+
+	body := fmt.Sprintf(`This repository looks like it is no longer in use:
+
+ - Last push: %s
+ - Last pull request activity: %s
+ - Open pull requests: %d
+ - People with write access who have contributed to the org lately: %s
+
+Nothing has been pushed to it, and no pull request has been touched, in over %s.  If it is no longer needed, it should be archived so that it stops accruing access grants that nobody reviews.  If it is still needed, please close this issue.`,
+		formatDate(candidate.LastPush), formatDate(candidate.LastPullRequestActivity), candidate.OpenPullRequests,
+		formatActiveWriters(candidate),
+		(*daysDuration)(&staleAfter))
+	var created struct {
+		CreateIssue struct {
+			Issue struct {
+				URL string
+			}
+		}
+	}
+	err = graphql(ctx, &created, `
+mutation createArchiveProposal($repositoryId: ID!, $title: String!, $body: String!) {
+  createIssue(input: {repositoryId: $repositoryId, title: $title, body: $body}) {
+    issue {
+      url
+    }
+  }
+}`, map[string]interface{}{
+		"repositoryId": candidate.NodeID,
+		"title":        archiveProposalTitle,
+		"body":         body,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("fileArchiveProposal: %q: %w", candidate.Repo.Name, err)
+	}
+	return created.CreateIssue.Issue.URL, true, nil
+}
+
+// contributionsBatch is how many users getWriterActivity asks about in
+// a query.
+const contributionsBatch = 50
+
+// getWriterActivity fills in the Writers and ActiveWriters of each of
+// candidates.  A writer is active if they have contributed anything to
+// orgname (commits, issues, pull requests, or reviews, in any of its
+// repositories) since the later of since and a year ago; GitHub only
+// counts contributions a year at a time.
+func getWriterActivity(ctx context.Context, orgname string, candidates []ArchiveCandidate, since time.Time) error {
+	var rawOrg struct {
+		Organization struct {
+			ID string
+		}
+	}
+	err := graphql(ctx, &rawOrg, `
+query getOrgID($orgname: String!) {
+  organization(login: $orgname) {
+    id
+  }
+}`, map[string]interface{}{"orgname": orgname})
+	if err != nil {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		return fmt.Errorf("getWriterActivity: %w", err)
+	}
+	if yearAgo := time.Now().AddDate(-1, 0, 0); since.Before(yearAgo) {
+		since = yearAgo
+	}
+
+	writers := make(map[string]bool)
+	for i := range candidates {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		fmt.Fprintf(os.Stderr, "getting the writers of %d/%d %s\n", i, len(candidates), candidates[i].Repo.Name)
+		// Only the permissions matter here, not which teams
+		// they come from, so there's no need for the teams'
+		// names.
+		users, _, err := getRepoUsers(ctx, nil, orgname, candidates[i].Repo.Name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return errInterrupted
+			}
+			return fmt.Errorf("getWriterActivity: %w", err)
+		}
+		candidates[i].Writers = nil
+		for _, user := range users {
+			if user.Permission >= PermWRITE && !isBot(Principal{Kind: KindUser, Name: user.Login}) {
+				candidates[i].Writers = append(candidates[i].Writers, user.Login)
+				writers[user.Login] = true
+			}
+		}
+		sort.Strings(candidates[i].Writers)
+	}
+
+	logins := sortedKeys(writers)
+	active := make(map[string]bool)
+	for start := 0; start < len(logins); start += contributionsBatch {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		end := start + contributionsBatch
+		if end > len(logins) {
+			end = len(logins)
+		}
+		fmt.Fprintf(os.Stderr, "getting contributions %d/%d\n", start, len(logins))
+		var params, fields strings.Builder
+		arguments := map[string]interface{}{"orgID": rawOrg.Organization.ID, "since": since.UTC().Format(time.RFC3339)}
+		for i, login := range logins[start:end] {
+			fmt.Fprintf(&params, ", $login%d: String!", i)
+			fmt.Fprintf(&fields, `
+  user%d: user(login: $login%d) {
+    login
+    contributionsCollection(organizationID: $orgID, from: $since) {
+      hasAnyContributions
+    }
+  }`, i, i)
+			arguments[fmt.Sprintf("login%d", i)] = login
+		}
+		query := fmt.Sprintf("\nquery getContributions($orgID: ID!, $since: DateTime!%s) {%s\n}", params.String(), fields.String())
+		var raw map[string]*struct {
+			Login                   string
+			ContributionsCollection struct {
+				HasAnyContributions bool
+			}
+		}
+		if err := graphql(ctx, &raw, query, arguments); err != nil {
+			if ctx.Err() != nil {
+				return errInterrupted
+			}
+			return fmt.Errorf("getWriterActivity: %w", err)
+		}
+		for _, user := range raw {
+			// The response also has the rate limit info that
+			// graphql asks for.
+			if user == nil || user.Login == "" {
+				continue
+			}
+			if user.ContributionsCollection.HasAnyContributions {
+				active[user.Login] = true
+			}
+		}
+	}
+
+	for i := range candidates {
+		candidates[i].ActiveWriters = nil
+		for _, login := range candidates[i].Writers {
+			if active[login] {
+				candidates[i].ActiveWriters = append(candidates[i].ActiveWriters, login)
+			}
+		}
+	}
+	return nil
+}
+
+// formatActiveWriters returns how many of candidate's writers are
+// active, such as "1 of 3 (alice)".
+func formatActiveWriters(candidate ArchiveCandidate) string {
+	ret := fmt.Sprintf("%d of %d", len(candidate.ActiveWriters), len(candidate.Writers))
+	if len(candidate.ActiveWriters) > 0 {
+		ret += " (" + strings.Join(candidate.ActiveWriters, ", ") + ")"
+	}
+	return ret
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02")
+}
+
+var archiveCandidatesCommand = &command{
+	Name:    "archive-candidates",
+	Args:    []string{"ORGNAME"},
+	Summary: "List repositories that look abandoned enough to archive",
+	Description: `
+Lists every non-archived repository that hasn't been pushed to, and
+hasn't had any pull request opened, updated, or closed, within the
+--stale-after window; stalest first.  For each one it shows the last
+push, the last pull request activity, how many pull requests are still
+open, who made the last commit on the default branch, and how many of
+the people who can push to it have contributed anything to the org
+(in any repository) within the window, and who they are.  Those are
+the people most likely to know whether it's still needed; a repository
+that none of them is active in any more is the safest to archive.
+GitHub only counts contributions a year at a time, so with a longer
+--stale-after, "active" means within the past year.
+
+With --create-issues, it also files an issue in each candidate
+repository proposing that it be archived, unless such an issue is
+already open.  Repositories with issues disabled are skipped.`,
+	Examples: []example{
+		{"List repositories untouched for two years.", progName + " archive-candidates --stale-after=730d datawire"},
+		{"File archival proposals in repositories untouched for a year.", progName + " archive-candidates --create-issues datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		staleAfter := daysDuration(365 * 24 * time.Hour)
+		fs.Var(&staleAfter, "stale-after", "how long a repository must have gone without pushes or pull request activity")
+		createIssues := fs.Bool("create-issues", false, "file an issue in each candidate repository proposing that it be archived")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			since := time.Now().Add(-time.Duration(staleAfter))
+			candidates, err := getArchiveCandidates(ctx, orgname, since)
+			if err != nil && err != errInterrupted {
+				return err
+			}
+			sort.SliceStable(candidates, func(i, j int) bool {
+				return candidates[i].LastPush.Before(candidates[j].LastPush)
+			})
+			if err == nil {
+				err = getWriterActivity(ctx, orgname, candidates, since)
+				if err != nil && err != errInterrupted {
+					return err
+				}
+			}
+
+			output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(output, "Repository URL\t| Last push\t| Last PR activity\t| Open PRs\t| Last committer\t| Active writers\n")
+			fmt.Fprintf(output, "--------------\t| ---------\t| ----------------\t| --------\t| --------------\t| --------------\n")
+			for _, candidate := range candidates {
+				fmt.Fprintf(output, "%s\t| %s\t| %s\t| %d\t| %s\t| %s\n",
+					candidate.Repo.URL,
+					formatDate(candidate.LastPush),
+					formatDate(candidate.LastPullRequestActivity),
+					candidate.OpenPullRequests,
+					candidate.LastCommitter,
+					formatActiveWriters(candidate))
+			}
+			output.Flush()
+			if err == errInterrupted {
+				fmt.Fprintf(os.Stdout, "PARTIAL REPORT: interrupted after finding %d candidates\n", len(candidates))
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%d archive candidates\n", len(candidates))
+
+			if !*createIssues {
+				return nil
+			}
+			for _, candidate := range candidates {
+				if ctx.Err() != nil {
+					return errInterrupted
+				}
+				if !candidate.HasIssues {
+					fmt.Fprintf(os.Stderr, "skipping %s: issues are disabled\n", candidate.Repo.URL)
+					continue
+				}
+				url, created, err := fileArchiveProposal(ctx, orgname, candidate, time.Duration(staleAfter))
+				if err != nil {
+					return err
+				}
+				if created {
+					fmt.Fprintf(os.Stderr, "filed %s\n", url)
+				} else {
+					fmt.Fprintf(os.Stderr, "already filed: %s\n", url)
+				}
+			}
+			return nil
+		}
+	},
+}
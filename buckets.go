@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Bucket is one column of the report: the grants to whichever
+// principals it matches.  Buckets may overlap; an outside collaborator
+// is in both the "user" and the "outside" bucket.
+type Bucket struct {
+	Name  string
+	Title string
+	// NeedsMembers is set if Match looks at the members argument,
+	// so that we only fetch the org's member list if some bucket
+	// that's being reported on needs it.
+	NeedsMembers bool
+	// Match reports whether grants to p belong in the bucket.
+	// members is the set of logins of the org's members.
+	Match func(p Principal, members map[string]bool) bool
+}
+
+// buckets is every bucket that can be asked for with --sources, in the
+// order that they are listed in help text.
+var buckets = []*Bucket{
+	{
+		Name:  "org",
+		Title: "Organizations",
+		Match: func(p Principal, _ map[string]bool) bool { return p.Kind == KindOrg },
+	},
+	{
+		Name:  "team",
+		Title: "Teams",
+		Match: func(p Principal, _ map[string]bool) bool { return p.Kind == KindTeam },
+	},
+	{
+		Name:  "user",
+		Title: "Individuals",
+		Match: func(p Principal, _ map[string]bool) bool { return p.Kind == KindUser },
+	},
+	{
+		Name:         "member",
+		Title:        "Members",
+		NeedsMembers: true,
+		Match:        func(p Principal, members map[string]bool) bool { return p.Kind == KindUser && members[p.Name] },
+	},
+	{
+		Name:         "outside",
+		Title:        "Outside collaborators",
+		NeedsMembers: true,
+		Match: func(p Principal, members map[string]bool) bool {
+			return p.Kind == KindUser && !members[p.Name] && !isBot(p)
+		},
+	},
+	{
+		Name:  "bot",
+		Title: "Bots",
+		Match: func(p Principal, _ map[string]bool) bool { return isBot(p) },
+	},
+}
+
+// isBot returns whether p is the bot user of a GitHub App, which
+// GitHub names "APPNAME[bot]".
+func isBot(p Principal) bool {
+	return p.Kind == KindUser && strings.HasSuffix(p.Name, "[bot]")
+}
+
+func lookupBucket(name string) *Bucket {
+	for _, b := range buckets {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+func bucketNames() []string {
+	names := make([]string, len(buckets))
+	for i, b := range buckets {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// A Grouping is the buckets that a report is split in to, along with
+// what is needed to decide which principals go in to which.
+type Grouping struct {
+	Buckets []*Bucket
+	// Members is the logins of the org's members; it is only
+	// filled in if one of the Buckets NeedsMembers.
+	Members map[string]bool
+	// UINames makes Format use the permission names from GitHub's
+	// web UI; see Permission.UIName.
+	UINames bool
+}
+
+// NeedsMembers returns whether any of g's buckets NeedsMembers.
+func (g Grouping) NeedsMembers() bool {
+	for _, b := range g.Buckets {
+		if b.NeedsMembers {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns whether p is in any of g's buckets.
+func (g Grouping) Matches(p Principal) bool {
+	for _, b := range g.Buckets {
+		if b.Match(p, g.Members) {
+			return true
+		}
+	}
+	return false
+}
+
+// Format returns the grants to principals in bucket b, as a sorted,
+// space-separated list of "name=PERMISSION".
+func (g Grouping) Format(collaborators map[Principal]Permission, b *Bucket) string {
+	var items []string
+	for principal, permission := range collaborators {
+		if b.Match(principal, g.Members) {
+			items = append(items, fmt.Sprintf("%s=%s", principal.Name, permissionName(permission, g.UINames)))
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, " ")
+}
+
+// permissionName returns p's name: as in GitHub's web UI if uiNames,
+// and as in the API otherwise.
+func permissionName(p Permission, uiNames bool) string {
+	if uiNames {
+		return p.UIName()
+	}
+	return p.String()
+}
+
+// getOrgMembers returns the set of logins of the members (including
+// owners) of an organization.
+func getOrgMembers(ctx context.Context, orgname string) (map[string]bool, error) {
+	query := `
+query getOrgMembers($orgname: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    membersWithRole(first: $pageSize, after: $cursor) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        login
+      }
+    }
+  }
+}`
+	var rawMembers struct {
+		Organization struct {
+			MembersWithRole struct {
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+				Nodes []struct {
+					Login string
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+	}
+	ret := make(map[string]bool)
+	for args["cursor"] == nil || rawMembers.Organization.MembersWithRole.PageInfo.HasNextPage {
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawMembers, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, fmt.Errorf("getOrgMembers: %w", err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawMembers.Organization.MembersWithRole.PageInfo.EndCursor
+
+		for _, member := range rawMembers.Organization.MembersWithRole.Nodes {
+			ret[member.Login] = true
+		}
+	}
+	return ret, nil
+}
+
+// teamMembership is, for each of an org's teams (by slug), the logins
+// of its immediate members, and the slug of its parent team.
+type teamMembership struct {
+	Members map[string][]string
+	Parents map[string]string
+}
+
+// Users maps each team's slug to everyone who gets its grants: its
+// own members, and those of its descendants.
+func (teams teamMembership) Users() map[string]map[string]bool {
+	ret := make(map[string]map[string]bool)
+	for slug, logins := range teams.Members {
+		for tip := slug; tip != ""; tip = teams.Parents[tip] {
+			if ret[tip] == nil {
+				ret[tip] = make(map[string]bool)
+			}
+			for _, login := range logins {
+				ret[tip][login] = true
+			}
+		}
+	}
+	return ret
+}
+
+// getTeamMembership returns the immediate members and the parent of
+// each of an org's teams.
+func getTeamMembership(ctx context.Context, orgname string) (teamMembership, error) {
+	query := `
+query getTeamMembership($orgname: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    teams(first: $pageSize, after: $cursor) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        slug
+        parentTeam {
+          slug
+        }
+        members(membership: IMMEDIATE, first: 100) {
+          pageInfo {
+            hasNextPage
+            endCursor
+          }
+          nodes {
+            login
+          }
+        }
+      }
+    }
+  }
+}`
+	var rawTeams struct {
+		Organization struct {
+			Teams struct {
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+				Nodes []struct {
+					Slug       string
+					ParentTeam *struct {
+						Slug string
+					}
+					Members struct {
+						PageInfo struct {
+							HasNextPage bool
+							EndCursor   string
+						}
+						Nodes []struct {
+							Login string
+						}
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+	}
+	ret := teamMembership{
+		Members: make(map[string][]string),
+		Parents: make(map[string]string),
+	}
+	for args["cursor"] == nil || rawTeams.Organization.Teams.PageInfo.HasNextPage {
+		args["pageSize"] = pageSize.Size()
+		rawTeams.Organization.Teams.Nodes = nil
+		err := graphql(ctx, &rawTeams, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			return teamMembership{}, fmt.Errorf("getTeamMembership: %w", err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawTeams.Organization.Teams.PageInfo.EndCursor
+
+		for _, team := range rawTeams.Organization.Teams.Nodes {
+			if team.ParentTeam != nil {
+				ret.Parents[team.Slug] = team.ParentTeam.Slug
+			}
+			logins := []string{}
+			for _, member := range team.Members.Nodes {
+				logins = append(logins, member.Login)
+			}
+			if team.Members.PageInfo.HasNextPage {
+				more, err := getTeamMembers(ctx, orgname, team.Slug, team.Members.PageInfo.EndCursor)
+				if err != nil {
+					return teamMembership{}, err
+				}
+				logins = append(logins, more...)
+			}
+			ret.Members[team.Slug] = logins
+		}
+	}
+	return ret, nil
+}
+
+// getTeamMembers returns the logins of a team's immediate members
+// after cursor, for the teams that getTeamMembership can't get all of
+// the members of along with the rest of the team.
+func getTeamMembers(ctx context.Context, orgname, slug, cursor string) ([]string, error) {
+	query := `
+query getTeamMembers($orgname: String!, $slug: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    team(slug: $slug) {
+      members(membership: IMMEDIATE, first: $pageSize, after: $cursor) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          login
+        }
+      }
+    }
+  }
+}`
+	var rawTeam struct {
+		Organization struct {
+			Team *struct {
+				Members struct {
+					PageInfo struct {
+						HasNextPage bool
+						EndCursor   string
+					}
+					Nodes []struct {
+						Login string
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+		"slug":    slug,
+		"cursor":  cursor,
+	}
+	var ret []string
+	for {
+		args["pageSize"] = pageSize.Size()
+		rawTeam.Organization.Team = nil
+		err := graphql(ctx, &rawTeam, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, fmt.Errorf("getTeamMembers: %q: %w", slug, err)
+		}
+		pageSize.Succeeded()
+		if rawTeam.Organization.Team == nil {
+			// It was deleted while we were looking.
+			return ret, nil
+		}
+		args["cursor"] = rawTeam.Organization.Team.Members.PageInfo.EndCursor
+
+		for _, member := range rawTeam.Organization.Team.Members.Nodes {
+			ret = append(ret, member.Login)
+		}
+		if !rawTeam.Organization.Team.Members.PageInfo.HasNextPage {
+			return ret, nil
+		}
+	}
+}
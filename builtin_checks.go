@@ -0,0 +1,643 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// directUserGrantsCheck flags access that has been granted to
+// individual users rather than through a team, since those grants
+// tend not to get revisited when people change roles.
+type directUserGrantsCheck struct{}
+
+func (*directUserGrantsCheck) Name() string { return "direct-user-grants" }
+func (*directUserGrantsCheck) Description() string {
+	return "users granted access to a repo directly rather than through a team"
+}
+func (*directUserGrantsCheck) DefaultSeverity() Severity { return SeverityInfo }
+func (*directUserGrantsCheck) Controls() []string        { return []string{"ac-2"} }
+
+func (*directUserGrantsCheck) Evaluate(snap *Snapshot) []Finding {
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		for _, principal := range sortedPrincipals(repo.Collaborators) {
+			if principal.Kind != KindUser || isBot(principal) {
+				continue
+			}
+			ret = append(ret, Finding{
+				Repo:      repo.Repo.Name,
+				Principal: principal,
+				Message:   fmt.Sprintf("granted %s directly", repo.Collaborators[principal]),
+			})
+		}
+	}
+	return ret
+}
+
+// directUserAdminCheck flags individual users who have been granted
+// ADMIN directly.
+type directUserAdminCheck struct{}
+
+func (*directUserAdminCheck) Name() string { return "direct-user-admin" }
+func (*directUserAdminCheck) Description() string {
+	return "users granted ADMIN on a repo directly rather than through a team"
+}
+func (*directUserAdminCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*directUserAdminCheck) Controls() []string        { return []string{"ac-6.5"} }
+
+func (*directUserAdminCheck) Evaluate(snap *Snapshot) []Finding {
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		for _, principal := range sortedPrincipals(repo.Collaborators) {
+			if principal.Kind == KindUser && repo.Collaborators[principal] == PermADMIN {
+				ret = append(ret, Finding{
+					Repo:      repo.Repo.Name,
+					Principal: principal,
+					Message:   "granted ADMIN directly",
+				})
+			}
+		}
+	}
+	return ret
+}
+
+// outsideCollaboratorPermissionCheck flags outside collaborators whose
+// permission is above a configurable maximum.
+type outsideCollaboratorPermissionCheck struct {
+	Max Permission
+}
+
+func (*outsideCollaboratorPermissionCheck) Name() string { return "outside-collaborator-permission" }
+func (c *outsideCollaboratorPermissionCheck) Description() string {
+	return fmt.Sprintf("outside collaborators with more than %s (option: max)", c.Max)
+}
+func (*outsideCollaboratorPermissionCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*outsideCollaboratorPermissionCheck) Controls() []string        { return []string{"ac-6"} }
+
+func (c *outsideCollaboratorPermissionCheck) Configure(options json.RawMessage) error {
+	var opts struct {
+		Max *Permission `json:"max"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return err
+	}
+	if opts.Max != nil {
+		c.Max = *opts.Max
+	}
+	return nil
+}
+
+func (c *outsideCollaboratorPermissionCheck) Evaluate(snap *Snapshot) []Finding {
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		for _, principal := range sortedPrincipals(repo.Collaborators) {
+			if principal.Kind != KindUser || snap.Members[principal.Name] || isBot(principal) {
+				continue
+			}
+			if perm := repo.Collaborators[principal]; perm > c.Max {
+				ret = append(ret, Finding{
+					Repo:      repo.Repo.Name,
+					Principal: principal,
+					Message:   fmt.Sprintf("outside collaborator has %s (maximum is %s)", perm, c.Max),
+				})
+			}
+		}
+	}
+	return ret
+}
+
+// botAdminCheck flags GitHub App bot users with ADMIN, which is more
+// than any app should need on a single repo.
+type botAdminCheck struct{}
+
+func (*botAdminCheck) Name() string              { return "bot-admin" }
+func (*botAdminCheck) Description() string       { return "GitHub App bot users granted ADMIN" }
+func (*botAdminCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*botAdminCheck) Controls() []string        { return []string{"ac-6.5"} }
+
+func (*botAdminCheck) Evaluate(snap *Snapshot) []Finding {
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		for _, principal := range sortedPrincipals(repo.Collaborators) {
+			if isBot(principal) && repo.Collaborators[principal] == PermADMIN {
+				ret = append(ret, Finding{
+					Repo:      repo.Repo.Name,
+					Principal: principal,
+					Message:   "bot has ADMIN",
+				})
+			}
+		}
+	}
+	return ret
+}
+
+// osiLicenses is the SPDX IDs of the OSI-approved licenses that GitHub
+// can detect.
+var osiLicenses = []string{
+	"0BSD", "AFL-3.0", "AGPL-3.0", "Apache-2.0", "Artistic-2.0",
+	"BSD-2-Clause", "BSD-3-Clause", "BSL-1.0", "CECILL-2.1", "ECL-2.0",
+	"EPL-1.0", "EPL-2.0", "EUPL-1.1", "EUPL-1.2", "GPL-2.0", "GPL-3.0",
+	"ISC", "LGPL-2.1", "LGPL-3.0", "LPPL-1.3c", "MIT", "MIT-0",
+	"MPL-2.0", "MS-PL", "MS-RL", "MulanPSL-2.0", "NCSA", "OFL-1.1",
+	"OSL-3.0", "PostgreSQL", "UPL-1.0", "Unlicense", "Zlib",
+}
+
+// publicRepoLicenseCheck flags public repos that don't have one of an
+// allowed list of licenses (by default, any OSI-approved license).
+type publicRepoLicenseCheck struct {
+	Allowed []string
+}
+
+func (*publicRepoLicenseCheck) Name() string { return "public-repo-license" }
+func (*publicRepoLicenseCheck) Description() string {
+	return "public repos without an OSI-approved license (option: allowed, a list of SPDX IDs)"
+}
+func (*publicRepoLicenseCheck) DefaultSeverity() Severity { return SeverityWarning }
+
+func (c *publicRepoLicenseCheck) Configure(options json.RawMessage) error {
+	var opts struct {
+		Allowed []string `json:"allowed"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return err
+	}
+	if opts.Allowed != nil {
+		c.Allowed = opts.Allowed
+	}
+	return nil
+}
+
+func (c *publicRepoLicenseCheck) Evaluate(snap *Snapshot) []Finding {
+	allowed := make(map[string]bool, len(c.Allowed))
+	for _, spdxID := range c.Allowed {
+		allowed[strings.ToLower(spdxID)] = true
+	}
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		if repo.Repo.Visibility != "PUBLIC" || allowed[strings.ToLower(repo.Repo.License)] {
+			continue
+		}
+		var msg string
+		switch repo.Repo.License {
+		case "":
+			msg = "public repo has no license"
+		case "NOASSERTION":
+			msg = "public repo has a license that GitHub doesn't recognize"
+		default:
+			msg = fmt.Sprintf("public repo has license %s, which is not allowed", repo.Repo.License)
+		}
+		ret = append(ret, Finding{
+			Repo:    repo.Repo.Name,
+			Message: msg,
+		})
+	}
+	return ret
+}
+
+// requiredTeamAccessCheck flags repos on which a team doesn't have at
+// least a given permission, like a platform team that is supposed to
+// be able to administer everything.
+type requiredTeamAccessCheck struct {
+	// Teams maps each team's full name ("parent/child") to the
+	// permission that it must have.
+	Teams map[string]Permission
+}
+
+func (*requiredTeamAccessCheck) Name() string { return "required-team-access" }
+func (*requiredTeamAccessCheck) Description() string {
+	return "repos on which a team lacks a required permission (option: teams, a map of team full name to permission)"
+}
+func (*requiredTeamAccessCheck) DefaultSeverity() Severity { return SeverityError }
+func (*requiredTeamAccessCheck) Controls() []string        { return []string{"ac-2"} }
+
+func (c *requiredTeamAccessCheck) Configure(options json.RawMessage) error {
+	var opts struct {
+		Teams map[string]Permission `json:"teams"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return err
+	}
+	if opts.Teams != nil {
+		c.Teams = opts.Teams
+	}
+	return nil
+}
+
+func (c *requiredTeamAccessCheck) Evaluate(snap *Snapshot) []Finding {
+	teams := make([]string, 0, len(c.Teams))
+	for team := range c.Teams {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		for _, team := range teams {
+			// A team gets its ancestors' grants too (and a
+			// child team's own grant may have been dropped in
+			// normalization if its parent has the same one).
+			var perm Permission
+			for principal, granted := range repo.Collaborators {
+				if principal.Kind == KindTeam && (principal.Name == team || strings.HasPrefix(team, principal.Name+"/")) && granted > perm {
+					perm = granted
+				}
+			}
+			if want := c.Teams[team]; perm < want {
+				msg := fmt.Sprintf("team has %s (must have at least %s)", perm, want)
+				if perm == PermNONE {
+					msg = fmt.Sprintf("team has no access (must have at least %s)", want)
+				}
+				ret = append(ret, Finding{
+					Repo:      repo.Repo.Name,
+					Principal: Principal{Kind: KindTeam, Name: team},
+					Message:   msg,
+				})
+			}
+		}
+	}
+	return ret
+}
+
+// repoSettingsCheck flags repos whose settings let WRITE access do
+// more than policy allows.  By default it only flags default branches
+// that can be force-pushed to or deleted; the rest of its rules are
+// off until they are configured.
+type repoSettingsCheck struct {
+	AllowForcePushes     bool     `json:"allow_force_pushes"`
+	AllowDeletions       bool     `json:"allow_deletions"`
+	RequirePullRequests  bool     `json:"require_pull_requests"`
+	MinApprovals         int      `json:"min_approvals"`
+	RequireLinearHistory bool     `json:"require_linear_history"`
+	RequireIssues        bool     `json:"require_issues"`
+	MergeMethods         []string `json:"merge_methods"`
+}
+
+func (*repoSettingsCheck) Name() string { return "repo-settings" }
+func (*repoSettingsCheck) Description() string {
+	return "repos whose default branch can be force-pushed to or deleted (options: allow_force_pushes, allow_deletions, require_pull_requests, min_approvals, require_linear_history, require_issues, and merge_methods, a list of 'merge', 'squash', and 'rebase')"
+}
+func (*repoSettingsCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*repoSettingsCheck) Controls() []string        { return []string{"cm-5"} }
+
+func (c *repoSettingsCheck) Configure(options json.RawMessage) error {
+	if err := json.Unmarshal(options, c); err != nil {
+		return err
+	}
+	for _, method := range c.MergeMethods {
+		if method != "merge" && method != "squash" && method != "rebase" {
+			return fmt.Errorf("invalid merge method %q (must be 'merge', 'squash', or 'rebase')", method)
+		}
+	}
+	return nil
+}
+
+func (c *repoSettingsCheck) Evaluate(snap *Snapshot) []Finding {
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		// Nobody can push to an archived repo.
+		if repo.Repo.IsArchived {
+			continue
+		}
+		s := repo.Repo.Settings
+		add := func(format string, args ...interface{}) {
+			ret = append(ret, Finding{Repo: repo.Repo.Name, Message: fmt.Sprintf(format, args...)})
+		}
+		// An empty repo has no default branch to protect yet.
+		if s.DefaultBranch != "" {
+			if !c.AllowForcePushes && s.AllowsForcePushes() {
+				add("default branch %s can be force-pushed to by anyone with WRITE", s.DefaultBranch)
+			}
+			if !c.AllowDeletions && s.AllowsDeletions() {
+				add("default branch %s can be deleted by anyone with WRITE", s.DefaultBranch)
+			}
+			switch n := s.RequiredApprovals(); {
+			case n < 0 && (c.RequirePullRequests || c.MinApprovals > 0):
+				add("default branch %s can be pushed to directly, without a pull request", s.DefaultBranch)
+			case n >= 0 && n < c.MinApprovals:
+				add("pull requests to %s need %d approvals (must need at least %d)", s.DefaultBranch, n, c.MinApprovals)
+			}
+			if c.RequireLinearHistory && !s.RequiresLinearHistory() {
+				add("default branch %s does not require linear history", s.DefaultBranch)
+			}
+		}
+		if c.RequireIssues && !s.HasIssues {
+			add("issues are disabled")
+		}
+		if c.MergeMethods != nil {
+			allowed := make(map[string]bool, len(c.MergeMethods))
+			for _, method := range c.MergeMethods {
+				allowed[method] = true
+			}
+			for _, method := range s.MergeMethods() {
+				if !allowed[method] {
+					add("pull requests can be merged with %s, which is not allowed", method)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// secretTeamAccessCheck flags secret teams with more than a
+// configurable maximum permission on a repo.  Only a secret team's own
+// members (and the org's owners) can see that it exists, so it hides
+// who can administer what from everyone else in the org.
+type secretTeamAccessCheck struct {
+	Max Permission
+}
+
+func (*secretTeamAccessCheck) Name() string { return "secret-team-access" }
+func (c *secretTeamAccessCheck) Description() string {
+	return fmt.Sprintf("secret teams with more than %s on a repo (option: max)", c.Max)
+}
+func (*secretTeamAccessCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*secretTeamAccessCheck) Controls() []string        { return []string{"ac-2"} }
+
+func (c *secretTeamAccessCheck) Configure(options json.RawMessage) error {
+	var opts struct {
+		Max *Permission `json:"max"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return err
+	}
+	if opts.Max != nil {
+		c.Max = *opts.Max
+	}
+	return nil
+}
+
+func (c *secretTeamAccessCheck) Evaluate(snap *Snapshot) []Finding {
+	// Secret teams can't be nested, so there are no inherited
+	// grants to worry about.
+	secret := make(map[string]bool)
+	for _, team := range snap.Teams {
+		if team.Secret {
+			secret[team.Fullname] = true
+		}
+	}
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		for _, principal := range sortedPrincipals(repo.Collaborators) {
+			if principal.Kind != KindTeam || !secret[principal.Name] {
+				continue
+			}
+			if perm := repo.Collaborators[principal]; perm > c.Max {
+				ret = append(ret, Finding{
+					Repo:      repo.Repo.Name,
+					Principal: principal,
+					Message:   fmt.Sprintf("secret team has %s (maximum is %s)", perm, c.Max),
+				})
+			}
+		}
+	}
+	return ret
+}
+
+// suspendedUserCheck flags the grants and org memberships that
+// suspended users still hold.  It only finds anything with
+// --suspended-users, on GitHub Enterprise Server.
+type suspendedUserCheck struct{}
+
+func (*suspendedUserCheck) Name() string { return "suspended-users" }
+func (*suspendedUserCheck) Description() string {
+	return "suspended users who are still org members or have grants (needs --suspended-users)"
+}
+func (*suspendedUserCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*suspendedUserCheck) Controls() []string        { return []string{"ac-2"} }
+
+func (*suspendedUserCheck) Evaluate(snap *Snapshot) []Finding {
+	since := func(login string) string {
+		return snap.Suspended[login].Format("2006-01-02")
+	}
+	suspended := make([]string, 0, len(snap.Suspended))
+	for login := range snap.Suspended {
+		suspended = append(suspended, login)
+	}
+	sort.Strings(suspended)
+	var ret []Finding
+	for _, login := range suspended {
+		if snap.Members[login] {
+			ret = append(ret, Finding{
+				Principal: Principal{Kind: KindUser, Name: login},
+				Message:   fmt.Sprintf("suspended since %s, but still a member of the org", since(login)),
+			})
+		}
+	}
+	for _, repo := range snap.Repos {
+		for _, principal := range sortedPrincipals(repo.Collaborators) {
+			if _, ok := snap.Suspended[principal.Name]; !ok || principal.Kind != KindUser {
+				continue
+			}
+			ret = append(ret, Finding{
+				Repo:      repo.Repo.Name,
+				Principal: principal,
+				Message:   fmt.Sprintf("suspended since %s, but still granted %s", since(principal.Name), repo.Collaborators[principal]),
+			})
+		}
+	}
+	return ret
+}
+
+// verifiedEmailCheck flags users with more than a configurable maximum
+// permission on a private or internal repo who have no verified email
+// address in any of the company's domains, which is how a contractor
+// is told from an employee (a profile's company can say anything).
+// It only finds anything with --user-details and the domains option.
+type verifiedEmailCheck struct {
+	Domains       []string   `json:"domains"`
+	Max           Permission `json:"max"`
+	IncludePublic bool       `json:"include_public"`
+}
+
+func (*verifiedEmailCheck) Name() string { return "verified-email" }
+func (c *verifiedEmailCheck) Description() string {
+	return fmt.Sprintf("users without a verified email in the company's domains with more than %s on a private repo (needs --user-details; options: domains, max, include_public)", c.Max)
+}
+func (*verifiedEmailCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*verifiedEmailCheck) Controls() []string        { return []string{"ps-7"} }
+
+func (c *verifiedEmailCheck) Configure(options json.RawMessage) error {
+	if err := json.Unmarshal(options, c); err != nil {
+		return err
+	}
+	for i, domain := range c.Domains {
+		c.Domains[i] = strings.ToLower(strings.TrimPrefix(domain, "@"))
+	}
+	return nil
+}
+
+// verified reports whether any of emails is in one of c's domains.
+func (c *verifiedEmailCheck) verified(emails []string) bool {
+	for _, email := range emails {
+		_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+		for _, want := range c.Domains {
+			if domain == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *verifiedEmailCheck) Evaluate(snap *Snapshot) []Finding {
+	if len(c.Domains) == 0 || snap.Users == nil {
+		return nil
+	}
+	teamUsers := snap.TeamMembers.Users()
+	var ret []Finding
+	for _, repo := range snap.Repos {
+		// Nobody can push to an archived repo.
+		if repo.Repo.IsArchived || (repo.Repo.Visibility == "PUBLIC" && !c.IncludePublic) {
+			continue
+		}
+		// Each user's highest permission, and the grant that it
+		// comes from.
+		perms := make(map[string]Permission)
+		sources := make(map[string]Principal)
+		grant := func(login string, principal Principal, perm Permission) {
+			if perm > perms[login] {
+				perms[login] = perm
+				sources[login] = principal
+			}
+		}
+		for principal, perm := range repo.Collaborators {
+			switch principal.Kind {
+			case KindUser:
+				grant(principal.Name, principal, perm)
+			case KindTeam:
+				for login := range teamUsers[teamSlug(principal.Name)] {
+					grant(login, principal, perm)
+				}
+			case KindOrg:
+				for login := range snap.Members {
+					grant(login, principal, perm)
+				}
+			}
+		}
+		logins := make([]string, 0, len(perms))
+		for login := range perms {
+			logins = append(logins, login)
+		}
+		sort.Strings(logins)
+		for _, login := range logins {
+			// A user who wasn't looked up (because the run was
+			// cut off) isn't known not to be verified.
+			details, ok := snap.Users[login]
+			if !ok || perms[login] <= c.Max || c.verified(details.VerifiedEmails) {
+				continue
+			}
+			msg := fmt.Sprintf("has %s through %s, but no verified email in %s (maximum is %s)",
+				perms[login], sources[login], strings.Join(c.Domains, ", "), c.Max)
+			if details.Company != "" {
+				msg += fmt.Sprintf("; profile says company %q", details.Company)
+			}
+			ret = append(ret, Finding{
+				Repo:      repo.Repo.Name,
+				Principal: Principal{Kind: KindUser, Name: login},
+				Message:   msg,
+			})
+		}
+	}
+	return ret
+}
+
+// ownerSuccessionCheck flags an org with fewer than a configurable
+// minimum of owners, since if the only owner leaves (or loses their
+// 2FA device) nobody can administer it, and one whose owners are all
+// in the same department, since a reorganization can take them all at
+// once.  An owner's department is given by a configurable map of login
+// to department, or else by which of a configurable list of teams
+// (each standing for a department) they are in.
+type ownerSuccessionCheck struct {
+	MinOwners   int               `json:"min_owners"`
+	Departments map[string]string `json:"departments"`
+	// DepartmentTeams is the slugs of teams, in order of preference,
+	// that each stand for a department.
+	DepartmentTeams []string `json:"department_teams"`
+}
+
+func (*ownerSuccessionCheck) Name() string { return "owner-succession" }
+func (c *ownerSuccessionCheck) Description() string {
+	return fmt.Sprintf("fewer than %d org owners, or all of them in one department (options: min_owners, departments, department_teams)", c.MinOwners)
+}
+func (*ownerSuccessionCheck) DefaultSeverity() Severity { return SeverityWarning }
+func (*ownerSuccessionCheck) Controls() []string        { return []string{"cp-2"} }
+
+// NeedsTeamMembership implements teamMembershipCheck.
+func (c *ownerSuccessionCheck) NeedsTeamMembership() bool { return len(c.DepartmentTeams) > 0 }
+
+func (c *ownerSuccessionCheck) Configure(options json.RawMessage) error {
+	if err := json.Unmarshal(options, c); err != nil {
+		return err
+	}
+	departments := make(map[string]string, len(c.Departments))
+	for login, department := range c.Departments {
+		if department == "" {
+			return fmt.Errorf("departments: no department for %q", login)
+		}
+		departments[strings.ToLower(login)] = department
+	}
+	c.Departments = departments
+	for _, slug := range c.DepartmentTeams {
+		if slug == "" || strings.Contains(slug, "/") {
+			return fmt.Errorf("department_teams: invalid team slug %q", slug)
+		}
+	}
+	return nil
+}
+
+// departments returns the department of each owner in snap that has
+// one, as "the NAME department" or "team SLUG".
+func (c *ownerSuccessionCheck) departments(snap *Snapshot) map[string]string {
+	ret := make(map[string]string, len(snap.Owners))
+	teamUsers := snap.TeamMembers.Users()
+	for _, login := range snap.Owners {
+		if d, ok := c.Departments[strings.ToLower(login)]; ok {
+			ret[login] = "the " + d + " department"
+			continue
+		}
+		for _, slug := range c.DepartmentTeams {
+			isMember := false
+			for member := range teamUsers[slug] {
+				isMember = isMember || strings.EqualFold(member, login)
+			}
+			if isMember {
+				ret[login] = "team " + slug
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func (c *ownerSuccessionCheck) Evaluate(snap *Snapshot) []Finding {
+	if len(snap.Owners) < c.MinOwners {
+		var msg string
+		switch len(snap.Owners) {
+		case 0:
+			msg = fmt.Sprintf("the org has no owners that this token can see (minimum is %d)", c.MinOwners)
+		case 1:
+			msg = fmt.Sprintf("the org has only 1 owner (%s); the minimum is %d", snap.Owners[0], c.MinOwners)
+		default:
+			msg = fmt.Sprintf("the org has only %d owners (%s); the minimum is %d", len(snap.Owners), strings.Join(snap.Owners, ", "), c.MinOwners)
+		}
+		return []Finding{{Message: msg}}
+	}
+	if (len(c.Departments) == 0 && len(c.DepartmentTeams) == 0) || len(snap.Owners) < 2 {
+		return nil
+	}
+	// An owner with no known department might be in any of them.
+	departments := c.departments(snap)
+	department := ""
+	for _, login := range snap.Owners {
+		d, ok := departments[login]
+		if !ok || (department != "" && d != department) {
+			return nil
+		}
+		department = d
+	}
+	return []Finding{{
+		Message: fmt.Sprintf("all %d of the org's owners (%s) are in %s", len(snap.Owners), strings.Join(snap.Owners, ", "), department),
+	}}
+}
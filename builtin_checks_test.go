@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOwnerSuccessionCheck(t *testing.T) {
+	teams := teamMembership{
+		Members: map[string][]string{
+			"platform": {"Alice"},
+			"sre":      {"bob"},
+			"sales":    {"carol"},
+		},
+		Parents: map[string]string{"sre": "platform"},
+	}
+	testcases := map[string]struct {
+		options string
+		owners  []string
+		want    []string
+	}{
+		"no owners": {
+			options: `{"min_owners": 2}`,
+			want:    []string{"the org has no owners that this token can see (minimum is 2)"},
+		},
+		"one owner": {
+			options: `{"min_owners": 2}`,
+			owners:  []string{"alice"},
+			want:    []string{"the org has only 1 owner (alice); the minimum is 2"},
+		},
+		"too few owners": {
+			options: `{"min_owners": 3}`,
+			owners:  []string{"alice", "bob"},
+			want:    []string{"the org has only 2 owners (alice, bob); the minimum is 3"},
+		},
+		"enough owners": {
+			options: `{"min_owners": 2}`,
+			owners:  []string{"alice", "bob"},
+		},
+		"one department": {
+			options: `{"min_owners": 2, "departments": {"Alice": "eng", "bob": "eng"}}`,
+			owners:  []string{"alice", "bob"},
+			want:    []string{"all 2 of the org's owners (alice, bob) are in the eng department"},
+		},
+		"two departments": {
+			options: `{"min_owners": 2, "departments": {"alice": "eng", "bob": "ops"}}`,
+			owners:  []string{"alice", "bob"},
+		},
+		"owner with no department": {
+			options: `{"min_owners": 2, "departments": {"alice": "eng"}}`,
+			owners:  []string{"alice", "bob"},
+		},
+		"one team, counting its child teams": {
+			options: `{"min_owners": 2, "department_teams": ["platform", "sales"]}`,
+			owners:  []string{"alice", "bob"},
+			want:    []string{"all 2 of the org's owners (alice, bob) are in team platform"},
+		},
+		"the first team that an owner is in": {
+			options: `{"min_owners": 2, "department_teams": ["sre", "platform"]}`,
+			owners:  []string{"alice", "bob"},
+		},
+		"two teams": {
+			options: `{"min_owners": 2, "department_teams": ["platform", "sales"]}`,
+			owners:  []string{"alice", "carol"},
+		},
+		"the map wins over the teams": {
+			options: `{"min_owners": 2, "departments": {"carol": "eng"}, "department_teams": ["platform"]}`,
+			owners:  []string{"alice", "carol"},
+		},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			check := &ownerSuccessionCheck{}
+			if err := check.Configure([]byte(tc.options)); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, finding := range check.Evaluate(&Snapshot{Owners: tc.owners, TeamMembers: teams}) {
+				got = append(got, finding.Message)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
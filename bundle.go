@@ -0,0 +1,343 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A bundle is a recording of every request that a run made to the
+// GitHub API and the response that it got, so that a maintainer can
+// replay a failing run without access to the org or the token.  It is a
+// gzipped tarball of a manifest.json and a requests/NNNN.json per
+// request.  Requests are recorded without their headers, so the token
+// never ends up in a bundle.
+
+// bundleManifest is the manifest.json of a bundle.
+type bundleManifest struct {
+	Version      int       `json:"version"`
+	RecordedAt   time.Time `json:"recordedAt"`
+	Args         []string  `json:"args"`
+	HashedLogins bool      `json:"hashedLogins"`
+}
+
+// recorder is what is recording the run, with --record-bundle.
+var recorder *bundleRecorder
+
+// bundleArgs returns args as they should be recorded in a bundle's
+// manifest: without the flags about recording, and without anything
+// secret.
+func bundleArgs(args []string) []string {
+	var ret []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		switch {
+		case !strings.HasPrefix(arg, "-"):
+		case strings.HasPrefix(name, "record-"):
+			continue
+		case name == "mongo-uri" || name == "token":
+			if !strings.Contains(arg, "=") {
+				i++ // the value is the next argument
+			}
+			arg = "--" + name + "=REDACTED"
+		}
+		ret = append(ret, arg)
+	}
+	return ret
+}
+
+// bundleExchange is a single request and response in a bundle.
+type bundleExchange struct {
+	Method       string      `json:"method"`
+	URI          string      `json:"uri"`
+	RequestBody  string      `json:"requestBody,omitempty"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	ResponseBody string      `json:"responseBody"`
+}
+
+// key identifies which recorded response a request should get when
+// replayed.
+func (e bundleExchange) key() string {
+	return e.Method + " " + e.URI + "\n" + e.RequestBody
+}
+
+// bundleHeaders is the response headers that are worth recording; the
+// rest are noise, and some (like cookies) might be sensitive.
+var bundleHeaders = []string{"Content-Type", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+
+// bundleRecorder is an http.RoundTripper that records each exchange
+// that it passes through to next.
+type bundleRecorder struct {
+	next http.RoundTripper
+
+	mu        sync.Mutex
+	exchanges []bundleExchange
+}
+
+func (r *bundleRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := bundleExchange{Method: req.Method, URI: req.URL.RequestURI()}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		exchange.RequestBody = string(body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		// A network error has no response to replay.
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	exchange.Status = resp.StatusCode
+	exchange.Header = make(http.Header)
+	for _, name := range bundleHeaders {
+		if val := resp.Header.Get(name); val != "" {
+			exchange.Header.Set(name, val)
+		}
+	}
+	exchange.ResponseBody = string(body)
+
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, exchange)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// hashLogin returns a stand-in for a login (or email address) that
+// can't be reversed, but is the same every time.
+func hashLogin(login string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(login)))
+	return "user-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// hashLogins replaces the value of every "login" and "email" key in the
+// JSON value v, other than those in keep, adding what it replaced to
+// seen.
+func hashLogins(v interface{}, keep, seen map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if str, ok := val.(string); ok && str != "" && !keep[str] && (key == "login" || key == "email") {
+				seen[str] = true
+				v[key] = hashLogin(str)
+				continue
+			}
+			hashLogins(val, keep, seen)
+		}
+	case []interface{}:
+		for _, val := range v {
+			hashLogins(val, keep, seen)
+		}
+	}
+}
+
+// hashExchanges hashes the logins in exchanges, so that a bundle can be
+// shared without saying who has access to what.  Logins are hashed in
+// responses, and then wherever those logins appear in requests (as a
+// path segment, or as a GraphQL variable), so that the replayed
+// requests still match the recorded ones.  Logins in keep (the
+// arguments that the run was given, like the org's name) are left
+// alone, since replaying the run will use them as they are.
+func hashExchanges(exchanges []bundleExchange, keep map[string]bool) {
+	seen := make(map[string]bool)
+	for i, exchange := range exchanges {
+		var body interface{}
+		dec := json.NewDecoder(strings.NewReader(exchange.ResponseBody))
+		dec.UseNumber()
+		if err := dec.Decode(&body); err != nil {
+			continue
+		}
+		hashLogins(body, keep, seen)
+		hashed, err := json.Marshal(body)
+		if err != nil {
+			continue
+		}
+		exchanges[i].ResponseBody = string(hashed)
+	}
+	for i, exchange := range exchanges {
+		parts := strings.SplitN(exchange.URI, "?", 2)
+		segments := strings.Split(parts[0], "/")
+		for j, segment := range segments {
+			if seen[segment] {
+				segments[j] = hashLogin(segment)
+			}
+		}
+		parts[0] = strings.Join(segments, "/")
+		exchanges[i].URI = strings.Join(parts, "?")
+
+		var req graphqlRequest
+		if err := json.Unmarshal([]byte(exchange.RequestBody), &req); err != nil || req.Variables == nil {
+			continue
+		}
+		for name, val := range req.Variables {
+			if str, ok := val.(string); ok && seen[str] {
+				req.Variables[name] = hashLogin(str)
+			}
+		}
+		hashed, err := json.Marshal(req)
+		if err != nil {
+			continue
+		}
+		exchanges[i].RequestBody = string(hashed)
+	}
+}
+
+// Save writes what r has recorded to a bundle at filename.
+func (r *bundleRecorder) Save(filename string, args []string, hashed bool) error {
+	r.mu.Lock()
+	exchanges := append([]bundleExchange(nil), r.exchanges...)
+	r.mu.Unlock()
+	if hashed {
+		keep := make(map[string]bool)
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				keep[arg] = true
+			}
+		}
+		hashExchanges(exchanges, keep)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	add := func(name string, v interface{}) error {
+		content, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: time.Now()}); err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	}
+	manifest := bundleManifest{Version: 1, RecordedAt: time.Now().UTC(), Args: args, HashedLogins: hashed}
+	if err := add("manifest.json", manifest); err != nil {
+		return err
+	}
+	for i, exchange := range exchanges {
+		if err := add(fmt.Sprintf("requests/%04d.json", i+1), exchange); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0o600)
+}
+
+// errNotRecorded is returned when replaying a bundle, for a request
+// that the bundle doesn't have a response for.
+var errNotRecorded = errors.New("no recorded response for this request")
+
+// bundleReplayer is an http.RoundTripper that answers requests from a
+// bundle.  Identical requests get the responses that they got when
+// recorded, in the same order.
+type bundleReplayer struct {
+	mu        sync.Mutex
+	responses map[string][]bundleExchange
+}
+
+// loadBundle reads a bundle from filename.
+func loadBundle(filename string) (*bundleReplayer, bundleManifest, error) {
+	var manifest bundleManifest
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, manifest, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, manifest, fmt.Errorf("%s: %w", filename, err)
+	}
+	tr := tar.NewReader(zr)
+	r := &bundleReplayer{responses: make(map[string][]bundleExchange)}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, manifest, fmt.Errorf("%s: %w", filename, err)
+		}
+		dec := json.NewDecoder(tr)
+		switch {
+		case hdr.Name == "manifest.json":
+			err = dec.Decode(&manifest)
+		case strings.HasPrefix(hdr.Name, "requests/"):
+			var exchange bundleExchange
+			if err = dec.Decode(&exchange); err == nil {
+				r.responses[exchange.key()] = append(r.responses[exchange.key()], exchange)
+			}
+		}
+		if err != nil {
+			return nil, manifest, fmt.Errorf("%s: %s: %w", filename, hdr.Name, err)
+		}
+	}
+	if manifest.Version != 1 {
+		return nil, manifest, fmt.Errorf("%s: not a bundle, or from an incompatible version", filename)
+	}
+	return r, manifest, nil
+}
+
+func (r *bundleReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := bundleExchange{Method: req.Method, URI: req.URL.RequestURI()}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		exchange.RequestBody = string(body)
+	}
+	key := exchange.key()
+	r.mu.Lock()
+	queue := r.responses[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%s %s: %w", req.Method, exchange.URI, errNotRecorded)
+	}
+	recorded := queue[0]
+	if len(queue) > 1 {
+		// Leave the last response for any further repeats.
+		r.responses[key] = queue[1:]
+	}
+	r.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.ResponseBody)),
+		ContentLength: int64(len(recorded.ResponseBody)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// A Campaign is an access review: the grants on a set of repos at the
+// time it was opened, who has been asked to review each of them, and
+// what they decided.  It is kept in a JSON file, which each of the
+// campaign subcommand's actions reads and (except for status) updates.
+type Campaign struct {
+	Org      string          `json:"org"`
+	OpenedAt time.Time       `json:"openedAt"`
+	ClosedAt *time.Time      `json:"closedAt,omitempty"`
+	Items    []*CampaignItem `json:"items"`
+}
+
+// A CampaignItem is a single grant under review.
+type CampaignItem struct {
+	Repo       string     `json:"repo"`
+	URL        string     `json:"url"`
+	Principal  Principal  `json:"principal"`
+	Permission Permission `json:"permission"`
+	// Reviewers is the logins of the maintainers of the teams that
+	// own (have ADMIN on) the repo.  It may be empty, if no team does.
+	Reviewers []string `json:"reviewers"`
+
+	// Decision is "keep", "remove", or empty if nobody has responded
+	// yet.
+	Decision  string     `json:"decision,omitempty"`
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+	Note      string     `json:"note,omitempty"`
+}
+
+func loadCampaign(filename string) (*Campaign, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("campaign: %w", err)
+	}
+	var c Campaign
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return nil, fmt.Errorf("campaign: %s: %w", filename, err)
+	}
+	return &c, nil
+}
+
+func (c *Campaign) Save(filename string) error {
+	bs, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("campaign: %w", err)
+	}
+	// Write-then-rename, as with checkpoints, so that a failed write
+	// can't lose the responses recorded so far.
+	if err := ioutil.WriteFile(filename+".tmp", append(bs, '\n'), 0o644); err != nil {
+		return fmt.Errorf("campaign: %w", err)
+	}
+	if err := os.Rename(filename+".tmp", filename); err != nil {
+		return fmt.Errorf("campaign: %w", err)
+	}
+	return nil
+}
+
+// Pending returns how many items nobody has responded to yet.
+func (c *Campaign) Pending() int {
+	n := 0
+	for _, item := range c.Items {
+		if item.Decision == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// teamSlug returns the slug of a team, given its full
+// "parentteam/subteam" name.
+func teamSlug(fullname string) string {
+	return fullname[strings.LastIndex(fullname, "/")+1:]
+}
+
+// getTeamMaintainers returns the logins of the maintainers of every
+// team in an organization, keyed by team slug.  Only the first 100
+// maintainers of each team are returned.
+func getTeamMaintainers(ctx context.Context, orgname string) (map[string][]string, error) {
+	query := `
+query getTeamMaintainers($orgname: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    teams(first: $pageSize, after: $cursor) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        slug
+        members(role: MAINTAINER, first: 100) {
+          nodes {
+            login
+          }
+        }
+      }
+    }
+  }
+}`
+	var rawTeams struct {
+		Organization struct {
+			Teams struct {
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+				Nodes []struct {
+					Slug    string
+					Members struct {
+						Nodes []struct {
+							Login string
+						}
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+	}
+	ret := make(map[string][]string)
+	for args["cursor"] == nil || rawTeams.Organization.Teams.PageInfo.HasNextPage {
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawTeams, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, fmt.Errorf("getTeamMaintainers: %w", err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawTeams.Organization.Teams.PageInfo.EndCursor
+
+		for _, team := range rawTeams.Organization.Teams.Nodes {
+			var logins []string
+			for _, member := range team.Members.Nodes {
+				logins = append(logins, member.Login)
+			}
+			ret[team.Slug] = logins
+		}
+	}
+	return ret, nil
+}
+
+// openCampaign creates a Campaign for the team and user grants in
+// results, assigning each repo's grants to the maintainers of the teams
+// that have ADMIN on it.  The org's own grant is left out, since its
+// base permission can't be removed from a single repo.
+func openCampaign(orgname string, results []RepoReport, maintainers map[string][]string) *Campaign {
+	c := &Campaign{
+		Org:      orgname,
+		OpenedAt: time.Now().UTC(),
+		Items:    []*CampaignItem{},
+	}
+	for _, result := range results {
+		reviewerSet := make(map[string]bool)
+		for principal, perm := range result.Collaborators {
+			if principal.Kind == KindTeam && perm == PermADMIN {
+				for _, login := range maintainers[teamSlug(principal.Name)] {
+					reviewerSet[login] = true
+				}
+			}
+		}
+		reviewers := []string{}
+		for login := range reviewerSet {
+			reviewers = append(reviewers, login)
+		}
+		sort.Strings(reviewers)
+
+		for _, principal := range sortedPrincipals(result.Collaborators) {
+			if principal.Kind == KindOrg {
+				continue
+			}
+			c.Items = append(c.Items, &CampaignItem{
+				Repo:       result.Repo.Name,
+				URL:        result.Repo.URL,
+				Principal:  principal,
+				Permission: result.Collaborators[principal],
+				Reviewers:  reviewers,
+			})
+		}
+	}
+	sort.SliceStable(c.Items, func(i, j int) bool { return c.Items[i].Repo < c.Items[j].Repo })
+	return c
+}
+
+// writeCampaignStatus writes a table of every item in the campaign and
+// what was decided about it.
+func writeCampaignStatus(w io.Writer, c *Campaign) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Repository\t| Grant\t| Permission\t| Reviewers\t| Decision\t| Decided by\t| Note\n")
+	fmt.Fprintf(output, "----------\t| -----\t| ----------\t| ---------\t| --------\t| ----------\t| ----\n")
+	for _, item := range c.Items {
+		reviewers := strings.Join(item.Reviewers, " ")
+		if reviewers == "" {
+			reviewers = "(unassigned)"
+		}
+		decision := item.Decision
+		if decision == "" {
+			decision = "pending"
+		}
+		fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\t| %s\t| %s\t| %s\n",
+			item.Repo, item.Principal, item.Permission, reviewers, decision, item.DecidedBy, item.Note)
+	}
+	output.Flush()
+}
+
+// writeApplyPlan writes a shell script that removes every grant that
+// the campaign decided to remove.
+func writeApplyPlan(w io.Writer, c *Campaign) {
+	fmt.Fprintf(w, "#!/bin/sh\n")
+	fmt.Fprintf(w, "# Removals approved by the %s access review opened %s.\n", c.Org, formatDate(c.OpenedAt))
+	fmt.Fprintf(w, "# Review it, then run it with a token that can administer the repositories.\n")
+	fmt.Fprintf(w, "set -e\n")
+	gh := "gh api"
+	if host := apiHostname(); host != "" {
+		gh += " --hostname " + host
+	}
+	for _, item := range c.Items {
+		if item.Decision != "remove" {
+			continue
+		}
+		fmt.Fprintf(w, "\n# %s: %s (%s), removal approved by %s", item.URL, item.Principal, item.Permission, item.DecidedBy)
+		if item.Note != "" {
+			// Keep a multi-line note inside the comment.
+			fmt.Fprintf(w, ": %s", strings.Join(strings.Fields(item.Note), " "))
+		}
+		fmt.Fprintf(w, "\n")
+		switch item.Principal.Kind {
+		case KindTeam:
+			fmt.Fprintf(w, "%s -X DELETE /orgs/%s/teams/%s/repos/%s/%s\n", gh, c.Org, teamSlug(item.Principal.Name), c.Org, item.Repo)
+		case KindUser:
+			fmt.Fprintf(w, "%s -X DELETE /repos/%s/%s/collaborators/%s\n", gh, c.Org, item.Repo, item.Principal.Name)
+		}
+	}
+}
+
+var campaignCommand = &command{
+	Name:    "campaign",
+	Args:    []string{"ACTION", "FILE", "[ORGNAME]"},
+	Summary: "Run an access review campaign, from assigning reviewers to a plan of approved removals",
+	Description: `
+Runs a periodic access review of the team and user grants on the
+organization's repositories.  The campaign is kept in the JSON file
+FILE, which is what gets passed around (or committed somewhere) while
+the review is under way.  ACTION is one of:
+
+open: Collect the grants on the organization's repositories (narrowed
+with --repos and --filter, as for the main report) and write a new
+campaign to FILE.  Each repository's grants are assigned to the
+maintainers of the teams that have ADMIN on it; repositories that no
+team owns are left unassigned.  Needs ORGNAME.
+
+respond: Record a reviewer's decision, "keep" or "remove", about the
+grant --grant on repository --repo.
+
+status: List every grant in the campaign, and who decided what about
+it.
+
+close: Close the campaign, so that no more responses can be recorded,
+and print a shell script that removes every grant that was decided to
+be removed.  Grants that nobody responded to are kept.
+
+The organization's own grant (its base permission) is not reviewed,
+since it can't be removed from a single repository.`,
+	Examples: []example{
+		{"Open a review of the datawire organization's repositories.", progName + " campaign open review-2026q4.json datawire"},
+		{"Record that a user's access to a repository should be removed.",
+			progName + " campaign --repo=api --grant=user:carol --decision=remove --reviewer=alice --note='left the project' respond review-2026q4.json"},
+		{"See which grants are still waiting for a decision.", progName + " campaign status review-2026q4.json"},
+		{"Close the review and write the removals to a script.", progName + " campaign close review-2026q4.json > apply.sh"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		var repos commaList
+		fs.Var(&repos, "repos", "open: comma-separated list of repositories to review (default all)")
+		filter := fs.String("filter", "", "open: only review grants for which this `expression` is true; see 'help report'")
+		repo := fs.String("repo", "", "respond: the `name` of the repository")
+		grant := fs.String("grant", "", "respond: the grant, as `KIND:NAME` (for example user:carol or team:eng/dev)")
+		decision := fs.String("decision", "", "respond: 'keep' or 'remove'")
+		reviewer := fs.String("reviewer", "", "respond: the `login` of whoever made the decision")
+		note := fs.String("note", "", "respond: why the decision was made")
+		return func(ctx context.Context, args []string) error {
+			action, filename := args[0], args[1]
+			if action != "open" && len(args) > 2 {
+				return usageErrorf("campaign %s: unexpected argument %q", action, args[2])
+			}
+			switch action {
+			case "open":
+				if len(args) < 3 {
+					return usageErrorf("campaign open: expected argument ORGNAME")
+				}
+				orgname := args[2]
+				var f *grantFilter
+				if *filter != "" {
+					var err error
+					if f, err = parseGrantFilter(*filter); err != nil {
+						return usageError{err: err}
+					}
+				}
+				if _, err := os.Stat(filename); err == nil {
+					return fmt.Errorf("campaign: %s already exists; not overwriting it", filename)
+				}
+				if err := requireToken(ctx); err != nil {
+					return err
+				}
+
+				results, _, invisible, err := collect(ctx, orgname, Options{})
+				if err != nil {
+					// A campaign that only covers some of the
+					// repos would look like a complete review.
+					return err
+				}
+				if len(repos) > 0 {
+					want := make(map[string]bool)
+					for _, name := range repos {
+						want[name] = true
+					}
+					var kept []RepoReport
+					for _, result := range results {
+						if want[result.Repo.Name] {
+							kept = append(kept, result)
+							delete(want, result.Repo.Name)
+						}
+					}
+					if len(want) > 0 {
+						var missing []string
+						for name := range want {
+							missing = append(missing, name)
+						}
+						sort.Strings(missing)
+						return fmt.Errorf("campaign: no such repositories in %q: %s", orgname, strings.Join(missing, ", "))
+					}
+					results = kept
+				}
+				if f != nil {
+					if results, err = f.Apply(results); err != nil {
+						return err
+					}
+				}
+				maintainers, err := getTeamMaintainers(ctx, orgname)
+				if err != nil {
+					return err
+				}
+
+				c := openCampaign(orgname, results, maintainers)
+				if err := c.Save(filename); err != nil {
+					return err
+				}
+				unassigned := make(map[string]bool)
+				for _, item := range c.Items {
+					if len(item.Reviewers) == 0 {
+						unassigned[item.Repo] = true
+					}
+				}
+				fmt.Fprintf(os.Stderr, "opened campaign %q: %d grants in %d repositories\n", filename, len(c.Items), len(results))
+				if len(unassigned) > 0 {
+					fmt.Fprintf(os.Stderr, "warning: %d repositories have no team with ADMIN on them, so nobody has been assigned to review them\n", len(unassigned))
+				}
+				printCoverage(orgname, invisible)
+				return nil
+
+			case "respond":
+				if *repo == "" || *grant == "" || *reviewer == "" {
+					return usageErrorf("campaign respond: --repo, --grant, and --reviewer are required")
+				}
+				if *decision != "keep" && *decision != "remove" {
+					return usageErrorf("campaign respond: invalid --decision %q (must be 'keep' or 'remove')", *decision)
+				}
+				principal, err := parsePrincipal(*grant)
+				if err != nil {
+					return usageError{err: err}
+				}
+				c, err := loadCampaign(filename)
+				if err != nil {
+					return err
+				}
+				if c.ClosedAt != nil {
+					return fmt.Errorf("campaign: %s was closed on %s", filename, formatDate(*c.ClosedAt))
+				}
+				var item *CampaignItem
+				for _, candidate := range c.Items {
+					if candidate.Repo == *repo && candidate.Principal.Kind == principal.Kind && candidate.Principal.Name == principal.Name {
+						item = candidate
+					}
+				}
+				if item == nil {
+					return fmt.Errorf("campaign: %s has no grant to %s on %q", filename, principal, *repo)
+				}
+				assigned := false
+				for _, login := range item.Reviewers {
+					if login == *reviewer {
+						assigned = true
+					}
+				}
+				if !assigned {
+					fmt.Fprintf(os.Stderr, "warning: %s is not one of the assigned reviewers of %q\n", *reviewer, *repo)
+				}
+				if item.Decision != "" {
+					fmt.Fprintf(os.Stderr, "replacing %s's earlier decision (%s)\n", item.DecidedBy, item.Decision)
+				}
+				now := time.Now().UTC()
+				item.Decision, item.DecidedBy, item.DecidedAt, item.Note = *decision, *reviewer, &now, *note
+				if err := c.Save(filename); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "recorded: %s on %q: %s (%d grants still pending)\n", principal, *repo, *decision, c.Pending())
+				return nil
+
+			case "status":
+				c, err := loadCampaign(filename)
+				if err != nil {
+					return err
+				}
+				writeCampaignStatus(os.Stdout, c)
+				state := "open"
+				if c.ClosedAt != nil {
+					state = "closed " + formatDate(*c.ClosedAt)
+				}
+				fmt.Fprintf(os.Stderr, "campaign for %q opened %s (%s): %d of %d grants pending\n",
+					c.Org, formatDate(c.OpenedAt), state, c.Pending(), len(c.Items))
+				return nil
+
+			case "close":
+				c, err := loadCampaign(filename)
+				if err != nil {
+					return err
+				}
+				if c.ClosedAt != nil {
+					return fmt.Errorf("campaign: %s was already closed on %s", filename, formatDate(*c.ClosedAt))
+				}
+				now := time.Now().UTC()
+				c.ClosedAt = &now
+				if err := c.Save(filename); err != nil {
+					return err
+				}
+				writeApplyPlan(os.Stdout, c)
+				if pending := c.Pending(); pending > 0 {
+					fmt.Fprintf(os.Stderr, "warning: %d grants were never reviewed, and are being kept\n", pending)
+				}
+				return nil
+
+			default:
+				return usageErrorf("campaign: invalid ACTION %q (must be 'open', 'respond', 'status', or 'close')", action)
+			}
+		}
+	},
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// A checkpoint records the collaborators of the repos that have been
+// inspected so far, so that an interrupted run can pick up where it
+// left off instead of starting over.
+type checkpoint struct {
+	Org   string                       `json:"org"`
+	Repos map[string][]checkpointGrant `json:"repos"`
+	// Approvers is the deployment approvers of each repo in Repos,
+	// if they are being collected.
+	Approvers map[string][]checkpointApprover `json:"approvers,omitempty"`
+	// Users is everyone with access to each repo in Repos, if they
+	// are being kept.
+	Users map[string][]checkpointUser `json:"users,omitempty"`
+}
+
+type checkpointGrant struct {
+	Principal
+	Permission Permission `json:"permission"`
+}
+
+type checkpointApprover struct {
+	Principal
+	Environments []string `json:"environments"`
+}
+
+type checkpointUser struct {
+	Login      string            `json:"login"`
+	Permission Permission        `json:"permission"`
+	Sources    []checkpointGrant `json:"sources"`
+}
+
+// loadCheckpoint reads the checkpoint file at filename.  If the file
+// doesn't exist, that's not an error; it returns an empty checkpoint.
+func loadCheckpoint(filename, orgname string) (*checkpoint, error) {
+	cp := &checkpoint{
+		Org:   orgname,
+		Repos: make(map[string][]checkpointGrant),
+	}
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cp, nil
+		}
+		return nil, fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(bs, cp); err != nil {
+		return nil, fmt.Errorf("checkpoint: %s: %w", filename, err)
+	}
+	if cp.Org != orgname {
+		return nil, fmt.Errorf("checkpoint: %s is for organization %q, not %q", filename, cp.Org, orgname)
+	}
+	return cp, nil
+}
+
+// Get returns the collaborators (and deployment approvers and users,
+// if they were recorded) recorded for a repo.  It is safe to call on a
+// nil checkpoint, which has no repos recorded.
+func (cp *checkpoint) Get(reponame string) (collaborators map[Principal]Permission, approvers map[Principal][]string, users []repoUser, ok bool) {
+	if cp == nil {
+		return nil, nil, nil, false
+	}
+	grants, ok := cp.Repos[reponame]
+	if !ok {
+		return nil, nil, nil, false
+	}
+	collaborators = make(map[Principal]Permission, len(grants))
+	for _, grant := range grants {
+		collaborators[grant.Principal] = grant.Permission
+	}
+	if rawApprovers, ok := cp.Approvers[reponame]; ok {
+		approvers = make(map[Principal][]string, len(rawApprovers))
+		for _, approver := range rawApprovers {
+			approvers[approver.Principal] = approver.Environments
+		}
+	}
+	if rawUsers, ok := cp.Users[reponame]; ok {
+		users = make([]repoUser, 0, len(rawUsers))
+		for _, rawUser := range rawUsers {
+			user := repoUser{Login: rawUser.Login, Permission: rawUser.Permission}
+			for _, source := range rawUser.Sources {
+				user.Sources = append(user.Sources, permissionSource{Principal: source.Principal, Permission: source.Permission})
+			}
+			users = append(users, user)
+		}
+	}
+	return collaborators, approvers, users, true
+}
+
+// Put records the collaborators, deployment approvers, and users (either
+// of which may be nil, if they aren't being collected) of a repo.  It
+// is a no-op on a nil checkpoint.
+func (cp *checkpoint) Put(reponame string, collaborators map[Principal]Permission, approvers map[Principal][]string, users []repoUser) {
+	if cp == nil {
+		return
+	}
+	grants := make([]checkpointGrant, 0, len(collaborators))
+	for principal, permission := range collaborators {
+		grants = append(grants, checkpointGrant{Principal: principal, Permission: permission})
+	}
+	cp.Repos[reponame] = grants
+	if approvers != nil {
+		if cp.Approvers == nil {
+			cp.Approvers = make(map[string][]checkpointApprover)
+		}
+		rawApprovers := make([]checkpointApprover, 0, len(approvers))
+		for principal, envs := range approvers {
+			rawApprovers = append(rawApprovers, checkpointApprover{Principal: principal, Environments: envs})
+		}
+		cp.Approvers[reponame] = rawApprovers
+	}
+	if users != nil {
+		if cp.Users == nil {
+			cp.Users = make(map[string][]checkpointUser)
+		}
+		rawUsers := make([]checkpointUser, 0, len(users))
+		for _, user := range users {
+			rawUser := checkpointUser{Login: user.Login, Permission: user.Permission, Sources: []checkpointGrant{}}
+			for _, source := range user.Sources {
+				rawUser.Sources = append(rawUser.Sources, checkpointGrant{Principal: source.Principal, Permission: source.Permission})
+			}
+			rawUsers = append(rawUsers, rawUser)
+		}
+		cp.Users[reponame] = rawUsers
+	}
+}
+
+func (cp *checkpoint) Save(filename string) error {
+	bs, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	// Write-then-rename so that getting interrupted again while
+	// saving doesn't clobber the previous checkpoint.
+	if err := ioutil.WriteFile(filename+".tmp", bs, 0o644); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := os.Rename(filename+".tmp", filename); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is how much a Finding matters.
+type Severity int
+
+// The severities are in order of increasing importance.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if string(text) == name {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid severity %q (valid severities are %s)", text, strings.Join(severityNames, ", "))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// errFindings is returned by the check command if it found something
+// at or above --fail-on's severity.
+var errFindings = errors.New("findings at or above --fail-on")
+
+// Snapshot is everything that was collected about an organization, for
+// checks to evaluate.
+type Snapshot struct {
+	Org   string
+	Repos []RepoReport
+	// Members is the logins of the org's members, and Owners those
+	// of its owners, sorted.
+	Members map[string]bool
+	Owners  []string
+	// Teams is every team in the org, sorted by full name.
+	Teams []Team
+	// Suspended maps the logins of suspended users to when they were
+	// suspended.  It is only collected with --suspended-users.
+	Suspended map[string]time.Time
+	// Users has the company and verified emails of the org's members
+	// and directly-granted users.  It is only collected with
+	// --user-details.
+	Users map[string]userDetails
+	// TeamMembers is who gets each team's grants.  It is only
+	// collected with --user-details, or for a teamMembershipCheck
+	// that needs it.
+	TeamMembers teamMembership
+}
+
+// A Finding is a single problem that a Check found.
+type Finding struct {
+	Check    string
+	Severity Severity
+	// Repo is the repo that the finding is about, if it is about a
+	// particular repo.
+	Repo string
+	// Principal is who the finding is about, if it is about a
+	// particular grant.
+	Principal Principal
+	Message   string
+}
+
+// A Check is an audit rule.  Adding a built-in rule means writing a
+// Check and adding it to builtinChecks; nothing else needs to know
+// about it.  Users can also add their own in Starlark, without
+// rebuilding; see starlarkCheck.
+type Check interface {
+	// Name is how the check is referred to in the config file and
+	// in findings.
+	Name() string
+	Description() string
+	// DefaultSeverity is the severity of the check's findings, unless
+	// the config file says otherwise.
+	DefaultSeverity() Severity
+	// Evaluate returns the check's findings for snap.  The runner
+	// fills in each Finding's Check and Severity.
+	Evaluate(snap *Snapshot) []Finding
+}
+
+// A configurableCheck is a Check that takes options from the config
+// file.
+type configurableCheck interface {
+	Check
+	// Configure is called with the check's "options" from the config
+	// file, if it has any, before Evaluate.
+	Configure(options json.RawMessage) error
+}
+
+// A teamMembershipCheck is a Check that may need Snapshot.TeamMembers
+// even without --user-details.
+type teamMembershipCheck interface {
+	Check
+	// NeedsTeamMembership is called after Configure.
+	NeedsTeamMembership() bool
+}
+
+// A controlledCheck is a Check that assesses compliance with security
+// controls, identified by their NIST SP 800-53 control IDs (like
+// "ac-6.5"); see writeOSCAL.
+type controlledCheck interface {
+	Check
+	// Controls is the IDs of the controls that the check assesses,
+	// unless the config file says otherwise.
+	Controls() []string
+}
+
+// builtinChecks is every built-in check, in the order that they are
+// listed in help text and run in.
+var builtinChecks = []Check{
+	&directUserGrantsCheck{},
+	&directUserAdminCheck{},
+	&outsideCollaboratorPermissionCheck{Max: PermREAD},
+	&botAdminCheck{},
+	&publicRepoLicenseCheck{Allowed: osiLicenses},
+	&requiredTeamAccessCheck{},
+	&repoSettingsCheck{},
+	&secretTeamAccessCheck{Max: PermMAINTAIN},
+	&suspendedUserCheck{},
+	&verifiedEmailCheck{Max: PermREAD},
+	&ownerSuccessionCheck{MinOwners: 2},
+}
+
+// Config is the config file.
+type Config struct {
+	// Starlark is a list of files containing user-defined checks;
+	// see starlarkCheck.  Relative paths are relative to the
+	// config file.
+	Starlark []string `json:"starlark"`
+
+	// Checks configures checks by name, including user-defined
+	// ones; checks that aren't mentioned are enabled with their
+	// default severity and options.
+	Checks map[string]CheckConfig `json:"checks"`
+
+	// userChecks is the checks loaded from the Starlark files.
+	userChecks []Check
+}
+
+// allChecks returns the built-in checks followed by the user-defined
+// ones.
+func (cfg Config) allChecks() []Check {
+	return append(append([]Check(nil), builtinChecks...), cfg.userChecks...)
+}
+
+// CheckConfig is the configuration of a single check.
+type CheckConfig struct {
+	Enabled  *bool           `json:"enabled"`
+	Severity *Severity       `json:"severity"`
+	Options  json.RawMessage `json:"options"`
+	Controls []string        `json:"controls"`
+}
+
+// readConfigFile decodes the JSON file at filename in to v, rejecting
+// unknown fields.  If its name ends in .yaml or .yml, it is YAML
+// instead.
+func readConfigFile(filename string, v interface{}) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if ext := strings.ToLower(filepath.Ext(filename)); ext == ".yaml" || ext == ".yml" {
+		// Convert it to JSON, so that it is checked and decoded
+		// exactly as a JSON file would be.
+		var doc interface{}
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if content, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// loadConfig reads the config file at filename; an empty filename
+// means the default config.  It is JSON, or if its name ends in .yaml
+// or .yml, the same thing in YAML.
+func loadConfig(filename string) (Config, error) {
+	var cfg Config
+	if filename == "" {
+		return cfg, nil
+	}
+	if err := readConfigFile(filename, &cfg); err != nil {
+		return cfg, err
+	}
+	names := make(map[string]bool)
+	for _, check := range builtinChecks {
+		names[check.Name()] = true
+	}
+	for _, starlarkFile := range cfg.Starlark {
+		if !filepath.IsAbs(starlarkFile) {
+			starlarkFile = filepath.Join(filepath.Dir(filename), starlarkFile)
+		}
+		check, err := loadStarlarkCheck(starlarkFile)
+		if err != nil {
+			return cfg, err
+		}
+		if names[check.Name()] {
+			return cfg, fmt.Errorf("%s: there is already a check named %q", starlarkFile, check.Name())
+		}
+		names[check.Name()] = true
+		cfg.userChecks = append(cfg.userChecks, check)
+	}
+	for name := range cfg.Checks {
+		if !names[name] {
+			return cfg, fmt.Errorf("%s: unknown check %q", filename, name)
+		}
+	}
+	return cfg, nil
+}
+
+// enabledCheck is a Check along with the severity and controls that it
+// has been configured to have.
+type enabledCheck struct {
+	Check
+	Severity Severity
+	Controls []string
+}
+
+// enabledChecks returns the checks that cfg enables, having applied
+// their options.
+func (cfg Config) enabledChecks() ([]enabledCheck, error) {
+	var ret []enabledCheck
+	for _, check := range cfg.allChecks() {
+		checkCfg := cfg.Checks[check.Name()]
+		if checkCfg.Enabled != nil && !*checkCfg.Enabled {
+			continue
+		}
+		severity := check.DefaultSeverity()
+		if checkCfg.Severity != nil {
+			severity = *checkCfg.Severity
+		}
+		if len(checkCfg.Options) > 0 {
+			configurable, ok := check.(configurableCheck)
+			if !ok {
+				return nil, fmt.Errorf("check %q does not take any options", check.Name())
+			}
+			if err := configurable.Configure(checkCfg.Options); err != nil {
+				return nil, fmt.Errorf("check %q: %w", check.Name(), err)
+			}
+		}
+		controls := checkCfg.Controls
+		if controlled, ok := check.(controlledCheck); ok && controls == nil {
+			controls = controlled.Controls()
+		}
+		ret = append(ret, enabledCheck{Check: check, Severity: severity, Controls: controls})
+	}
+	return ret, nil
+}
+
+// runChecks evaluates each of checks against snap, and returns the
+// findings most severe first.  Findings of the same severity are in
+// the order of checks, then sorted by repo and principal, so that the
+// same state always produces the same list.
+func runChecks(checks []enabledCheck, snap *Snapshot) []Finding {
+	var ret []Finding
+	order := make(map[string]int)
+	for i, check := range checks {
+		order[check.Name()] = i
+		for _, finding := range check.Evaluate(snap) {
+			finding.Check = check.Name()
+			finding.Severity = check.Severity
+			ret = append(ret, finding)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		switch {
+		case a.Severity != b.Severity:
+			return a.Severity > b.Severity
+		case a.Check != b.Check:
+			return order[a.Check] < order[b.Check]
+		case a.Repo != b.Repo:
+			return a.Repo < b.Repo
+		default:
+			return a.Principal.String() < b.Principal.String()
+		}
+	})
+	return ret
+}
+
+// writeFindings writes findings as a table.
+func writeFindings(w io.Writer, findings []Finding) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Severity\t| Check\t| Repository\t| Principal\t| Message\n")
+	fmt.Fprintf(output, "--------\t| -----\t| ----------\t| ---------\t| -------\n")
+	for _, finding := range findings {
+		principal := ""
+		if finding.Principal != (Principal{}) {
+			principal = finding.Principal.String()
+		}
+		fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\t| %s\n",
+			finding.Severity, finding.Check, finding.Repo, principal, finding.Message)
+	}
+	output.Flush()
+}
+
+var checkCommand = &command{
+	Name:    "check",
+	Args:    []string{"[ORGNAME]"},
+	Summary: "Check the organization's access grants against audit rules",
+	Description: `
+Collects the same data as the main report, then evaluates a set of
+audit rules ("checks") against it and lists what they find, most
+severe first.  Use --list to see the available checks (ORGNAME isn't
+needed for that).
+
+Every check is enabled by default.  A JSON (or, if its name ends in
+.yaml or .yml, YAML) config file given with --config can disable
+checks, change their severity, and set their options, and can add
+user-defined checks written in Starlark (a dialect of Python):
+
+    {
+      "starlark": ["checks/no-contractor-write.star"],
+      "checks": {
+        "direct-user-grants": {"enabled": false},
+        "outside-collaborator-permission": {
+          "severity": "error",
+          "options": {"max": "TRIAGE"}
+        }
+      }
+    }
+
+With --fail-on=SEVERITY, the command exits with status 4 if anything
+of that severity or above was found, so that it can be used as a
+permissions gate in CI.  For instance, with this policy.yaml,
+"check --config=policy.yaml --fail-on=error" fails if any repository
+has a user granted access directly, has an outside collaborator
+above READ, doesn't give the platform team ADMIN, or lets its default
+branch be changed without an approved pull request:
+
+    checks:
+      direct-user-grants: {severity: error}
+      outside-collaborator-permission:
+        severity: error
+        options: {max: READ}
+      required-team-access:
+        options:
+          teams: {platform: ADMIN}
+      repo-settings:
+        severity: error
+        options: {min_approvals: 1}
+
+A Starlark check sets "name" (and optionally "description" and
+"severity"), and defines an evaluate(snapshot) or
+evaluate(snapshot, options) function that returns a list of findings,
+each a dict with "message" and optionally "repo" and "principal"
+("KIND:NAME").  snapshot has .org, .members (a list of logins),
+.owners (likewise), .teams, .suspended, .users, and .repos; each team
+has .name, .slug,
+and .secret, .suspended is a list of the logins of suspended users
+(only collected with --suspended-users), .users maps the logins of
+members and directly-granted users to their .company and
+.verified_emails (only collected with --user-details), and each repo
+has .name, .url, .visibility, .license,
+.is_archived, .settings, .grants, and .deployment_approvers.
+.settings has .has_issues, .merge_methods, .default_branch,
+.protected, .allows_force_pushes, .allows_deletions,
+.requires_linear_history, and .required_approvals (-1 if pull
+requests aren't required); each grant has .kind, .name, .permission,
+and .level (the permission as a number), and each deployment approver
+has .kind, .name, and .environments.  Deployment approvers are only
+collected with --deployment-approvers.  A script that fails is
+reported as a finding of its own.
+
+Each check can be mapped to the NIST SP 800-53 controls that it
+assesses, with "controls" in its config (like "controls": ["ac-6.5"]);
+the built-in checks have sensible defaults, which --list shows.  With
+--format=oscal, the results are written as an OSCAL assessment results
+document, for compliance tooling: each finding is an observation, and
+each control is a finding that is "not-satisfied" if any of its
+checks found something of warning severity or above.  OSCAL requires
+the document to refer to an assessment plan; give its href with
+--oscal-plan.`,
+	Examples: []example{
+		{"Run every check against the datawire organization.", progName + " check datawire"},
+		{"List the checks that a config file enables.", progName + " check --config=audit.json --list"},
+		{"Fail a CI job if the org breaks the policy in policy.yaml.", progName + " check --config=policy.yaml --fail-on=error datawire"},
+		{"Write the results for compliance tooling.", progName + " check --format=oscal --oscal-plan=assessment-plan.json datawire > assessment-results.json"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		configFile := fs.String("config", "", "JSON `file` that enables, disables, and configures checks")
+		list := fs.Bool("list", false, "list the checks that would be run, rather than running them")
+		format := fs.String("format", "table", "output format: 'table', or 'oscal' (an OSCAL assessment results document)")
+		oscalPlan := fs.String("oscal-plan", "", "with --format=oscal, the `href` of the OSCAL assessment plan that the results are for")
+		failOn := fs.String("fail-on", "", "exit with status 4 if there are any findings of this `severity` (info, warning, or error) or above, as a CI gate")
+		var opts Options
+		fs.BoolVar(&opts.DeploymentApprovers, "deployment-approvers", false, "also collect the required reviewers of each repository's deployment environments")
+		fs.BoolVar(&opts.IncludeArchived, "include-archived", false, "also check archived repositories")
+		userDetails := fs.Bool("user-details", false, "also get the company and verified-domain emails of each member and directly-granted user (one query per 50 users; needs an org owner's token)")
+		suspendedUsers := fs.Bool("suspended-users", false, "on GitHub Enterprise Server, also find out which members and directly-granted users are suspended (one request per user)")
+		return func(ctx context.Context, args []string) error {
+			switch *format {
+			case "table":
+			case "oscal":
+				if *oscalPlan == "" && !*list {
+					return usageErrorf("check: --format=oscal needs --oscal-plan")
+				}
+			default:
+				return usageErrorf("check: invalid --format %q (must be 'table' or 'oscal')", *format)
+			}
+			if *suspendedUsers && apiHostname() == "" {
+				return usageErrorf("check: --suspended-users only works with GitHub Enterprise Server (see --api-url); github.com doesn't suspend users")
+			}
+			var failSeverity *Severity
+			if *failOn != "" {
+				failSeverity = new(Severity)
+				if err := failSeverity.UnmarshalText([]byte(*failOn)); err != nil {
+					return usageErrorf("check: --fail-on: %v", err)
+				}
+			}
+			cfg, err := loadConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			checks, err := cfg.enabledChecks()
+			if err != nil {
+				return err
+			}
+			if *list {
+				output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+				for _, check := range checks {
+					fmt.Fprintf(output, "%s\t%s\t%s\t%s\n", check.Name(), check.Severity, strings.Join(check.Controls, ","), check.Description())
+				}
+				output.Flush()
+				return nil
+			}
+			if len(args) == 0 {
+				return usageErrorf("check: expected argument ORGNAME, or --list")
+			}
+			orgname := args[0]
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+
+			role, err := getViewerRole(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			snap := &Snapshot{Org: orgname}
+			members, err := getMemberRoles(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			snap.Members = make(map[string]bool, len(members))
+			for _, member := range members {
+				snap.Members[member.Login] = true
+				if member.Owner {
+					snap.Owners = append(snap.Owners, member.Login)
+				}
+			}
+			snap.Teams, err = getTeams(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			var total, invisible int
+			snap.Repos, total, invisible, err = collect(ctx, orgname, opts)
+			if err != nil && err != errInterrupted {
+				return err
+			}
+			if *suspendedUsers && err == nil {
+				// If this is cut off, the findings about the
+				// users it didn't get to are missing, as a
+				// partial report's are about the repos.
+				snap.Suspended, err = getSuspendedUsers(ctx, snapshotUsers(snap))
+				if err != nil && err != errInterrupted {
+					return err
+				}
+			}
+			needTeams := *userDetails
+			for _, check := range checks {
+				if c, ok := check.Check.(teamMembershipCheck); ok && c.NeedsTeamMembership() {
+					needTeams = true
+				}
+			}
+			if needTeams && err == nil {
+				// Likewise.
+				snap.TeamMembers, err = getTeamMembership(ctx, orgname)
+				switch {
+				case err == nil && *userDetails:
+					snap.Users, err = getUserDetails(ctx, orgname, snapshotUsers(snap))
+				case err != nil && ctx.Err() != nil:
+					err = errInterrupted
+				}
+				if err != nil && err != errInterrupted {
+					return err
+				}
+			}
+			findings := runChecks(checks, snap)
+
+			partialOutput := os.Stdout
+			if *format == "oscal" {
+				var end *time.Time
+				if err == nil {
+					now := time.Now().UTC()
+					end = &now
+				}
+				if err := writeOSCAL(os.Stdout, orgname, *oscalPlan, checks, findings, len(snap.Repos), start, end); err != nil {
+					return err
+				}
+				// The document says for itself that it is
+				// incomplete.
+				partialOutput = os.Stderr
+			} else {
+				writeFindings(os.Stdout, findings)
+				if caveat := role.Caveat(orgname); caveat != "" {
+					fmt.Fprintf(os.Stdout, "NOTE: %s\n", caveat)
+				}
+			}
+			if err == errInterrupted {
+				fmt.Fprintf(partialOutput, "PARTIAL REPORT: interrupted after %d of %d repositories\n", len(snap.Repos), total)
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%d findings from %d checks\n", len(findings), len(checks))
+			printCoverage(orgname, invisible)
+			if failSeverity != nil {
+				failing := 0
+				for _, finding := range findings {
+					if finding.Severity >= *failSeverity {
+						failing++
+					}
+				}
+				if failing > 0 {
+					return fmt.Errorf("%d %w=%s", failing, errFindings, *failSeverity)
+				}
+			}
+			return nil
+		}
+	},
+}
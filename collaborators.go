@@ -2,19 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"sort"
 	"strings"
-	"text/tabwriter"
+	"sync"
+	"time"
 )
 
 type graphqlRequest struct {
-	Query     string                 `json:"query"`
-	Variables map[string]interface{} `json:"variables"`
+	Query         string                   `json:"query,omitempty"`
+	OperationName string                   `json:"operationName,omitempty"`
+	Variables     map[string]interface{}   `json:"variables"`
+	Extensions    *persistedQueryExtension `json:"extensions,omitempty"`
 }
 
 type graphqlResponse struct {
@@ -22,52 +28,209 @@ type graphqlResponse struct {
 	Errors []interface{}   `json:"errors"`
 }
 
-func graphql(out interface{}, query string, arguments map[string]interface{}) error {
-	reqbody, err := json.Marshal(graphqlRequest{Query: query, Variables: arguments})
+// operationName returns the name of the first operation in a GraphQL
+// document, or "anonymous" if it doesn't have one.
+func operationName(query string) string {
+	fields := strings.FieldsFunc(query, func(r rune) bool {
+		return !(r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+	})
+	if len(fields) >= 2 && (fields[0] == "query" || fields[0] == "mutation") {
+		return fields[1]
+	}
+	return "anonymous"
+}
+
+// rateLimitQuery is added to every query operation, so that we find
+// out what each query cost without every query having to ask for it
+// itself.  It is aliased so that it can't collide with a query that
+// does ask for rateLimit itself.
+const rateLimitQuery = `
+  graphqlRateLimit: rateLimit {
+    cost
+    limit
+    remaining
+    resetAt
+  }`
+
+type rateLimitInfo struct {
+	Cost      int
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// withRateLimit returns query with rateLimitQuery added to it, if it
+// is a query (rather than a mutation).
+func withRateLimit(query string) string {
+	if !strings.HasPrefix(strings.TrimSpace(query), "query") {
+		return query
+	}
+	idx := strings.Index(query, "{")
+	if idx < 0 {
+		return query
+	}
+	return query[:idx+1] + rateLimitQuery + query[idx+1:]
+}
+
+// graphql runs a GraphQL query (or mutation), decoding its data in to
+// out.  It is paced to stay within the rate limit (see rateLimiter), and
+// retried if it fails because of the rate limit or, for a query, a
+// transient error.  A mutation isn't retried after a transient error,
+// since GitHub may have carried it out before failing, and doing it
+// again could, say, file a second issue.  It gives up as soon as ctx
+// is done, even part-way through a request.
+func graphql(ctx context.Context, out interface{}, query string, arguments map[string]interface{}) error {
+	isMutation := strings.HasPrefix(strings.TrimSpace(query), "mutation")
+	transient := func(err error) bool {
+		if isMutation {
+			return false
+		}
+		if _, paginated := arguments["pageSize"]; paginated && isPageTooExpensive(err) && pageSize.Size() > 1 {
+			// Leave it to the caller to try a smaller page,
+			// rather than asking for the same page again.
+			return false
+		}
+		return isTransient(err)
+	}
+	return withRetries(ctx, graphqlRateLimit, operationName(query), transient, func(attempt int) error {
+		err := graphqlOnce(ctx, out, query, arguments, attempt, flagGraphQLQueries != queriesPersisted)
+		if err == errPersistedQueryNotFound {
+			err = graphqlOnce(ctx, out, query, arguments, attempt+1, true)
+		}
+		return err
+	})
+}
+
+// errPersistedQueryNotFound is returned by graphqlOnce if it sent a
+// persisted query's hash without the query, and the server didn't know
+// the hash.
+var errPersistedQueryNotFound = errors.New("persisted query not found")
+
+// graphqlOnce sends a GraphQL request, in the form that
+// --graphql-queries says.  If sendQuery is false (which only makes
+// sense with --graphql-queries=persisted), only the query's hash is
+// sent.  attempt is as withRetries passes it, for stats.
+func graphqlOnce(ctx context.Context, out interface{}, query string, arguments map[string]interface{}, attempt int, sendQuery bool) (err error) {
+	opname := operationName(query)
+	ctx, span := startSpan(ctx, "graphql "+opname, true)
+	start := time.Now()
+	var rateLimit struct {
+		Info *rateLimitInfo `json:"graphqlRateLimit"`
+	}
+	defer func() {
+		latency := time.Since(start)
+		cost := 0
+		if rateLimit.Info != nil {
+			cost = rateLimit.Info.Cost
+		}
+		stats.record(opname, attempt, latency, cost, err)
+		span.SetAttr("graphql.operation.name", opname)
+		span.SetAttr("github.rate_limit.cost", cost)
+		span.End(err)
+		if flagDebug {
+			if rateLimit.Info != nil {
+				fmt.Fprintf(os.Stderr, "debug: %s: cost=%d remaining=%d resetAt=%s latency=%v err=%v\n",
+					opname, rateLimit.Info.Cost, rateLimit.Info.Remaining, rateLimit.Info.ResetAt.Format(time.RFC3339),
+					latency.Round(time.Millisecond), err)
+			} else {
+				fmt.Fprintf(os.Stderr, "debug: %s: cost=unknown latency=%v err=%v\n", opname, latency.Round(time.Millisecond), err)
+			}
+		}
+	}()
+
+	req := graphqlRequest{Query: withRateLimit(query), OperationName: opname, Variables: arguments}
+	if flagGraphQLQueries != queriesFull {
+		req.Query = minifyQuery(req.Query)
+	}
+	if flagGraphQLQueries == queriesPersisted {
+		req.Extensions = &persistedQueryExtension{}
+		req.Extensions.PersistedQuery.Version = 1
+		req.Extensions.PersistedQuery.SHA256Hash = queryHash(req.Query)
+	}
+	if !sendQuery {
+		req.Query = ""
+	}
+	reqbody, err := json.Marshal(req)
 	if err != nil {
 		return err
 	}
-	httpreq, err := http.NewRequest(http.MethodPost, "https://api.github.com/graphql", bytes.NewReader(reqbody))
+	httpreq, err := http.NewRequestWithContext(ctx, http.MethodPost, graphqlURL, bytes.NewReader(reqbody))
 	if err != nil {
 		return err
 	}
-	httpreq.Header.Add("Authorization", "bearer "+os.Getenv("GH_TOKEN"))
+	auth, err := authorization(ctx)
+	if err != nil {
+		return err
+	}
+	httpreq.Header.Add("Authorization", auth)
 
-	httpresp, err := http.DefaultClient.Do(httpreq)
+	httpresp, err := httpClient.Do(httpreq)
 	if err != nil {
 		return err
 	}
-	defer httpreq.Body.Close()
+	defer httpresp.Body.Close()
 
 	respbody, err := ioutil.ReadAll(httpresp.Body)
 	if err != nil {
 		return err
 	}
+	if err := checkRateLimited(httpresp, respbody); err != nil {
+		return err
+	}
+	if httpresp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %s: %s", httpresp.Status, bytes.TrimSpace(respbody))
+	}
 	var gqlresp graphqlResponse
 	if err := json.Unmarshal(respbody, &gqlresp); err != nil {
 		return err
 	}
+	if len(gqlresp.Data) > 0 {
+		// Even a response with errors may say what it cost.
+		_ = json.Unmarshal(gqlresp.Data, &rateLimit)
+	}
+	if info := rateLimit.Info; info != nil {
+		graphqlRateLimit.Update(info.Limit, info.Remaining, info.Cost, info.ResetAt)
+	}
+	if !sendQuery && isPersistedQueryNotFound(gqlresp.Errors) {
+		return errPersistedQueryNotFound
+	}
 	if len(gqlresp.Errors) > 0 {
-		return fmt.Errorf("graphql error: %v", gqlresp.Errors)
+		err := fmt.Errorf("graphql error: %v", gqlresp.Errors)
+		for _, gqlerr := range gqlresp.Errors {
+			if obj, ok := gqlerr.(map[string]interface{}); ok && obj["type"] == "RATE_LIMITED" {
+				// The primary rate limit is used up (which the
+				// pacing should have prevented, unless something
+				// else is using the same token).
+				return &rateLimitedError{wait: graphqlRateLimit.UntilReset(), err: err}
+			}
+		}
+		return err
 	}
 	return json.Unmarshal(gqlresp.Data, &out)
 }
 
 type Permission int
 
+// The permissions are in order of increasing access.  TRIAGE and
+// MAINTAIN only ever show up as a user's effective permission on a
+// repo, never as a permission source.
 const (
 	PermNONE = iota
 	PermREAD
+	PermTRIAGE
 	PermWRITE
+	PermMAINTAIN
 	PermADMIN
 )
 
 func (p *Permission) UnmarshalText(text []byte) error {
 	val, ok := map[string]Permission{
-		"NONE":  PermNONE,
-		"READ":  PermREAD,
-		"WRITE": PermWRITE,
-		"ADMIN": PermADMIN,
+		"NONE":     PermNONE,
+		"READ":     PermREAD,
+		"TRIAGE":   PermTRIAGE,
+		"WRITE":    PermWRITE,
+		"MAINTAIN": PermMAINTAIN,
+		"ADMIN":    PermADMIN,
 	}[string(text)]
 	if !ok {
 		return fmt.Errorf("invalid permission enum string: %q", text)
@@ -76,12 +239,18 @@ func (p *Permission) UnmarshalText(text []byte) error {
 	return nil
 }
 
+func (p Permission) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
 func (p Permission) String() string {
 	val, ok := map[Permission]string{
-		PermNONE:  "NONE",
-		PermREAD:  "READ",
-		PermWRITE: "WRITE",
-		PermADMIN: "ADMIN",
+		PermNONE:     "NONE",
+		PermREAD:     "READ",
+		PermTRIAGE:   "TRIAGE",
+		PermWRITE:    "WRITE",
+		PermMAINTAIN: "MAINTAIN",
+		PermADMIN:    "ADMIN",
 	}[p]
 	if !ok {
 		return fmt.Sprintf("Permission(%d)", p)
@@ -89,20 +258,87 @@ func (p Permission) String() string {
 	return val
 }
 
-// getTeamFullnames returns a listing of all teams within an
-// organization, represented as map of
-// "slug"=>"parentteam/subteam/subteam".
-func getTeamFullnames(orgname string) (map[string]string, error) {
+// UIName returns the name that GitHub's web UI uses for p, like
+// "Write" for WRITE, for reports meant for people who know the UI
+// rather than the API.
+func (p Permission) UIName() string {
+	val, ok := map[Permission]string{
+		PermNONE:     "None",
+		PermREAD:     "Read",
+		PermTRIAGE:   "Triage",
+		PermWRITE:    "Write",
+		PermMAINTAIN: "Maintain",
+		PermADMIN:    "Admin",
+	}[p]
+	if !ok {
+		return p.String()
+	}
+	return val
+}
+
+// PrincipalKind is the kind of thing that a permission is granted to.
+type PrincipalKind string
+
+const (
+	KindOrg  PrincipalKind = "org"
+	KindTeam PrincipalKind = "team"
+	KindUser PrincipalKind = "user"
+)
+
+// Principal is something that a permission can be granted to.  For a
+// team, the Name is the full "parentteam/subteam" name, not just the
+// slug.  The NodeID is the GraphQL node ID, which (unlike the Name)
+// is stable across renames.
+type Principal struct {
+	Kind   PrincipalKind `json:"kind"`
+	Name   string        `json:"name"`
+	NodeID string        `json:"nodeID,omitempty"`
+}
+
+func (p Principal) String() string {
+	return string(p.Kind) + ":" + p.Name
+}
+
+// parsePrincipal is the inverse of Principal.String (without the
+// NodeID).
+func parsePrincipal(str string) (Principal, error) {
+	parts := strings.SplitN(str, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Principal{}, fmt.Errorf("invalid principal %q (expected KIND:NAME)", str)
+	}
+	switch kind := PrincipalKind(parts[0]); kind {
+	case KindOrg, KindTeam, KindUser:
+		return Principal{Kind: kind, Name: parts[1]}, nil
+	default:
+		return Principal{}, fmt.Errorf("invalid principal %q (kind must be org, team, or user)", str)
+	}
+}
+
+// Team is a team in an organization.
+type Team struct {
+	Slug     string
+	Fullname string // like "parent/child"
+	// Secret is whether the team is hidden from everyone but its own
+	// members and the org's owners, rather than visible to every
+	// member of the org.  A secret team can't have a parent or
+	// children.
+	Secret bool
+}
+
+// getTeams returns every team within an organization, sorted by full
+// name.
+func getTeams(ctx context.Context, orgname string) ([]Team, error) {
 	query := `
-query($orgname: String!, $cursor: String) {
+query getTeams($orgname: String!, $pageSize: Int!, $cursor: String) {
   organization(login: $orgname) {
-    teams(first: 100, after: $cursor) {
+    teams(first: $pageSize, after: $cursor) {
       pageInfo {
         hasNextPage
         endCursor
       }
       nodes {
         slug
+        privacy
         parentTeam {
           slug
         }
@@ -119,6 +355,7 @@ query($orgname: String!, $cursor: String) {
 				}
 				Nodes []struct {
 					Slug       string
+					Privacy    string
 					ParentTeam *struct {
 						Slug string
 					}
@@ -129,27 +366,31 @@ query($orgname: String!, $cursor: String) {
 	args := map[string]interface{}{
 		"orgname": orgname,
 	}
-	var teamSlugs []string
+	var teams []Team
 	teamParents := make(map[string]string)
 	for args["cursor"] == nil || rawTeams.Organization.Teams.PageInfo.HasNextPage {
-		err := graphql(&rawTeams, query, args)
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawTeams, query, args)
 		if err != nil {
-			return nil, fmt.Errorf("getTeamFullnames: %w", err)
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, fmt.Errorf("getTeams: %w", err)
 		}
+		pageSize.Succeeded()
 		args["cursor"] = rawTeams.Organization.Teams.PageInfo.EndCursor
 
 		for _, teamInfo := range rawTeams.Organization.Teams.Nodes {
-			teamSlugs = append(teamSlugs, teamInfo.Slug)
+			teams = append(teams, Team{Slug: teamInfo.Slug, Secret: teamInfo.Privacy == "SECRET"})
 			if teamInfo.ParentTeam != nil {
 				teamParents[teamInfo.Slug] = teamInfo.ParentTeam.Slug
 			}
 		}
 	}
 
-	teamFullnames := make(map[string]string, len(teamSlugs))
-	for _, teamSlug := range teamSlugs {
-		full := teamSlug
-		tip := teamSlug
+	for i := range teams {
+		full := teams[i].Slug
+		tip := teams[i].Slug
 		for tip != "" {
 			parent := teamParents[tip]
 			if parent != "" {
@@ -157,54 +398,134 @@ query($orgname: String!, $cursor: String) {
 			}
 			tip = parent
 		}
-		teamFullnames[teamSlug] = full
+		teams[i].Fullname = full
 	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Fullname < teams[j].Fullname })
+
+	return teams, nil
+}
 
+// getTeamFullnames returns a listing of all teams within an
+// organization, represented as map of
+// "slug"=>"parentteam/subteam/subteam".
+func getTeamFullnames(ctx context.Context, orgname string) (map[string]string, error) {
+	teams, err := getTeams(ctx, orgname)
+	if err != nil {
+		return nil, err
+	}
+	teamFullnames := make(map[string]string, len(teams))
+	for _, team := range teams {
+		teamFullnames[team.Slug] = team.Fullname
+	}
 	return teamFullnames, nil
 }
 
-func getCollaborators(teamFullnames map[string]string, orgname, reponame string) (map[string]Permission, error) {
-	var rawRepo struct {
-		Organization struct {
-			Repository struct {
-				Collaborators struct {
-					Edges []struct {
-						Node struct {
-							Login string
-						}
-						PermissionSources []struct {
-							Permission Permission
-							Source     struct {
-								Org  string
-								Repo string
-								Team string
-							}
-						}
-					}
-				}
-			}
+// collaboratorCount is how many collaborators GitHub says that a repo
+// has (Total), and how many it actually gave us (Returned).  If they
+// differ, the report is missing somebody.
+type collaboratorCount struct {
+	Total    int
+	Returned int
+}
+
+// getCollaborators returns who has been granted access to a repo, and
+// everyone who has access to it as a result, with the duplicate grants
+// that the API reports for the org's owners dropped (unless
+// opts.KeepOwnerDuplicates).
+func getCollaborators(ctx context.Context, teamFullnames map[string]string, orgname, reponame string, opts NormalizeOptions) (collaborators map[Principal]Permission, users []repoUser, count collaboratorCount, err error) {
+	users, count, err = getRepoUsers(ctx, teamFullnames, orgname, reponame)
+	if err != nil {
+		return nil, nil, count, err
+	}
+	// users is a listing of *every single user* who has access,
+	// along with why each of them have access.  We need to
+	// agregate that from "these 15 users all have access because
+	// they are on team Foo" to just "team Foo has access".
+	sources := make([][]permissionSource, len(users))
+	for i, user := range users {
+		sources[i] = user.Sources
+	}
+	collaborators = normalizePermissionSources(orgname, sources, opts)
+	if !opts.KeepOwnerDuplicates {
+		for i := range users {
+			users[i].Sources = dropOwnerDuplicates(orgname, users[i].Sources)
 		}
 	}
-	err := graphql(&rawRepo, `
-query($orgname: String!, $reponame: String!) {
+	return collaborators, users, count, nil
+}
+
+// repoUser is one user who has access to a repo, and why.
+type repoUser struct {
+	Login string
+	// Permission is the user's effective permission, as GitHub
+	// reports it.  It is usually the highest of Sources', but the
+	// sources only ever say READ, WRITE, or ADMIN, so it may be more
+	// (say, MAINTAIN).
+	Permission Permission
+	Sources    []permissionSource
+	// Approximate is set if Permission is only the least that the
+	// user has; see withSources.
+	Approximate bool
+}
+
+// withSources returns u with only the given sources, which are some of
+// u.Sources.  If they include the highest of u's sources, it keeps u's
+// Permission.  Otherwise its Permission is the highest of them, and if
+// u's was more than any of its sources said, GitHub hasn't said
+// whether it came from one that is left, so it is marked Approximate.
+func (u repoUser) withSources(sources []permissionSource) repoUser {
+	var highest, highestKept Permission
+	for _, source := range u.Sources {
+		if source.Permission > highest {
+			highest = source.Permission
+		}
+	}
+	for _, source := range sources {
+		if source.Permission > highestKept {
+			highestKept = source.Permission
+		}
+	}
+	ret := repoUser{Login: u.Login, Permission: u.Permission, Sources: sources, Approximate: u.Approximate}
+	if highestKept < highest {
+		ret.Permission = highestKept
+		ret.Approximate = ret.Approximate || u.Permission > highest
+	}
+	return ret
+}
+
+// getRepoUsers returns everyone who has access to a repo, whether it
+// was granted to them directly, to a team that they are in (or in a
+// child of), or to the org's members.
+func getRepoUsers(ctx context.Context, teamFullnames map[string]string, orgname, reponame string) (users []repoUser, count collaboratorCount, err error) {
+	query := `
+query getRepoUsers($orgname: String!, $reponame: String!, $pageSize: Int!, $cursor: String) {
   organization(login: $orgname) {
     repository(name: $reponame) {
-      collaborators {
+      collaborators(first: $pageSize, after: $cursor) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        totalCount
         edges {
           node {
             login
+            id
           }
+          permission
           permissionSources {
             permission
             source {
               ... on Organization {
                 org: login
+                id
               }
               ... on Repository {
                 repo: name
               }
               ... on Team {
                 team: slug
+                id
               }
             }
           }
@@ -212,47 +533,126 @@ query($orgname: String!, $reponame: String!) {
       }
     }
   }
-}`, map[string]interface{}{
+}`
+	var rawRepo struct {
+		Organization struct {
+			Repository struct {
+				Collaborators struct {
+					PageInfo struct {
+						HasNextPage bool
+						EndCursor   string
+					}
+					TotalCount int
+					Edges      []struct {
+						Node struct {
+							Login string
+							ID    string
+						}
+						Permission        Permission
+						PermissionSources []struct {
+							Permission Permission
+							Source     struct {
+								ID   string
+								Org  string
+								Repo string
+								Team string
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
 		"orgname":  orgname,
 		"reponame": reponame,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("getCollaborators: %q: %w", reponame, err)
-	}
-	// That query will give us a listing of *every single user*
-	// who has access, along with why each of them have access.
-	// We need to agregate that from "these 15 users all have
-	// access because they are on team Foo" to just "team Foo has
-	// access".
-	ret := map[string]Permission{}
-	for _, userInfo := range rawRepo.Organization.Repository.Collaborators.Edges {
-		isOrgOwner := false
-		skippedSources := make(map[string]bool)
-		for _, source := range userInfo.PermissionSources {
-			var key string
-			switch {
-			case source.Source.Org != "":
-				key = "org:" + source.Source.Org
-			case source.Source.Team != "":
-				key = "team:" + teamFullnames[source.Source.Team]
-			case source.Source.Repo != "":
-				key = "user:" + userInfo.Node.Login
+	}
+	for args["cursor"] == nil || rawRepo.Organization.Repository.Collaborators.PageInfo.HasNextPage {
+		// Decoding in to the previous page's edges would leave
+		// behind whichever of a source's fields this page's edges
+		// don't have.
+		rawRepo.Organization.Repository.Collaborators.Edges = nil
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawRepo, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
 			}
-			if key == "org:"+orgname {
-				if source.Permission == PermADMIN {
-					isOrgOwner = true
+			return nil, count, fmt.Errorf("getRepoUsers: %q: %w", reponame, err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawRepo.Organization.Repository.Collaborators.PageInfo.EndCursor
+
+		for _, userInfo := range rawRepo.Organization.Repository.Collaborators.Edges {
+			var sources []permissionSource
+			for _, source := range userInfo.PermissionSources {
+				var principal Principal
+				switch {
+				case source.Source.Org != "":
+					principal = Principal{Kind: KindOrg, Name: source.Source.Org, NodeID: source.Source.ID}
+				case source.Source.Team != "":
+					principal = Principal{Kind: KindTeam, Name: teamFullnames[source.Source.Team], NodeID: source.Source.ID}
+				case source.Source.Repo != "":
+					principal = Principal{Kind: KindUser, Name: userInfo.Node.Login, NodeID: userInfo.Node.ID}
 				}
+				sources = append(sources, permissionSource{Principal: principal, Permission: source.Permission})
+			}
+			users = append(users, repoUser{Login: userInfo.Node.Login, Permission: userInfo.Permission, Sources: sources})
+		}
+	}
+	count = collaboratorCount{
+		Total:    rawRepo.Organization.Repository.Collaborators.TotalCount,
+		Returned: len(users),
+	}
+	return users, count, nil
+}
+
+// permissionSource is one of the reasons that the API gives for a
+// user having access to a repository.  A grant directly to the user
+// has the user themselves as the Principal.
+type permissionSource struct {
+	Principal  Principal
+	Permission Permission
+}
+
+// NormalizeOptions turns off individual heuristics in
+// normalizePermissionSources.
+type NormalizeOptions struct {
+	KeepOwnerDuplicates bool
+	KeepChildTeams      bool
+}
+
+// normalizePermissionSources takes the list of permission sources for
+// each user with access to a repository in organization orgname, and
+// aggregates them in to a single permission per source.  Along the
+// way it undoes a few quirks of the API:
+//
+//   - The organization that owns the repository is never reported as a
+//     source.
+//   - A user who is an owner of that organization appears to have ADMIN
+//     via every other source too.  For such a user, the first ADMIN
+//     entry for each source is dropped (unless KeepOwnerDuplicates).
+//   - If a source shows up with different permissions for different
+//     users, the highest permission wins.
+//   - A child team with the same permission as its parent team is
+//     dropped (unless KeepChildTeams), since it only shows up because
+//     of the parent team's grant.
+func normalizePermissionSources(orgname string, users [][]permissionSource, opts NormalizeOptions) map[Principal]Permission {
+	isOwnOrg := func(p Principal) bool {
+		return p.Kind == KindOrg && p.Name == orgname
+	}
+	ret := map[Principal]Permission{}
+	for _, sources := range users {
+		if !opts.KeepOwnerDuplicates {
+			sources = dropOwnerDuplicates(orgname, sources)
+		}
+		for _, source := range sources {
+			key := source.Principal
+			if isOwnOrg(key) {
 				// Don't bother recording this in to `ret`; of course the org that a repo is in has
 				// access to that repo.
 				continue
 			}
-			if isOrgOwner && !skippedSources[key] && source.Permission == PermADMIN {
-				// If the user is an organization owner, then the API makes it look like they also have
-				// ADMIN on each and every specific repo for a bunch of other specific reasons.  Remove
-				// this duplication.
-				skippedSources[key] = true
-				continue
-			}
 			if oldVal, exists := ret[key]; exists && oldVal != source.Permission {
 				// This can happen for nested groups.  If team:company has "READ", and team:company/dev
 				// has "WRITE", and Bob is in team:company/dev but not team:company, then Bob will have
@@ -266,38 +666,148 @@ query($orgname: String!, $reponame: String!) {
 		}
 	}
 
+	if opts.KeepChildTeams {
+		return ret
+	}
 	// Prune redundant child teams; see above about team:company permissions getting attributed to team:company/dev.
 	for parentKey := range ret {
-		if strings.HasPrefix(parentKey, "team:") {
+		if parentKey.Kind == KindTeam {
 			for childKey := range ret {
-				if strings.HasPrefix(childKey, parentKey+"/") && ret[childKey] == ret[parentKey] {
+				if childKey.Kind == KindTeam && strings.HasPrefix(childKey.Name, parentKey.Name+"/") && ret[childKey] == ret[parentKey] {
 					delete(ret, childKey)
 				}
 			}
 		}
 	}
 
-	return ret, nil
+	return ret
+}
+
+// dropOwnerDuplicates returns one user's sources of access to a repo
+// in organization orgname, less the duplicates that the API adds if
+// they are an owner of that organization: it makes it look like they
+// also have ADMIN on the repo for a bunch of other specific reasons, so
+// the first ADMIN entry for each other source is dropped.  A user who
+// isn't an owner has their sources returned as they are.
+func dropOwnerDuplicates(orgname string, sources []permissionSource) []permissionSource {
+	isOrgOwner := false
+	for _, source := range sources {
+		if source.Principal.Kind == KindOrg && source.Principal.Name == orgname && source.Permission == PermADMIN {
+			isOrgOwner = true
+		}
+	}
+	if !isOrgOwner {
+		return sources
+	}
+	ret := make([]permissionSource, 0, len(sources))
+	skippedSources := make(map[Principal]bool)
+	for _, source := range sources {
+		key := source.Principal
+		isOwnOrg := key.Kind == KindOrg && key.Name == orgname
+		if !isOwnOrg && !skippedSources[key] && source.Permission == PermADMIN {
+			skippedSources[key] = true
+			continue
+		}
+		ret = append(ret, source)
+	}
+	return ret
 }
 
 type RepoHandle struct {
+	// ID is the repository's GraphQL node ID, which (unlike its name)
+	// stays the same if it is renamed or transferred.
+	ID   string
 	Name string
 	URL  string
+
+	// IsArchived is whether the repository has been archived (made
+	// read-only); archived repositories are only listed if asked for.
+	IsArchived bool
+
+	// IsFork is whether the repository is a fork, and Upstream is the
+	// "owner/name" of the repository that it is a fork of.  Upstream
+	// may be empty even for a fork if the upstream has since been
+	// deleted or is not visible to us.
+	IsFork   bool
+	Upstream string
+
+	// IsTemplate is whether the repository is a template repository,
+	// and Template is the "owner/name" of the template repository
+	// that it was generated from (if any).
+	IsTemplate bool
+	Template   string
+
+	// UpdatedAt is when the repository (or anything in it) was last
+	// modified.
+	UpdatedAt time.Time
+
+	// Visibility is "PUBLIC", "PRIVATE", or "INTERNAL".
+	Visibility string
+	// License is the SPDX ID of the license that GitHub detected in
+	// the repository; "NOASSERTION" if there is a license file that
+	// GitHub couldn't identify, or empty if there is none.
+	License string
+
+	// Settings are the repository's merge and branch protection
+	// settings.
+	Settings RepoSettings
 }
 
-func getRepos(orgname string) ([]RepoHandle, error) {
-	query := `					
-query($orgname: String!, $cursor: String) {
+// coverageUnknown is what getRepos returns as the number of invisible
+// repos when there's no telling how many there are.
+const coverageUnknown = -1
+
+// getRepos returns the repositories in an organization (leaving out
+// archived ones unless includeArchived is set), along with a count of
+// how many repositories the organization has that were not returned
+// to us at all (because the token can't see them).  GraphQL's
+// totalCount only counts the repositories that the token can see, so
+// the count comes from the REST API's totals of the org's public and
+// private repositories instead.  GitHub only includes the private
+// ones for some tokens (the org's owners'); for the rest, or if the
+// totals are fewer than the repositories that were returned, invisible
+// is coverageUnknown.
+func getRepos(ctx context.Context, orgname string, includeArchived bool) (repos []RepoHandle, invisible int, err error) {
+	query := `
+query getRepos($orgname: String!, $pageSize: Int!, $cursor: String) {
   organization(login: $orgname) {
-    repositories(first: 100, after: $cursor, orderBy: {field: UPDATED_AT, direction: DESC}) {
+    repositories(first: $pageSize, after: $cursor, orderBy: {field: UPDATED_AT, direction: DESC}) {
       pageInfo {
         hasNextPage
         endCursor
       }
       nodes {
+        id
         name
         url
+        updatedAt
         isArchived
+        isFork
+        parent {
+          nameWithOwner
+        }
+        isTemplate
+        templateRepository {
+          nameWithOwner
+        }
+        visibility
+        licenseInfo {
+          spdxId
+        }
+        hasIssuesEnabled
+        mergeCommitAllowed
+        squashMergeAllowed
+        rebaseMergeAllowed
+        defaultBranchRef {
+          name
+          branchProtectionRule {
+            allowsForcePushes
+            allowsDeletions
+            requiresLinearHistory
+            requiresApprovingReviews
+            requiredApprovingReviewCount
+          }
+        }
       }
     }
   }
@@ -310,9 +820,31 @@ query($orgname: String!, $cursor: String) {
 					EndCursor   string
 				}
 				Nodes []struct {
+					ID         string
 					Name       string
 					URL        string
+					UpdatedAt  time.Time
 					IsArchived bool
+					IsFork     bool
+					Parent     *struct {
+						NameWithOwner string
+					}
+					IsTemplate         bool
+					TemplateRepository *struct {
+						NameWithOwner string
+					}
+					Visibility  string
+					LicenseInfo *struct {
+						SpdxID string `json:"spdxId"`
+					}
+					HasIssuesEnabled   bool
+					MergeCommitAllowed bool
+					SquashMergeAllowed bool
+					RebaseMergeAllowed bool
+					DefaultBranchRef   *struct {
+						Name                 string
+						BranchProtectionRule *BranchProtection
+					}
 				}
 			}
 		}
@@ -320,76 +852,690 @@ query($orgname: String!, $cursor: String) {
 	args := map[string]interface{}{
 		"orgname": orgname,
 	}
-	var repos []RepoHandle
+	seen := 0
 	for args["cursor"] == nil || rawRepos.Organization.Repositories.PageInfo.HasNextPage {
-		err := graphql(&rawRepos, query, args)
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawRepos, query, args)
 		if err != nil {
-			return nil, fmt.Errorf("getRepos: %w", err)
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, 0, fmt.Errorf("getRepos: %w", err)
 		}
+		pageSize.Succeeded()
 		args["cursor"] = rawRepos.Organization.Repositories.PageInfo.EndCursor
 
 		for _, repoInfo := range rawRepos.Organization.Repositories.Nodes {
-			if repoInfo.IsArchived {
+			seen++
+			if repoInfo.IsArchived && !includeArchived {
 				continue
 			}
-			repos = append(repos, RepoHandle{Name: repoInfo.Name, URL: repoInfo.URL})
+			repo := RepoHandle{
+				ID:         repoInfo.ID,
+				Name:       repoInfo.Name,
+				URL:        repoInfo.URL,
+				IsArchived: repoInfo.IsArchived,
+				IsFork:     repoInfo.IsFork,
+				IsTemplate: repoInfo.IsTemplate,
+				UpdatedAt:  repoInfo.UpdatedAt,
+				Visibility: repoInfo.Visibility,
+				Settings: RepoSettings{
+					HasIssues:          repoInfo.HasIssuesEnabled,
+					MergeCommitAllowed: repoInfo.MergeCommitAllowed,
+					SquashMergeAllowed: repoInfo.SquashMergeAllowed,
+					RebaseMergeAllowed: repoInfo.RebaseMergeAllowed,
+				},
+			}
+			if ref := repoInfo.DefaultBranchRef; ref != nil {
+				repo.Settings.DefaultBranch = ref.Name
+				repo.Settings.Protection = ref.BranchProtectionRule
+			}
+			if repoInfo.Parent != nil {
+				repo.Upstream = repoInfo.Parent.NameWithOwner
+			}
+			if repoInfo.TemplateRepository != nil {
+				repo.Template = repoInfo.TemplateRepository.NameWithOwner
+			}
+			if repoInfo.LicenseInfo != nil {
+				repo.License = repoInfo.LicenseInfo.SpdxID
+			}
+			repos = append(repos, repo)
+		}
+	}
+	var rawOrg struct {
+		PublicRepos       int  `json:"public_repos"`
+		TotalPrivateRepos *int `json:"total_private_repos"`
+	}
+	if err := restGet(ctx, &rawOrg, "/orgs/%s", orgname); err != nil {
+		return nil, 0, fmt.Errorf("getRepos: %w", err)
+	}
+	if rawOrg.TotalPrivateRepos == nil {
+		return repos, coverageUnknown, nil
+	}
+	total := rawOrg.PublicRepos + *rawOrg.TotalPrivateRepos
+	if total < seen {
+		// The totals leave out some that the token can see, so
+		// they can't be trusted to count the ones that it can't.
+		return repos, coverageUnknown, nil
+	}
+	return repos, total - seen, nil
+}
+
+// sortRepos sorts repos by "updated" (most recently modified first) or
+// by "name".  Either way, ties are broken by name, so that the order is
+// entirely determined by the repos themselves and not by the order
+// that the API happened to return them in.
+func sortRepos(repos []RepoHandle, by string) {
+	sort.SliceStable(repos, func(i, j int) bool {
+		if by != "name" && !repos[i].UpdatedAt.Equal(repos[j].UpdatedAt) {
+			return repos[i].UpdatedAt.After(repos[j].UpdatedAt)
+		}
+		return repos[i].Name < repos[j].Name
+	})
+}
+
+// matchRepos returns the repos whose names match at least one of the
+// glob patterns in include (or all of them, if include is empty) and
+// none of those in exclude.  Like GitHub's repo names, the matching
+// is case-insensitive.
+func matchRepos(repos []RepoHandle, include, exclude []string) []RepoHandle {
+	matchesAny := func(name string, patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+				return true
+			}
 		}
+		return false
 	}
-	return repos, nil
+	var ret []RepoHandle
+	for _, repo := range repos {
+		if (len(include) == 0 || matchesAny(repo.Name, include)) && !matchesAny(repo.Name, exclude) {
+			ret = append(ret, repo)
+		}
+	}
+	return ret
 }
 
-func Main(orgname string) error {
-	if os.Getenv("GH_TOKEN") == "" {
-		return fmt.Errorf("must set the GH_TOKEN environment variable to a GitHub personal access token that has the 'admin:org' permission")
+// checkRepoPatterns returns an error if any of patterns isn't a valid
+// glob pattern for matchRepos.
+func checkRepoPatterns(flagname string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", flagname, pattern, err)
+		}
 	}
-	teamFullnames, err := getTeamFullnames(orgname)
-	if err != nil {
+	return nil
+}
+
+type Options struct {
+	// Sources is which buckets of permission source to include in
+	// the report, in column order.
+	Sources []*Bucket
+
+	// IncludeArchived makes collect inspect archived repos too.
+	IncludeArchived bool
+
+	// Repos and ExcludeRepos are glob patterns for which repos to
+	// inspect; see matchRepos.
+	Repos        []string
+	ExcludeRepos []string
+
+	// Team is the slug of a team; if it is set, only the repos that
+	// the team can access are inspected.  See getTeamRepos.
+	Team string
+
+	Normalize NormalizeOptions
+
+	// Checkpoint is a file to save progress to if the run gets
+	// interrupted, and to resume from if it already exists.
+	Checkpoint string
+
+	// SortBy is the order to list repos in: "updated" (most recently
+	// modified first) or "name".
+	SortBy string
+
+	// Filter, if set, decides which grants are included in the
+	// report.
+	Filter *grantFilter
+
+	// Format is the output format: "table", "markdown", "html",
+	// "json", "csv", or "cypher".
+	Format string
+
+	// ShowLicense adds a column with each repo's license to the
+	// report.
+	ShowLicense bool
+
+	// GitArchive is a git repository to commit the report to, if
+	// the run completes; see writeGitArchive.
+	GitArchive string
+
+	// HTMLSite is a directory to write the report to as a static
+	// site, if the run completes; see writeHTMLSite.
+	HTMLSite string
+
+	// HTMLSiteRepo is a repository ("OWNER/NAME") to commit the
+	// static site to the HTMLSiteBranch branch of, for GitHub Pages to
+	// serve; see publishHTMLSite.
+	HTMLSiteRepo   string
+	HTMLSiteBranch string
+
+	// MongoURI is a MongoDB server to upsert the report in to, if the
+	// run completes, in the MongoCollection ("DATABASE.COLLECTION")
+	// collection; see writeMongo.
+	MongoURI        string
+	MongoCollection string
+
+	// ByUser makes the report list, for each user, the repos that
+	// they have access to, rather than who has access to each repo.
+	ByUser bool
+
+	// Effective makes the report list each user's effective
+	// permission on each repo, the highest that any of their grants
+	// (or being an org owner) gives them, without the grants that
+	// ByUser lists; see effectiveAccess.  It implies RepoUsers.
+	Effective bool
+
+	// UINames makes the report name permissions as GitHub's web UI
+	// does ("Write", rather than WRITE).  It only affects tables.
+	UINames bool
+
+	// ExpandTeams makes the report list the users who get each
+	// team's grants, as individuals, in place of the team; see
+	// expandTeams.
+	ExpandTeams bool
+
+	// ByTeam makes the report list, for each team, the repos that it
+	// has been granted access to.
+	ByTeam bool
+
+	// KeepGoing makes collect leave out the repos that it fails to
+	// inspect, rather than give up; see repoFailures.
+	KeepGoing bool
+
+	// Overlap makes a report on more than one org list the users who
+	// have access in more than one of them, rather than who has
+	// access to each repo.
+	Overlap bool
+
+	// DedupeACL makes the report list each distinct set of grants
+	// once, along with the repos that have it, rather than listing
+	// each repo.
+	DedupeACL bool
+
+	// Preflight makes Main check that the token has the access it
+	// needs, rather than actually running the report.
+	Preflight bool
+
+	// DeploymentApprovers makes collect also find out who the
+	// required reviewers of each repo's deployment environments are.
+	DeploymentApprovers bool
+
+	// RepoUsers makes collect also keep everyone who has access to
+	// each repo; see RepoReport.Users.
+	RepoUsers bool
+
+	// Parallel is how many repos to inspect at once.  Zero means
+	// one.
+	Parallel int
+}
+
+// needsTeamMembership returns whether the report needs every team's
+// members (and so the org's members), rather than just the teams'
+// grants.
+func (opts Options) needsTeamMembership() bool {
+	return opts.Format == "cypher" || opts.Format == "html" || opts.ByUser || opts.ExpandTeams || opts.HTMLSite != "" || opts.HTMLSiteRepo != ""
+}
+
+// errInterrupted is returned by Main if ctx was cancelled part-way
+// through; whatever had been collected has already been printed.
+var errInterrupted = errors.New("interrupted")
+
+// requireToken returns an error if there is no GitHub token to use,
+// or if it is no good (see checkToken).  If none was given, it uses
+// the one that the gh CLI is logged in with, if any.
+func requireToken(ctx context.Context) error {
+	if githubApp != nil || flagReplayBundle != "" {
+		return nil
+	}
+	if githubToken == "" {
+		if githubToken = ghToken(apiHostname()); githubToken == "" {
+			return fmt.Errorf("must give a GitHub personal access token that has the 'admin:org' permission, with --token-file or the GH_TOKEN or GITHUB_TOKEN environment variable, or log in with 'gh auth login --scopes admin:org'")
+		}
+	}
+	return checkToken(ctx)
+}
+
+func Main(ctx context.Context, orgname string, opts Options) error {
+	if err := requireToken(ctx); err != nil {
 		return err
 	}
-	repos, err := getRepos(orgname)
+	if opts.Preflight {
+		return preflight(ctx, orgname, opts)
+	}
+	role, err := getViewerRole(ctx, orgname)
 	if err != nil {
 		return err
 	}
-	output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
-	fmt.Fprintf(output, "Repository URL\t| Organizations\t| Teams\t| Individuals\n")
-	fmt.Fprintf(output, "--------------\t| -------------\t| -----\t| -----------\n")
-	for i, repo := range repos {
-		fmt.Fprintf(os.Stderr, "inspecting repo %d/%d %q\n", i, len(repos), repo.Name)
-		collaborators, err := getCollaborators(teamFullnames, orgname, repo.Name)
+	runAt := time.Now()
+	grouping := Grouping{Buckets: opts.Sources, UINames: opts.UINames}
+	if grouping.NeedsMembers() {
+		var err error
+		grouping.Members, err = getOrgMembers(ctx, orgname)
 		if err != nil {
-			return fmt.Errorf("%s: %w", repo.URL, err)
-		}
-		bucketNames := []string{"org", "team", "user"}
-		buckets := make(map[string][]string, len(bucketNames))
-		for _, bucketName := range bucketNames {
-			for k, v := range collaborators {
-				if strings.HasPrefix(k, bucketName+":") {
-					buckets[bucketName] = append(buckets[bucketName], fmt.Sprintf("%s=%s",
-						strings.TrimPrefix(k, bucketName+":"),
-						v))
-				}
+			return err
+		}
+	}
+	var teams teamMembership
+	if opts.needsTeamMembership() {
+		var err error
+		if teams, err = getTeamMembership(ctx, orgname); err != nil {
+			return err
+		}
+		if grouping.Members == nil {
+			if grouping.Members, err = getOrgMembers(ctx, orgname); err != nil {
+				return err
 			}
 		}
-		fmt.Fprintf(output, "%s", repo.URL)
-		for _, bucketName := range bucketNames {
-			items := buckets[bucketName]
-			sort.Strings(items)
-			fmt.Fprintf(output, "\t| %s", strings.Join(items, " "))
+	}
+	var teamList []Team
+	if opts.ByTeam || opts.Format == "html" {
+		var err error
+		if teamList, err = getTeams(ctx, orgname); err != nil {
+			return err
+		}
+	}
+	if opts.Effective {
+		opts.RepoUsers = true
+	}
+	results, total, invisible, err := collect(ctx, orgname, opts)
+	if err != nil && err != errInterrupted && !errors.Is(err, errRepoFailures) {
+		return err
+	}
+	inspected := len(results)
+	if opts.Filter != nil {
+		var filterErr error
+		if results, filterErr = opts.Filter.Apply(results); filterErr != nil {
+			return filterErr
+		}
+		if len(results) == 0 && inspected > 0 {
+			fmt.Fprintf(os.Stderr, "note: %s, so there is nothing to report on\n", filteredOutReason(inspected))
+		}
+	}
+	if opts.ExpandTeams {
+		// After the filter, so that it sees the grants as they
+		// were made.
+		results = expandTeams(results, teams)
+	}
+
+	// Why there is nothing to report on, if there isn't, and the run
+	// got to the end.
+	var reason string
+	if err == nil {
+		reason = emptyReason(orgname, total, invisible, opts)
+		if reason == "" && opts.Filter != nil && len(results) == 0 && inspected > 0 {
+			reason = filteredOutReason(inspected)
 		}
-		fmt.Fprintf(output, "\n")
 	}
-	output.Flush()
 
+	partialOutput := os.Stdout
+	switch {
+	case opts.ByUser && opts.Format == "csv":
+		if err := writeUserCSV(os.Stdout, pivotByUser(results, grouping, teams, grouping.Members)); err != nil {
+			return err
+		}
+		partialOutput = os.Stderr
+	case opts.ByUser:
+		writeUserTable(os.Stdout, pivotByUser(results, grouping, teams, grouping.Members), opts.UINames)
+	case opts.Effective && opts.Format == "csv":
+		if err := writeEffectiveCSV(os.Stdout, effectiveAccess(results, grouping)); err != nil {
+			return err
+		}
+		partialOutput = os.Stderr
+	case opts.Effective:
+		writeEffectiveTable(os.Stdout, effectiveAccess(results, grouping), opts.UINames)
+	case opts.ByTeam && opts.Format == "csv":
+		if err := writeTeamCSV(os.Stdout, pivotByTeam(results, grouping, teamList)); err != nil {
+			return err
+		}
+		partialOutput = os.Stderr
+	case opts.ByTeam:
+		writeTeamTable(os.Stdout, pivotByTeam(results, grouping, teamList), opts.UINames)
+	case opts.Format == "json":
+		if err := writeJSON(os.Stdout, orgname, results, grouping, err == nil, invisible, role); err != nil {
+			return err
+		}
+		// Don't break the JSON by printing anything else to stdout;
+		// it says for itself that it is incomplete.
+		partialOutput = os.Stderr
+	case opts.Format == "csv":
+		if err := writeCSV(os.Stdout, results, grouping, opts.IncludeArchived); err != nil {
+			return err
+		}
+		partialOutput = os.Stderr
+	case opts.Format == "cypher":
+		writeCypher(os.Stdout, orgname, results, grouping, teams, grouping.Members)
+		partialOutput = os.Stderr
+	case opts.Format == "html":
+		if err := writeHTML(os.Stdout, orgname, results, grouping, pivotByUser(results, grouping, teams, grouping.Members), pivotByTeam(results, grouping, teamList),
+			opts.ShowLicense, opts.DeploymentApprovers, err == nil, role.Caveat(orgname), reason, runAt); err != nil {
+			return err
+		}
+		// The page says for itself that it is incomplete.
+		partialOutput = os.Stderr
+	case opts.Format == "markdown":
+		writeMarkdown(os.Stdout, results, grouping, opts.ShowLicense, opts.DeploymentApprovers)
+	case opts.DedupeACL:
+		writeACLClusters(os.Stdout, results, grouping)
+	default:
+		writeTable(os.Stdout, results, grouping, opts.ShowLicense, opts.DeploymentApprovers)
+	}
+	if caveat := role.Caveat(orgname); caveat != "" && partialOutput == os.Stdout {
+		// The machine-readable formats either say so for
+		// themselves or can't, but a table that gets passed
+		// around should carry the warning with it.
+		fmt.Fprintf(os.Stdout, "NOTE: %s\n", caveat)
+	}
+	if reason != "" && partialOutput == os.Stdout {
+		fmt.Fprintf(os.Stdout, "NOTE: %s\n", reason)
+	}
+	if err == errInterrupted {
+		fmt.Fprintf(partialOutput, "PARTIAL REPORT: interrupted after %d of %d repositories\n", inspected, total)
+		return err
+	}
+	printCoverage(orgname, invisible)
+	if err != nil {
+		// Some repos failed, with --keep-going.  The outputs below
+		// are only written after a complete run.
+		return err
+	}
+	if opts.GitArchive != "" {
+		if err := writeGitArchive(opts.GitArchive, orgname, results, grouping, opts.DeploymentApprovers); err != nil {
+			return fmt.Errorf("--git-archive: %w", err)
+		}
+	}
+	if opts.HTMLSite != "" || opts.HTMLSiteRepo != "" {
+		files, err := buildHTMLSite(orgname, results, grouping, pivotByUser(results, grouping, teams, grouping.Members), runAt)
+		if err != nil {
+			return fmt.Errorf("--html-site: %w", err)
+		}
+		if opts.HTMLSite != "" {
+			if err := writeHTMLSite(opts.HTMLSite, files); err != nil {
+				return fmt.Errorf("--html-site: %w", err)
+			}
+		}
+		if opts.HTMLSiteRepo != "" {
+			if err := publishHTMLSite(ctx, opts.HTMLSiteRepo, opts.HTMLSiteBranch, orgname, files); err != nil {
+				return fmt.Errorf("--html-site-repo: %w", err)
+			}
+		}
+	}
+	if opts.MongoURI != "" {
+		if err := writeMongo(ctx, opts.MongoURI, opts.MongoCollection, orgname, runAt, results, grouping); err != nil {
+			return fmt.Errorf("--mongo-uri: %w", err)
+		}
+	}
 	return nil
 }
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Fprintln(os.Stderr, "Usage: %s orgname\n", os.Args[0])
-		os.Exit(2)
+// emptyReason explains why an org has no repos to report on, so that
+// an empty report isn't mistaken for a clean one.  total is how many
+// repos there are to inspect; if that isn't 0, it returns "".
+func emptyReason(orgname string, total, invisible int, opts Options) string {
+	switch {
+	case total > 0:
+		return ""
+	case opts.Team != "" && (len(opts.Repos) > 0 || len(opts.ExcludeRepos) > 0):
+		return fmt.Sprintf("none of the repositories in %q that team %q can access match --repo and --exclude-repo", orgname, opts.Team)
+	case opts.Team != "":
+		return fmt.Sprintf("team %q can't access any of the repositories in %q", opts.Team, orgname)
+	case len(opts.Repos) > 0 || len(opts.ExcludeRepos) > 0:
+		return fmt.Sprintf("no repositories in %q match --repo and --exclude-repo", orgname)
+	case invisible > 0:
+		return fmt.Sprintf("none of the %d repositories in %q are visible to this token", invisible, orgname)
+	case invisible == coverageUnknown:
+		return fmt.Sprintf("no repositories in %q are visible to this token, and it can't see how many private ones there are", orgname)
+	case !opts.IncludeArchived:
+		return fmt.Sprintf("%q has no repositories, other than any archived ones (see --include-archived)", orgname)
+	default:
+		return fmt.Sprintf("%q has no repositories", orgname)
+	}
+}
+
+// filteredOutReason explains a report that --filter left empty.
+func filteredOutReason(inspected int) string {
+	return fmt.Sprintf("--filter matches nothing on any of the %d repositories inspected", inspected)
+}
+
+// printCoverage prints to stderr whether any repos were invisible to
+// the token, to make it impossible to mistake "nothing looks wrong"
+// for "we looked at everything".
+func printCoverage(orgname string, invisible int) {
+	switch {
+	case invisible == coverageUnknown:
+		fmt.Fprintf(os.Stderr, "warning: coverage can't be verified: GitHub doesn't give this token a count of the private repositories in %q that it can trust, so some may not have been visible to it\n",
+			orgname)
+	case invisible > 0:
+		fmt.Fprintf(os.Stderr, "warning: %d of the repositories in %q were not visible to this token and are not included in the report\n",
+			invisible, orgname)
+	default:
+		fmt.Fprintf(os.Stderr, "coverage: all repositories in %q were visible to this token\n", orgname)
+	}
+}
+
+// collect inspects the collaborators of every repo in the org.  If ctx
+// is cancelled part-way through, it returns the reports that it has so
+// far along with errInterrupted.  total is how many repos there are
+// to inspect, and invisible is how many more exist that the token
+// can't see, or coverageUnknown.
+func collect(ctx context.Context, orgname string, opts Options) (results []RepoReport, total, invisible int, err error) {
+	ctx, span := startSpan(ctx, "collect", false)
+	span.SetAttr("github.org", orgname)
+	defer func() {
+		span.SetAttr("github.repos", total)
+		span.End(err)
+	}()
+	teamFullnames, err := getTeamFullnames(ctx, orgname)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	repos, invisible, err := getRepos(ctx, orgname, opts.IncludeArchived)
+	if err != nil {
+		return nil, 0, 0, err
 	}
-	if err := Main(os.Args[1]); err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
-		os.Exit(1)
+	if len(opts.Repos) > 0 || len(opts.ExcludeRepos) > 0 {
+		all := len(repos)
+		repos = matchRepos(repos, opts.Repos, opts.ExcludeRepos)
+		fmt.Fprintf(os.Stderr, "%d of %d repositories match --repo/--exclude-repo\n", len(repos), all)
 	}
+	if opts.Team != "" {
+		fullname, ok := teamFullnames[opts.Team]
+		if !ok {
+			return nil, 0, 0, fmt.Errorf("no team %q in %q that this token can see", opts.Team, orgname)
+		}
+		teamRepos, err := getTeamRepos(ctx, orgname, fullname)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		all := len(repos)
+		var matched []RepoHandle
+		for _, repo := range repos {
+			if teamRepos[repo.Name] {
+				matched = append(matched, repo)
+			}
+		}
+		repos = matched
+		fmt.Fprintf(os.Stderr, "%d of %d repositories are accessible to team %q\n", len(repos), all, fullname)
+	}
+	sortRepos(repos, opts.SortBy)
+	if reason := emptyReason(orgname, len(repos), invisible, opts); reason != "" {
+		fmt.Fprintf(os.Stderr, "note: %s, so there is nothing to report on\n", reason)
+	}
+	var cp *checkpoint
+	if opts.Checkpoint != "" {
+		cp, err = loadCheckpoint(opts.Checkpoint, orgname)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if len(cp.Repos) > 0 {
+			fmt.Fprintf(os.Stderr, "resuming from checkpoint %q (%d repos already inspected)\n", opts.Checkpoint, len(cp.Repos))
+		}
+		defer func() {
+			switch {
+			case err == nil:
+				_ = os.Remove(opts.Checkpoint)
+			case len(cp.Repos) > 0:
+				if saveErr := cp.Save(opts.Checkpoint); saveErr != nil {
+					fmt.Fprintln(os.Stderr, "error:", saveErr)
+				} else {
+					fmt.Fprintf(os.Stderr, "checkpoint written to %q; re-run with the same --checkpoint to resume\n", opts.Checkpoint)
+				}
+			}
+		}()
+	}
+	// Inspect the repos that aren't in the checkpoint with a pool of
+	// workers, each of which fills in its own repos' slots in
+	// fetched, so that the results come out in the same order no
+	// matter which requests finish first.
+	type fetchResult struct {
+		done          bool
+		collaborators map[Principal]Permission
+		approvers     map[Principal][]string
+		users         []repoUser
+		count         collaboratorCount
+		err           error
+	}
+	// fromCheckpoint returns what the checkpoint has for a repo, if it
+	// has everything that this run needs.
+	fromCheckpoint := func(reponame string) (map[Principal]Permission, map[Principal][]string, []repoUser, bool) {
+		collaborators, approvers, users, ok := cp.Get(reponame)
+		if !ok || (opts.DeploymentApprovers && approvers == nil) || (opts.RepoUsers && users == nil) {
+			return nil, nil, nil, false
+		}
+		return collaborators, approvers, users, true
+	}
+	fetched := make([]fetchResult, len(repos))
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	work := make(chan int)
+	go func() {
+		defer close(work)
+		for i, repo := range repos {
+			if _, _, _, ok := fromCheckpoint(repo.Name); ok {
+				continue
+			}
+			select {
+			case work <- i:
+			case <-workCtx.Done():
+				return
+			}
+		}
+	}()
+	workers := opts.Parallel
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if workCtx.Err() != nil {
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "inspecting repo %d/%d %q\n", i, len(repos), repos[i].Name)
+				repoCtx, span := startSpan(workCtx, "inspect repo", false)
+				span.SetAttr("github.org", orgname)
+				span.SetAttr("github.repo", repos[i].Name)
+				var result fetchResult
+				result.collaborators, result.users, result.count, result.err = getCollaborators(repoCtx, teamFullnames, orgname, repos[i].Name, opts.Normalize)
+				switch {
+				case !opts.RepoUsers:
+					result.users = nil
+				case result.users == nil:
+					// Collected, even though there are
+					// none; see checkpoint.Get.
+					result.users = []repoUser{}
+				}
+				if result.err == nil && opts.DeploymentApprovers {
+					result.approvers, result.err = getDeploymentApprovers(repoCtx, teamFullnames, orgname, repos[i].Name)
+				}
+				span.End(result.err)
+				if result.err != nil && workCtx.Err() != nil {
+					// Cut off, rather than failed: as if
+					// interrupted before getting to this one.
+					continue
+				}
+				if result.err != nil && !opts.KeepGoing {
+					// No point in the other workers carrying on.
+					cancel()
+				}
+				result.done = true
+				fetched[i] = result
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, repo := range repos {
+		if fetched[i].done && fetched[i].err == nil {
+			cp.Put(repo.Name, fetched[i].collaborators, fetched[i].approvers, fetched[i].users)
+		}
+	}
+	var mismatched []string
+	var failed repoFailures
+	for i, repo := range repos {
+		if fetched[i].err != nil && opts.KeepGoing {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v; leaving it out of the report\n", repo.URL, fetched[i].err)
+			failed = append(failed, repo.URL)
+			continue
+		}
+		if fetched[i].err != nil {
+			return nil, 0, 0, fmt.Errorf("%s: %w", repo.URL, fetched[i].err)
+		}
+		collaborators, approvers, users, ok := fromCheckpoint(repo.Name)
+		if fetched[i].done {
+			collaborators, approvers, users, ok = fetched[i].collaborators, fetched[i].approvers, fetched[i].users, true
+		}
+		if !ok {
+			// Interrupted before getting to this one.
+			continue
+		}
+		if count := fetched[i].count; fetched[i].done && count.Returned != count.Total {
+			fmt.Fprintf(os.Stderr, "warning: %s: GitHub says there are %d collaborators, but returned %d; the report may be missing some\n",
+				repo.URL, count.Total, count.Returned)
+			mismatched = append(mismatched, repo.URL)
+		}
+		results = append(results, RepoReport{Repo: repo, Collaborators: collaborators, DeploymentApprovers: approvers, Users: users})
+	}
+	if len(results)+len(failed) < len(repos) {
+		return results, len(repos), invisible, errInterrupted
+	}
+	if len(mismatched) > 0 {
+		// Repeat these at the end, where they won't have scrolled
+		// away.
+		fmt.Fprintf(os.Stderr, "warning: %d repositories returned a different number of collaborators than GitHub says they have: %s\n",
+			len(mismatched), strings.Join(mismatched, " "))
+	}
+	if len(failed) > 0 {
+		return results, len(repos), invisible, failed
+	}
+	return results, len(repos), invisible, nil
+}
+
+// errRepoFailures is wrapped by the repoFailures that collect returns
+// with --keep-going.
+var errRepoFailures = errors.New("repositories failed")
+
+// repoFailures are the URLs of the repos that collect couldn't inspect
+// with --keep-going, and so left out.
+type repoFailures []string
+
+func (f repoFailures) Error() string {
+	return fmt.Sprintf("%d %v and were left out of the report: %s", len(f), errRepoFailures, strings.Join(f, " "))
+}
+
+func (f repoFailures) Unwrap() error {
+	return errRepoFailures
 }
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizePermissionSources(t *testing.T) {
+	org := Principal{Kind: KindOrg, Name: "acme", NodeID: "O_acme"}
+	otherOrg := Principal{Kind: KindOrg, Name: "partner", NodeID: "O_partner"}
+	eng := Principal{Kind: KindTeam, Name: "eng", NodeID: "T_eng"}
+	dev := Principal{Kind: KindTeam, Name: "eng/dev", NodeID: "T_dev"}
+	ops := Principal{Kind: KindTeam, Name: "ops", NodeID: "T_ops"}
+	alice := Principal{Kind: KindUser, Name: "alice", NodeID: "U_alice"}
+	bob := Principal{Kind: KindUser, Name: "bob", NodeID: "U_bob"}
+
+	testcases := map[string]struct {
+		users [][]permissionSource
+		opts  NormalizeOptions
+		want  map[Principal]Permission
+	}{
+		"none": {
+			users: nil,
+			want:  map[Principal]Permission{},
+		},
+		"non-owner, own org is dropped": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermWRITE}},
+			},
+			want: map[Principal]Permission{eng: PermWRITE},
+		},
+		"non-owner, direct grant": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {bob, PermMAINTAIN}},
+			},
+			want: map[Principal]Permission{bob: PermMAINTAIN},
+		},
+		"non-owner, ADMIN is not a duplicate": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermADMIN}, {bob, PermADMIN}},
+			},
+			want: map[Principal]Permission{eng: PermADMIN, bob: PermADMIN},
+		},
+		"other org is kept": {
+			users: [][]permissionSource{
+				{{otherOrg, PermREAD}},
+			},
+			want: map[Principal]Permission{otherOrg: PermREAD},
+		},
+		"owner, duplicates are dropped": {
+			users: [][]permissionSource{
+				{{org, PermADMIN}, {eng, PermADMIN}, {alice, PermADMIN}},
+			},
+			want: map[Principal]Permission{},
+		},
+		"owner, duplicates are kept if asked": {
+			users: [][]permissionSource{
+				{{org, PermADMIN}, {eng, PermADMIN}, {alice, PermADMIN}},
+			},
+			opts: NormalizeOptions{KeepOwnerDuplicates: true},
+			want: map[Principal]Permission{eng: PermADMIN, alice: PermADMIN},
+		},
+		"owner, only the first ADMIN from each source is a duplicate": {
+			users: [][]permissionSource{
+				{{org, PermADMIN}, {eng, PermADMIN}, {eng, PermADMIN}, {alice, PermADMIN}},
+			},
+			want: map[Principal]Permission{eng: PermADMIN},
+		},
+		"owner, lesser grants are not duplicates": {
+			users: [][]permissionSource{
+				{{org, PermADMIN}, {eng, PermADMIN}, {ops, PermWRITE}},
+			},
+			want: map[Principal]Permission{ops: PermWRITE},
+		},
+		"owner's duplicate doesn't hide another user's grant": {
+			users: [][]permissionSource{
+				{{org, PermADMIN}, {eng, PermADMIN}},
+				{{org, PermREAD}, {eng, PermADMIN}},
+			},
+			want: map[Principal]Permission{eng: PermADMIN},
+		},
+		"duplicate WRITE then ADMIN, highest wins": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermWRITE}},
+				{{org, PermREAD}, {eng, PermADMIN}},
+			},
+			want: map[Principal]Permission{eng: PermADMIN},
+		},
+		"duplicate ADMIN then WRITE, highest wins": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermADMIN}},
+				{{org, PermREAD}, {eng, PermWRITE}},
+			},
+			want: map[Principal]Permission{eng: PermADMIN},
+		},
+		"duplicate WRITE and ADMIN from one user": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermWRITE}, {eng, PermADMIN}, {eng, PermREAD}},
+			},
+			want: map[Principal]Permission{eng: PermADMIN},
+		},
+		"multiple sources across users": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermREAD}, {dev, PermWRITE}},
+				{{org, PermREAD}, {ops, PermTRIAGE}, {bob, PermWRITE}},
+				{{org, PermADMIN}, {ops, PermADMIN}, {alice, PermADMIN}, {alice, PermADMIN}},
+			},
+			want: map[Principal]Permission{eng: PermREAD, dev: PermWRITE, ops: PermTRIAGE, bob: PermWRITE, alice: PermADMIN},
+		},
+		"child team with the parent's permission is dropped": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermWRITE}, {dev, PermWRITE}},
+			},
+			want: map[Principal]Permission{eng: PermWRITE},
+		},
+		"child team with the parent's permission is kept if asked": {
+			users: [][]permissionSource{
+				{{org, PermREAD}, {eng, PermWRITE}, {dev, PermWRITE}},
+			},
+			opts: NormalizeOptions{KeepChildTeams: true},
+			want: map[Principal]Permission{eng: PermWRITE, dev: PermWRITE},
+		},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got := normalizePermissionSources("acme", tc.users, tc.opts)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCollectOrder(t *testing.T) {
+	// Five repos were last updated on each day, so that sorting by
+	// update time has ties to break.
+	var repos []fakeRepo
+	for i := 0; i < 25; i++ {
+		name := fmt.Sprintf("repo%02d", i)
+		repos = append(repos, fakeRepo{
+			Name:      name,
+			UpdatedAt: time.Date(2026, 1, 1+i%5, 0, 0, 0, 0, time.UTC),
+			Users: []fakeUser{
+				{Login: "alice", Permission: "ADMIN", Sources: []string{"org:acme=ADMIN", "repo:" + name + "=ADMIN"}},
+				{Login: fmt.Sprintf("user%d", i), Permission: "WRITE", Sources: []string{"org:acme=READ", "repo:" + name + "=WRITE"}},
+			},
+		})
+	}
+	var byUpdated, byName []string
+	for day := 4; day >= 0; day-- {
+		for i := day; i < len(repos); i += 5 {
+			byUpdated = append(byUpdated, repos[i].Name)
+		}
+	}
+	for _, repo := range repos {
+		byName = append(byName, repo.Name)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	delays := make(map[string]time.Duration)
+	for _, repo := range repos {
+		delays[repo.Name] = time.Duration(rng.Intn(5)) * time.Millisecond
+	}
+
+	run := func(t *testing.T, repos []fakeRepo, parallel int, sortBy string) []RepoReport {
+		t.Helper()
+		fake := &fakeGitHub{Org: "acme", Repos: repos, Delay: func(reponame string) time.Duration { return delays[reponame] }}
+		fake.start(t)
+		results, total, invisible, err := collect(context.Background(), "acme", Options{Parallel: parallel, SortBy: sortBy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != len(repos) || invisible != 0 {
+			t.Fatalf("got total=%d invisible=%d, want %d and 0", total, invisible, len(repos))
+		}
+		return results
+	}
+	names := func(results []RepoReport) []string {
+		var ret []string
+		for _, result := range results {
+			ret = append(ret, result.Repo.Name)
+		}
+		return ret
+	}
+
+	for sortBy, wantNames := range map[string][]string{"updated": byUpdated, "name": byName} {
+		sortBy, wantNames := sortBy, wantNames
+		t.Run(sortBy, func(t *testing.T) {
+			want := run(t, repos, 1, sortBy)
+			if got := names(want); !reflect.DeepEqual(got, wantNames) {
+				t.Fatalf("with --parallel=1, got %v, want %v", got, wantNames)
+			}
+			for i := 0; i < 5; i++ {
+				shuffled := append([]fakeRepo(nil), repos...)
+				rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+				got := run(t, shuffled, 8, sortBy)
+				if !reflect.DeepEqual(got, want) {
+					var listed []string
+					for _, repo := range shuffled {
+						listed = append(listed, repo.Name)
+					}
+					t.Errorf("with --parallel=8 and the repos listed as %v, got %v, want %v", listed, names(got), wantNames)
+				}
+			}
+		})
+	}
+}
+
+// captureOutput returns what f writes to stdout and to stderr.
+func captureOutput(t *testing.T, f func()) (stdout, stderr string) {
+	t.Helper()
+	capture := func(file **os.File) func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := *file
+		*file = w
+		done := make(chan string)
+		go func() {
+			bs, _ := io.ReadAll(r)
+			done <- string(bs)
+		}()
+		return func() string {
+			*file = old
+			w.Close()
+			return <-done
+		}
+	}
+	finishStdout, finishStderr := capture(&os.Stdout), capture(&os.Stderr)
+	defer func() {
+		stdout, stderr = finishStdout(), finishStderr()
+	}()
+	f()
+	return
+}
+
+func TestEmptyReport(t *testing.T) {
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := fakeRepo{Name: "api", UpdatedAt: updated, Users: []fakeUser{
+		{Login: "alice", Permission: "WRITE", Sources: []string{"org:acme=READ", "team:eng=WRITE"}},
+	}}
+	// Everyone who can see it only gets the org's base permission, so
+	// it has no grants to report.
+	lonely := fakeRepo{Name: "lonely", UpdatedAt: updated, Users: []fakeUser{
+		{Login: "alice", Permission: "READ", Sources: []string{"org:acme=READ"}},
+	}}
+	old := fakeRepo{Name: "old", UpdatedAt: updated, Archived: true, Users: api.Users}
+	nothing, err := parseGrantFilter(`source.kind == "user"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]struct {
+		fake      fakeGitHub
+		opts      Options
+		wantNote  string
+		wantRepos []string
+	}{
+		"no repos": {
+			fake:     fakeGitHub{},
+			wantNote: `"acme" has no repositories, other than any archived ones (see --include-archived)`,
+		},
+		"only archived repos": {
+			fake:     fakeGitHub{Repos: []fakeRepo{old}},
+			wantNote: `"acme" has no repositories, other than any archived ones (see --include-archived)`,
+		},
+		"no visible repos": {
+			fake:     fakeGitHub{HiddenRepos: 3},
+			wantNote: `none of the 3 repositories in "acme" are visible to this token`,
+		},
+		"no repos match --repo": {
+			fake:     fakeGitHub{Repos: []fakeRepo{api, lonely}},
+			opts:     Options{Repos: []string{"web*"}},
+			wantNote: `no repositories in "acme" match --repo and --exclude-repo`,
+		},
+		"--filter matches nothing": {
+			fake:     fakeGitHub{Repos: []fakeRepo{api, lonely}},
+			opts:     Options{Filter: nothing},
+			wantNote: `--filter matches nothing on any of the 2 repositories inspected`,
+		},
+		"repo with no grants": {
+			fake:      fakeGitHub{Repos: []fakeRepo{lonely}},
+			wantRepos: []string{"lonely"},
+		},
+	}
+	// Every writer of the report, and which of the checks below its
+	// output gets.
+	variants := []struct {
+		name string
+		opts Options
+		kind string
+	}{
+		{"table", Options{Format: "table"}, "table"},
+		{"markdown", Options{Format: "markdown"}, "table"},
+		{"html", Options{Format: "html"}, "html"},
+		{"json", Options{Format: "json"}, "json"},
+		{"csv", Options{Format: "csv"}, "csv"},
+		{"cypher", Options{Format: "cypher"}, "cypher"},
+		{"dedupe-acl", Options{Format: "table", DedupeACL: true}, "table"},
+		{"by-user", Options{Format: "table", ByUser: true}, "table"},
+		{"by-user/csv", Options{Format: "csv", ByUser: true}, "csv"},
+		{"by-team", Options{Format: "table", ByTeam: true}, "table"},
+		{"by-team/csv", Options{Format: "csv", ByTeam: true}, "csv"},
+		{"effective", Options{Format: "table", Effective: true}, "table"},
+		{"effective/csv", Options{Format: "csv", Effective: true}, "csv"},
+	}
+	for name, tc := range testcases {
+		for _, variant := range variants {
+			tc, variant := tc, variant
+			t.Run(name+"/"+variant.name, func(t *testing.T) {
+				fake := tc.fake
+				fake.Org = "acme"
+				fake.start(t)
+				opts := tc.opts
+				opts.Sources = []*Bucket{lookupBucket("org"), lookupBucket("team"), lookupBucket("user")}
+				opts.SortBy = "updated"
+				opts.Parallel = 1
+				opts.Format = variant.opts.Format
+				opts.DedupeACL = variant.opts.DedupeACL
+				opts.ByUser = variant.opts.ByUser
+				opts.ByTeam = variant.opts.ByTeam
+				opts.Effective = variant.opts.Effective
+				// Only the plain report lists each repo, whether
+				// or not it has grants.
+				plain := !opts.DedupeACL && !opts.ByUser && !opts.ByTeam && !opts.Effective
+
+				var err error
+				stdout, stderr := captureOutput(t, func() {
+					err = Main(context.Background(), "acme", opts)
+				})
+				if err != nil {
+					t.Fatalf("unexpected error: %v\nstderr:\n%s", err, stderr)
+				}
+
+				// The tables and the page say why they are
+				// empty; the machine-readable formats stay
+				// valid, and it goes to stderr.
+				switch {
+				case tc.wantNote == "" && strings.Contains(stdout+stderr, "nothing to report on"):
+					t.Errorf("unexpected note\nstdout:\n%s\nstderr:\n%s", stdout, stderr)
+				case tc.wantNote == "":
+				case variant.kind == "table":
+					if !strings.Contains(stdout, "NOTE: "+tc.wantNote+"\n") {
+						t.Errorf("stdout doesn't say %q:\n%s", tc.wantNote, stdout)
+					}
+				case variant.kind == "html":
+					if want := `<p class="warning">Note: ` + html.EscapeString(tc.wantNote) + `.</p>`; !strings.Contains(stdout, want) {
+						t.Errorf("page doesn't say %q:\n%s", tc.wantNote, stdout)
+					}
+				default:
+					if strings.Contains(stdout, "NOTE") {
+						t.Errorf("unexpected NOTE on stdout:\n%s", stdout)
+					}
+				}
+				if tc.wantNote != "" && !strings.Contains(stderr, "note: "+tc.wantNote+", so there is nothing to report on\n") {
+					t.Errorf("stderr doesn't say %q:\n%s", tc.wantNote, stderr)
+				}
+
+				switch variant.kind {
+				case "table", "html":
+					if variant.kind == "html" && !strings.HasSuffix(stdout, "</html>\n") {
+						t.Errorf("incomplete page:\n%s", stdout)
+					}
+					if !plain {
+						break
+					}
+					for _, name := range tc.wantRepos {
+						if !strings.Contains(stdout, "https://github.com/acme/"+name) {
+							t.Errorf("%s isn't listed:\n%s", name, stdout)
+						}
+					}
+				case "csv":
+					rows, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+					if err != nil {
+						t.Fatalf("invalid CSV: %v\n%s", err, stdout)
+					}
+					// A repo with no grants has no rows, except
+					// for what the org's base permission gives
+					// each user with --effective.
+					if (tc.wantNote != "" || !opts.Effective) && len(rows) != 1 {
+						t.Errorf("got %q, want just the header", rows)
+					}
+				case "cypher":
+					if !strings.HasPrefix(stdout, `MERGE (:Org {name: "acme"});`) {
+						t.Errorf("got:\n%s", stdout)
+					}
+				case "json":
+					var report struct {
+						Repos []struct {
+							Name   string
+							Grants []interface{}
+						}
+						CoverageVerified bool
+						InvisibleRepos   int
+					}
+					if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+						t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+					}
+					var raw map[string]interface{}
+					_ = json.Unmarshal([]byte(stdout), &raw)
+					if _, ok := raw["repos"].([]interface{}); !ok {
+						t.Errorf("got repos %v, want a list", raw["repos"])
+					}
+					var names []string
+					for _, repo := range report.Repos {
+						names = append(names, repo.Name)
+						if repo.Grants == nil || len(repo.Grants) != 0 {
+							t.Errorf("%s: got grants %v, want []", repo.Name, repo.Grants)
+						}
+					}
+					if !reflect.DeepEqual(names, tc.wantRepos) {
+						t.Errorf("got repos %v, want %v", names, tc.wantRepos)
+					}
+					if !report.CoverageVerified || report.InvisibleRepos != tc.fake.HiddenRepos {
+						t.Errorf("got coverageVerified=%v invisibleRepos=%d, want true and %d",
+							report.CoverageVerified, report.InvisibleRepos, tc.fake.HiddenRepos)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAppToken(t *testing.T) {
+	repos := []fakeRepo{{
+		Name:      "api",
+		UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Users: []fakeUser{
+			{Login: "alice", Permission: "WRITE", Sources: []string{"org:acme=READ", "repo:api=WRITE"}},
+		},
+	}}
+	testcases := map[string]struct {
+		app         fakeInstallation
+		wantRole    string
+		wantWarning string
+	}{
+		"full access": {
+			app:      fakeInstallation{ID: 7, Permissions: map[string]string{"members": "read", "administration": "read", "metadata": "read"}},
+			wantRole: "app",
+		},
+		"limited access": {
+			app:         fakeInstallation{ID: 7, Selected: true, Permissions: map[string]string{"administration": "read", "metadata": "read"}},
+			wantRole:    "limited-app",
+			wantWarning: `WARNING: the token is for fake-app[bot], whose installation in "acme" is only on selected repositories and can't read members, so some repositories, teams, and collaborators may be missing`,
+		},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			app := tc.app
+			fake := &fakeGitHub{Org: "acme", Repos: repos, App: &app}
+			fake.start(t)
+			opts := Options{
+				Sources:  []*Bucket{lookupBucket("org"), lookupBucket("team"), lookupBucket("user")},
+				SortBy:   "updated",
+				Parallel: 1,
+				Format:   "json",
+			}
+			var err error
+			stdout, stderr := captureOutput(t, func() {
+				err = Main(context.Background(), "acme", opts)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr:\n%s", err, stderr)
+			}
+			var report struct {
+				TokenRole string
+				Repos     []struct {
+					Name   string
+					Grants []struct{ Source, Permission string }
+				}
+			}
+			if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+			}
+			if report.TokenRole != tc.wantRole {
+				t.Errorf("got tokenRole %q, want %q", report.TokenRole, tc.wantRole)
+			}
+			if len(report.Repos) != 1 || len(report.Repos[0].Grants) != 1 || report.Repos[0].Grants[0].Source != "alice" {
+				t.Errorf("got repos %+v, want api with alice's grant", report.Repos)
+			}
+			switch {
+			case tc.wantWarning == "" && strings.Contains(stderr, "WARNING"):
+				t.Errorf("unexpected warning:\n%s", stderr)
+			case tc.wantWarning != "" && !strings.Contains(stderr, tc.wantWarning+"\n"):
+				t.Errorf("stderr doesn't say %q:\n%s", tc.wantWarning, stderr)
+			}
+		})
+	}
+}
+
+func TestTeamMembersPagination(t *testing.T) {
+	// More members than fit in getTeamMembership's first page of
+	// them, and then than in one of getTeamMembers's.
+	var members []string
+	for i := 0; i < 250; i++ {
+		members = append(members, fmt.Sprintf("member%03d", i))
+	}
+	fake := &fakeGitHub{
+		Org:     "acme",
+		Members: members,
+		Teams:   []fakeTeam{{Slug: "everyone", Members: members}},
+		Repos: []fakeRepo{{
+			Name:      "api",
+			UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Users: []fakeUser{
+				{Login: "member000", Permission: "WRITE", Sources: []string{"org:acme=READ", "team:everyone=WRITE"}},
+			},
+		}},
+	}
+	for name, opts := range map[string]Options{
+		"by-user":      {ByUser: true},
+		"expand-teams": {ExpandTeams: true},
+	} {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			fake.start(t)
+			opts.Sources = []*Bucket{lookupBucket("org"), lookupBucket("team"), lookupBucket("user")}
+			opts.SortBy = "updated"
+			opts.Parallel = 1
+			opts.Format = "csv"
+			var err error
+			stdout, stderr := captureOutput(t, func() {
+				err = Main(context.Background(), "acme", opts)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr:\n%s", err, stderr)
+			}
+			rows, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+			if err != nil {
+				t.Fatalf("invalid CSV: %v\n%s", err, stdout)
+			}
+			got := make(map[string]bool)
+			for _, row := range rows[1:] {
+				for _, cell := range row {
+					got[cell] = true
+				}
+			}
+			var missing []string
+			for _, login := range members {
+				if !got[login] {
+					missing = append(missing, login)
+				}
+			}
+			if len(missing) > 0 {
+				t.Errorf("%d of %d members are missing, including %s:\n%s", len(missing), len(members), missing[0], stdout)
+			}
+		})
+	}
+}
+
+func TestUnverifiedCoverage(t *testing.T) {
+	repos := []fakeRepo{
+		{Name: "api", UpdatedAt: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Name: "secrets", UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Private: true},
+	}
+	zero := 0
+	testcases := map[string]*fakeGitHub{
+		"missing": {Org: "acme", Repos: repos, HidePrivateCount: true},
+		// Fewer than the token can see, so it can't count the
+		// ones it can't.
+		"too-few": {Org: "acme", Repos: repos, PrivateCount: &zero},
+	}
+	for name, fake := range testcases {
+		fake := fake
+		t.Run(name, func(t *testing.T) {
+			fake.start(t)
+			opts := Options{
+				Sources:  []*Bucket{lookupBucket("org"), lookupBucket("team"), lookupBucket("user")},
+				SortBy:   "updated",
+				Parallel: 1,
+				Format:   "json",
+			}
+			var err error
+			stdout, stderr := captureOutput(t, func() {
+				err = Main(context.Background(), "acme", opts)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr:\n%s", err, stderr)
+			}
+			var raw map[string]interface{}
+			if err := json.Unmarshal([]byte(stdout), &raw); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+			}
+			if raw["coverageVerified"] != false || raw["invisibleRepos"] != nil {
+				t.Errorf("got coverageVerified=%v invisibleRepos=%v, want false and null",
+					raw["coverageVerified"], raw["invisibleRepos"])
+			}
+			if !strings.Contains(stderr, "warning: coverage can't be verified") {
+				t.Errorf("stderr doesn't say that coverage can't be verified:\n%s", stderr)
+			}
+		})
+	}
+}
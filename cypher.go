@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// cypherString quotes str as a Cypher string literal.
+func cypherString(str string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range str {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// writeCypher writes the report as Cypher statements, one per line,
+// that load it in to a graph database such as Neo4j (for example with
+// "cypher-shell -f"):
+//
+//   - an (:Org {name}) node, a (:Repo {org, name}) node per repo,
+//     a (:Team {org, slug}) node per team, and a (:User {login}) node
+//     per user;
+//   - a -[:HAS_PERMISSION {permission}]-> edge from each org, team,
+//     and user to each repo that it has been granted access to;
+//   - a -[:CAN_APPROVE_DEPLOYMENTS {environments}]-> edge for each
+//     deployment approver, if they were collected;
+//   - a -[:MEMBER_OF]-> edge from each user to each team that they are
+//     an immediate member of, and to the org if they are a member of
+//     it, and from each child team to its parent.
+//
+// So a query for the paths that give a user access to a repo is:
+//
+//	MATCH p = (:User {login: "x"})-[:MEMBER_OF*0..]->()-[:HAS_PERMISSION]->(:Repo {name: "y"}) RETURN p
+//
+// Nodes are MERGEd, and each repo's edges and the org's membership
+// edges are deleted before being re-created, so loading a newer report
+// on top of an older one brings the graph up to date.  Only grants
+// that fall in at least one of grouping's buckets are included.
+func writeCypher(w io.Writer, orgname string, results []RepoReport, grouping Grouping, teams teamMembership, members map[string]bool) {
+	org := cypherString(orgname)
+	fmt.Fprintf(w, "MERGE (:Org {name: %s});\n", org)
+
+	// Membership.
+	fmt.Fprintf(w, "MATCH ()-[e:MEMBER_OF]->(:Org {name: %s}) DELETE e;\n", org)
+	fmt.Fprintf(w, "MATCH ()-[e:MEMBER_OF]->(:Team {org: %s}) DELETE e;\n", org)
+	logins := make([]string, 0, len(members))
+	for login := range members {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	for _, login := range logins {
+		fmt.Fprintf(w, "MERGE (u:User {login: %s}) WITH u MATCH (o:Org {name: %s}) MERGE (u)-[:MEMBER_OF]->(o);\n",
+			cypherString(login), org)
+	}
+	slugs := make([]string, 0, len(teams.Members))
+	for slug := range teams.Members {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	for _, slug := range slugs {
+		team := fmt.Sprintf("{org: %s, slug: %s}", org, cypherString(slug))
+		fmt.Fprintf(w, "MERGE (:Team %s);\n", team)
+		if parent, ok := teams.Parents[slug]; ok {
+			fmt.Fprintf(w, "MATCH (t:Team %s) MERGE (p:Team {org: %s, slug: %s}) MERGE (t)-[:MEMBER_OF]->(p);\n",
+				team, org, cypherString(parent))
+		}
+		for _, login := range teams.Members[slug] {
+			fmt.Fprintf(w, "MERGE (u:User {login: %s}) WITH u MATCH (t:Team %s) MERGE (u)-[:MEMBER_OF]->(t);\n",
+				cypherString(login), team)
+		}
+	}
+
+	// Access.
+	for _, result := range results {
+		repo := newJSONRepo(result, grouping)
+		match := fmt.Sprintf("{org: %s, name: %s}", org, cypherString(repo.Name))
+		fmt.Fprintf(w, "MERGE (r:Repo %s) SET r.url = %s, r.visibility = %s, r.license = %s, r.archived = %t;\n",
+			match, cypherString(repo.URL), cypherString(repo.Visibility), cypherString(repo.License), repo.Archived)
+		fmt.Fprintf(w, "MATCH ()-[e:HAS_PERMISSION|CAN_APPROVE_DEPLOYMENTS]->(:Repo %s) DELETE e;\n", match)
+		for _, grant := range repo.Grants {
+			fmt.Fprintf(w, "MERGE (s%s) WITH s MATCH (r:Repo %s) MERGE (s)-[:HAS_PERMISSION {permission: %s}]->(r);\n",
+				cypherNode(orgname, grant.Kind, grant.Source), match, cypherString(grant.Permission.String()))
+		}
+		for _, approver := range repo.DeploymentApprovers {
+			envs := make([]string, 0, len(approver.Environments))
+			for _, env := range approver.Environments {
+				envs = append(envs, cypherString(env))
+			}
+			fmt.Fprintf(w, "MERGE (s%s) WITH s MATCH (r:Repo %s) MERGE (s)-[:CAN_APPROVE_DEPLOYMENTS {environments: [%s]}]->(r);\n",
+				cypherNode(orgname, approver.Kind, approver.Source), match, strings.Join(envs, ", "))
+		}
+	}
+}
+
+// cypherNode returns the label and properties that identify the node
+// for a principal, like `:User {login: "alice"}`.
+func cypherNode(orgname string, kind PrincipalKind, name string) string {
+	switch kind {
+	case KindOrg:
+		return fmt.Sprintf(":Org {name: %s}", cypherString(name))
+	case KindTeam:
+		return fmt.Sprintf(":Team {org: %s, slug: %s}", cypherString(orgname), cypherString(teamSlug(name)))
+	default:
+		return fmt.Sprintf(":User {login: %s}", cypherString(name))
+	}
+}
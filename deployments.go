@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// A PendingEnvironment is a deployment environment with deployments
+// waiting for one of its required reviewers to approve them.
+type PendingEnvironment struct {
+	Repo        string
+	Environment string
+	// Runs is the workflow runs that are waiting, oldest first.
+	Runs []PendingRun
+	// Reviewers is the environment's required reviewers.
+	Reviewers []Principal
+	// Approvers is the logins of everyone who can approve the
+	// deployments: the users among Reviewers, and the members of the
+	// teams among them.
+	Approvers []string
+}
+
+// A PendingRun is a workflow run that is waiting for a deployment to
+// be approved.
+type PendingRun struct {
+	Workflow  string
+	URL       string
+	StartedAt time.Time
+}
+
+// getPendingDeployments returns the environments of repos that have
+// deployments waiting for approval, sorted by how long their oldest
+// run has been waiting.  teams is used to find who can approve on a
+// team's behalf.  This takes a request per repo, and one more per
+// waiting run.  If ctx is cancelled part-way through, it returns the
+// environments that it has found so far along with errInterrupted.
+func getPendingDeployments(ctx context.Context, orgname string, repos []RepoHandle, teamFullnames map[string]string, teams teamMembership) (ret []*PendingEnvironment, err error) {
+	defer func() {
+		sort.Slice(ret, func(i, j int) bool {
+			if !ret[i].Runs[0].StartedAt.Equal(ret[j].Runs[0].StartedAt) {
+				return ret[i].Runs[0].StartedAt.Before(ret[j].Runs[0].StartedAt)
+			}
+			return ret[i].Repo+"/"+ret[i].Environment < ret[j].Repo+"/"+ret[j].Environment
+		})
+	}()
+	teamUsers := teams.Users()
+	for i, repo := range repos {
+		fmt.Fprintf(os.Stderr, "inspecting repo %d/%d %q\n", i, len(repos), repo.Name)
+		byName := make(map[string]*PendingEnvironment)
+		for page := 1; ; page++ {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			var rawRuns struct {
+				TotalCount   int `json:"total_count"`
+				WorkflowRuns []struct {
+					ID        int64     `json:"id"`
+					Name      string    `json:"name"`
+					HTMLURL   string    `json:"html_url"`
+					CreatedAt time.Time `json:"created_at"`
+				} `json:"workflow_runs"`
+			}
+			if err := restGet(ctx, &rawRuns, "/repos/%s/%s/actions/runs?status=waiting&per_page=100&page=%d", orgname, repo.Name, page); err != nil {
+				if ctx.Err() != nil {
+					return ret, errInterrupted
+				}
+				return nil, fmt.Errorf("getPendingDeployments: %q: %w", repo.Name, err)
+			}
+			for _, run := range rawRuns.WorkflowRuns {
+				var rawPending []struct {
+					Environment struct {
+						Name string `json:"name"`
+					} `json:"environment"`
+					Reviewers []struct {
+						Type     string `json:"type"`
+						Reviewer struct {
+							Login string `json:"login"`
+							Slug  string `json:"slug"`
+						} `json:"reviewer"`
+					} `json:"reviewers"`
+				}
+				if err := restGet(ctx, &rawPending, "/repos/%s/%s/actions/runs/%d/pending_deployments", orgname, repo.Name, run.ID); err != nil {
+					if ctx.Err() != nil {
+						return ret, errInterrupted
+					}
+					return nil, fmt.Errorf("getPendingDeployments: %q: run %d: %w", repo.Name, run.ID, err)
+				}
+				for _, pending := range rawPending {
+					env := byName[pending.Environment.Name]
+					if env == nil {
+						env = &PendingEnvironment{Repo: repo.Name, Environment: pending.Environment.Name}
+						byName[env.Environment] = env
+						approvers := make(map[string]bool)
+						for _, reviewer := range pending.Reviewers {
+							switch reviewer.Type {
+							case "User":
+								env.Reviewers = append(env.Reviewers, Principal{Kind: KindUser, Name: reviewer.Reviewer.Login})
+								approvers[reviewer.Reviewer.Login] = true
+							case "Team":
+								env.Reviewers = append(env.Reviewers, Principal{Kind: KindTeam, Name: teamFullnames[reviewer.Reviewer.Slug]})
+								for login := range teamUsers[reviewer.Reviewer.Slug] {
+									approvers[login] = true
+								}
+							}
+						}
+						sortPrincipals(env.Reviewers)
+						for login := range approvers {
+							env.Approvers = append(env.Approvers, login)
+						}
+						sort.Strings(env.Approvers)
+					}
+					env.Runs = append(env.Runs, PendingRun{Workflow: run.Name, URL: run.HTMLURL, StartedAt: run.CreatedAt})
+				}
+			}
+			if len(rawRuns.WorkflowRuns) == 0 || page*100 >= rawRuns.TotalCount {
+				break
+			}
+		}
+		for _, env := range byName {
+			sort.Slice(env.Runs, func(i, j int) bool { return env.Runs[i].StartedAt.Before(env.Runs[j].StartedAt) })
+			ret = append(ret, env)
+		}
+	}
+	return ret, nil
+}
+
+var pendingDeploymentsCommand = &command{
+	Name:    "pending-deployments",
+	Args:    []string{"ORGNAME"},
+	Summary: "List deployments waiting for approval, and who can approve them",
+	Description: `
+Lists each deployment environment that has deployments waiting for one
+of its required reviewers to approve them, longest-waiting first: how
+many workflow runs are waiting, when the oldest one started, and
+everyone who can approve them (the user reviewers, and the members of
+the team reviewers).
+
+This is an availability problem as much as an access one: an
+environment that only one person can approve is stuck whenever that
+person is away.  Environments with fewer than --min-approvers people
+who can approve them are called out on stderr.
+
+It takes a request per non-archived repository, one more per waiting
+run, and a query per 100 teams and per 100 team members.`,
+	Examples: []example{
+		{"List the deployments waiting for approval in the datawire organization.", progName + " pending-deployments datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		minApprovers := fs.Int("min-approvers", 2, "warn about environments that fewer than `N` people can approve deployments to")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			teamFullnames, err := getTeamFullnames(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			teams, err := getTeamMembership(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			repos, invisible, err := getRepos(ctx, orgname, false)
+			if err != nil {
+				return err
+			}
+			sortRepos(repos, "name")
+			envs, err := getPendingDeployments(ctx, orgname, repos, teamFullnames, teams)
+			if err != nil && err != errInterrupted {
+				return err
+			}
+
+			output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(output, "Environment\t| Waiting\t| Oldest run\t| Can approve\n")
+			fmt.Fprintf(output, "-----------\t| -------\t| ----------\t| -----------\n")
+			for _, env := range envs {
+				approvers := strings.Join(env.Approvers, " ")
+				if approvers == "" {
+					approvers = "(nobody)"
+				}
+				fmt.Fprintf(output, "%s/%s\t| %d\t| %s %s\t| %s\n",
+					env.Repo, env.Environment, len(env.Runs), formatDate(env.Runs[0].StartedAt), env.Runs[0].URL, approvers)
+			}
+			output.Flush()
+			for _, env := range envs {
+				if len(env.Approvers) < *minApprovers {
+					var reviewers []string
+					for _, principal := range env.Reviewers {
+						reviewers = append(reviewers, principal.String())
+					}
+					fmt.Fprintf(os.Stderr, "warning: deployments to %s/%s (%d waiting) can be approved by only %d people, fewer than --min-approvers=%d (reviewers: %s)\n",
+						env.Repo, env.Environment, len(env.Runs), len(env.Approvers), *minApprovers, strings.Join(reviewers, " "))
+				}
+			}
+			if err == errInterrupted {
+				fmt.Fprintf(os.Stdout, "PARTIAL REPORT: interrupted after finding %d environments with waiting deployments\n", len(envs))
+				return err
+			}
+			printCoverage(orgname, invisible)
+			return nil
+		}
+	},
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// readModulePaths returns the Go module paths listed in filename,
+// sorted: if it is a go.mod, the modules that it requires (or, if they
+// are replaced by other modules, those), and otherwise one per line,
+// optionally followed by "@version".  Blank lines and lines starting
+// with "#" are ignored.
+func readModulePaths(filename string) ([]string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(content), "\n")
+	isGoMod := filepath.Base(filename) == "go.mod"
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(fields[0], "//") {
+			isGoMod = isGoMod || fields[0] == "module"
+			break
+		}
+	}
+
+	seen := make(map[string]bool)
+	if !isGoMod {
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			path, _, _ := strings.Cut(line, "@")
+			seen[path] = true
+		}
+		return sortedKeys(seen), nil
+	}
+
+	var required []string
+	// replaced maps each replaced module to its replacement, or to
+	// "" if it is replaced by a directory, and so doesn't come from
+	// a repo at all.
+	replaced := make(map[string]string)
+	block := ""
+	for i, line := range lines {
+		if comment := strings.Index(line, "//"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		for j, field := range fields {
+			if unquoted, err := strconv.Unquote(field); err == nil {
+				fields[j] = unquoted
+			}
+		}
+		directive := block
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == ")":
+			block = ""
+			continue
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case block == "":
+			directive, fields = fields[0], fields[1:]
+		}
+		switch directive {
+		case "require":
+			if len(fields) < 1 {
+				return nil, fmt.Errorf("%s:%d: malformed require", filename, i+1)
+			}
+			required = append(required, fields[0])
+		case "replace":
+			arrow := -1
+			for j, field := range fields {
+				if field == "=>" {
+					arrow = j
+				}
+			}
+			if arrow < 1 || arrow+1 >= len(fields) {
+				return nil, fmt.Errorf("%s:%d: malformed replace", filename, i+1)
+			}
+			to := fields[arrow+1]
+			if strings.HasPrefix(to, "./") || strings.HasPrefix(to, "../") || filepath.IsAbs(to) {
+				to = ""
+			}
+			replaced[fields[0]] = to
+		}
+	}
+	for _, path := range required {
+		if to, ok := replaced[path]; ok {
+			path = to
+		}
+		if path != "" {
+			seen[path] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	ret := make([]string, 0, len(set))
+	for key := range set {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// moduleRepo returns the name of the repo in orgname that the module
+// path is in, or "" if it isn't in one of orgname's repos.  Only paths
+// on the GitHub instance itself ("github.com/ORGNAME/REPO/...") are
+// recognized; a vanity import path isn't.
+func moduleRepo(orgname, path string) string {
+	host := apiHostname()
+	if host == "" {
+		host = "github.com"
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 || !strings.EqualFold(parts[0], host) || !strings.EqualFold(parts[1], orgname) {
+		return ""
+	}
+	return parts[2]
+}
+
+// dependencyAccess is the access that one user has to a repo that
+// modules are in.
+type dependencyAccess struct {
+	Repo    string
+	Modules []string
+	User    repoUser
+}
+
+func writeDependencyAccessTable(w io.Writer, rows []dependencyAccess) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Repository\t| Modules\t| User\t| Permission\t| Through\n")
+	fmt.Fprintf(output, "----------\t| -------\t| ----\t| ----------\t| -------\n")
+	for _, row := range rows {
+		fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\t| %s\n",
+			row.Repo, strings.Join(row.Modules, " "), row.User.Login, row.User.Permission, formatRepoUserSources(row.User))
+	}
+	output.Flush()
+}
+
+func writeDependencyAccessCSV(w io.Writer, rows []dependencyAccess) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"repository", "modules", "login", "permission", "through"})
+	for _, row := range rows {
+		_ = output.Write([]string{row.Repo, strings.Join(row.Modules, " "), row.User.Login, row.User.Permission.String(), formatRepoUserSources(row.User)})
+	}
+	output.Flush()
+	return output.Error()
+}
+
+var dependencyAccessCommand = &command{
+	Name:    "dependency-access",
+	Args:    []string{"ORGNAME", "FILE"},
+	Summary: "List who can modify the code of the Go modules that a project imports",
+	Description: `
+For a supply-chain review: lists everyone with at least
+--min-permission (WRITE by default) on each of the organization's
+repositories that the Go modules in FILE come from, as who-has does
+for a single repository.  FILE is a go.mod, whose requirements (after
+any replace directives) are used, or a list of module paths, one per
+line.
+
+Only modules at paths on the GitHub instance in the organization
+("github.com/ORGNAME/REPO/...") are looked at; the rest are counted on
+stderr.  A module behind a vanity import path has to be listed by its
+GitHub path instead.
+
+It takes a query per 100 teams, and a query per 100 collaborators of
+each repository.`,
+	Examples: []example{
+		{"List who can push to the datawire modules that this project imports.", progName + " dependency-access datawire go.mod"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		minPermission := fs.String("min-permission", "WRITE", "only list users with at least this `permission` (READ, TRIAGE, WRITE, MAINTAIN, or ADMIN)")
+		format := fs.String("format", "table", "output format: 'table' or 'csv'")
+		return func(ctx context.Context, args []string) error {
+			orgname, filename := args[0], args[1]
+			var min Permission
+			if err := min.UnmarshalText([]byte(strings.ToUpper(*minPermission))); err != nil || min == PermNONE {
+				return usageErrorf("dependency-access: invalid --min-permission %q (must be READ, TRIAGE, WRITE, MAINTAIN, or ADMIN)", *minPermission)
+			}
+			if *format != "table" && *format != "csv" {
+				return usageErrorf("dependency-access: invalid --format %q (must be 'table' or 'csv')", *format)
+			}
+			paths, err := readModulePaths(filename)
+			if err != nil {
+				return err
+			}
+			modules := make(map[string][]string)
+			var repos []string
+			outside := 0
+			for _, path := range paths {
+				repo := moduleRepo(orgname, path)
+				if repo == "" {
+					outside++
+					continue
+				}
+				if modules[repo] == nil {
+					repos = append(repos, repo)
+				}
+				modules[repo] = append(modules[repo], path)
+			}
+			sort.Strings(repos)
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			teamFullnames, err := getTeamFullnames(ctx, orgname)
+			if err != nil {
+				return err
+			}
+
+			var rows []dependencyAccess
+			users := make(map[string]bool)
+			inspected := 0
+			for i, repo := range repos {
+				if ctx.Err() != nil {
+					err = errInterrupted
+					break
+				}
+				fmt.Fprintf(os.Stderr, "inspecting repo %d/%d %s\n", i, len(repos), repo)
+				var all []repoUser
+				var count collaboratorCount
+				all, count, err = getRepoUsers(ctx, teamFullnames, orgname, repo)
+				if err != nil {
+					if ctx.Err() != nil {
+						err = errInterrupted
+						break
+					}
+					return err
+				}
+				if count.Total != count.Returned {
+					fmt.Fprintf(os.Stderr, "warning: %s: GitHub says there are %d collaborators, but returned %d; the list may be missing some\n",
+						repo, count.Total, count.Returned)
+				}
+				var repoRows []dependencyAccess
+				for _, user := range all {
+					if user.Permission >= min {
+						repoRows = append(repoRows, dependencyAccess{Repo: repo, Modules: modules[repo], User: user})
+						users[user.Login] = true
+					}
+				}
+				sort.SliceStable(repoRows, func(i, j int) bool {
+					a, b := repoRows[i].User, repoRows[j].User
+					if a.Permission != b.Permission {
+						return a.Permission > b.Permission
+					}
+					return strings.ToLower(a.Login) < strings.ToLower(b.Login)
+				})
+				rows = append(rows, repoRows...)
+				inspected++
+			}
+
+			partialOutput := os.Stdout
+			if *format == "csv" {
+				if err := writeDependencyAccessCSV(os.Stdout, rows); err != nil {
+					return err
+				}
+				partialOutput = os.Stderr
+			} else {
+				writeDependencyAccessTable(os.Stdout, rows)
+			}
+			if err == errInterrupted {
+				fmt.Fprintf(partialOutput, "PARTIAL REPORT: interrupted after %d of %d repositories\n", inspected, len(repos))
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%d users have at least %s on the %d %s repositories that %d of the %d modules come from; %d modules from elsewhere were skipped\n",
+				len(users), min, len(repos), orgname, len(paths)-outside, len(paths), outside)
+			return nil
+		}
+	},
+}
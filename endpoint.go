@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// graphqlURL and restURL are where the GitHub API is; they are only
+// changed (by setAPIURL) for GitHub Enterprise Server.
+var (
+	graphqlURL = "https://api.github.com/graphql"
+	restURL    = "https://api.github.com"
+)
+
+// setAPIURL points graphqlURL at apiURL, or if that is empty, at the
+// GitHub Enterprise Server instance host (as in the gh CLI's GH_HOST),
+// if that isn't empty or github.com.  restURL is pointed at the
+// matching REST API: on GHES that is /api/v3, next to /api/graphql.
+func setAPIURL(apiURL, host string) error {
+	what := "--api-url"
+	if apiURL == "" {
+		if host == "" || host == "github.com" {
+			return nil
+		}
+		apiURL, what = "https://"+host+"/api/graphql", "GH_HOST"
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || !strings.HasSuffix(u.Path, "/graphql") {
+		return fmt.Errorf("invalid %s: %q is not a GraphQL endpoint like https://github.example.com/api/graphql", what, apiURL)
+	}
+	graphqlURL = apiURL
+	restURL = strings.TrimSuffix(apiURL, "/graphql")
+	if strings.HasSuffix(restURL, "/api") {
+		restURL += "/v3"
+	}
+	return nil
+}
+
+// apiHostname returns the hostname of the GitHub instance that the API
+// calls go to, in the form that "gh --hostname" takes, or "" for
+// github.com.
+func apiHostname() string {
+	u, err := url.Parse(graphqlURL)
+	if err != nil || u.Host == "api.github.com" {
+		return ""
+	}
+	return u.Host
+}
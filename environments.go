@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A grant's capability is what it lets the principal do.  An ordinary
+// grant gives access to the repository at some Permission; a required
+// reviewer of a deployment environment can approve (or reject)
+// deployments to it, whether or not they have any other access to the
+// repository.
+const (
+	CapabilityAccess             = "access"
+	CapabilityDeploymentApprover = "deployment-approver"
+)
+
+// getDeploymentApprovers returns the users and teams that are required
+// reviewers of a repo's deployment environments, each mapped to the
+// (sorted) names of the environments that they can approve deployments
+// to.
+func getDeploymentApprovers(ctx context.Context, teamFullnames map[string]string, orgname, reponame string) (map[Principal][]string, error) {
+	query := `
+query getDeploymentApprovers($orgname: String!, $reponame: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    repository(name: $reponame) {
+      environments(first: $pageSize, after: $cursor) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          name
+          protectionRules(first: 10) {
+            nodes {
+              type
+              reviewers(first: 10) {
+                nodes {
+                  ... on User {
+                    login
+                    id
+                  }
+                  ... on Team {
+                    slug
+                    id
+                  }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+	var rawEnvs struct {
+		Organization struct {
+			Repository struct {
+				Environments struct {
+					PageInfo struct {
+						HasNextPage bool
+						EndCursor   string
+					}
+					Nodes []struct {
+						Name            string
+						ProtectionRules struct {
+							Nodes []struct {
+								Type      string
+								Reviewers struct {
+									Nodes []struct {
+										Login string
+										Slug  string
+										ID    string
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname":  orgname,
+		"reponame": reponame,
+	}
+	ret := make(map[Principal][]string)
+	for args["cursor"] == nil || rawEnvs.Organization.Repository.Environments.PageInfo.HasNextPage {
+		// As in getRepoUsers, don't decode in to the previous
+		// page's nodes: a reviewer is a User or a Team, and a Team
+		// would keep the Login of the User before it.
+		rawEnvs.Organization.Repository.Environments.Nodes = nil
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawEnvs, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, fmt.Errorf("getDeploymentApprovers: %q: %w", reponame, err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawEnvs.Organization.Repository.Environments.PageInfo.EndCursor
+
+		for _, env := range rawEnvs.Organization.Repository.Environments.Nodes {
+			for _, rule := range env.ProtectionRules.Nodes {
+				if rule.Type != "REQUIRED_REVIEWERS" {
+					continue
+				}
+				for _, reviewer := range rule.Reviewers.Nodes {
+					var principal Principal
+					switch {
+					case reviewer.Login != "":
+						principal = Principal{Kind: KindUser, Name: reviewer.Login, NodeID: reviewer.ID}
+					case reviewer.Slug != "":
+						principal = Principal{Kind: KindTeam, Name: teamFullnames[reviewer.Slug], NodeID: reviewer.ID}
+					default:
+						continue
+					}
+					ret[principal] = append(ret[principal], env.Name)
+				}
+			}
+		}
+	}
+	for principal := range ret {
+		sort.Strings(ret[principal])
+	}
+	return ret, nil
+}
+
+// sortedApprovers returns the principals in approvers, sorted by kind
+// and then name.
+func sortedApprovers(approvers map[Principal][]string) []Principal {
+	ret := make([]Principal, 0, len(approvers))
+	for principal := range approvers {
+		ret = append(ret, principal)
+	}
+	sortPrincipals(ret)
+	return ret
+}
+
+// formatDeploymentApprovers returns a human-readable form of a repo's
+// deployment approvers that fall in at least one of grouping's buckets,
+// as "KIND:NAME=ENV,ENV" items.
+func formatDeploymentApprovers(approvers map[Principal][]string, grouping Grouping) string {
+	var items []string
+	for principal, envs := range approvers {
+		if grouping.Matches(principal) {
+			items = append(items, fmt.Sprintf("%s=%s", principal, strings.Join(envs, ",")))
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, " ")
+}
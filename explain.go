@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// getPermissionSources returns login's effective permission on a
+// repo, and every reason that the API gives for it, without
+// normalizePermissionSources's dedupe, or nil if they have no access.
+// The sources only ever say READ, WRITE, or ADMIN, so the effective
+// permission may be more than any of them (say, MAINTAIN).
+func getPermissionSources(ctx context.Context, teamFullnames map[string]string, orgname, reponame, login string) (Permission, []permissionSource, error) {
+	// The query argument matches logins (and names) by prefix, so
+	// there may be more than the one user.
+	query := `
+query getPermissionSources($orgname: String!, $reponame: String!, $login: String!) {
+  organization(login: $orgname) {
+    repository(name: $reponame) {
+      collaborators(first: 100, query: $login) {
+        edges {
+          node {
+            login
+            id
+          }
+          permission
+          permissionSources {
+            permission
+            source {
+              ... on Organization {
+                org: login
+                id
+              }
+              ... on Repository {
+                repo: name
+              }
+              ... on Team {
+                team: slug
+                id
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+	var rawRepo struct {
+		Organization struct {
+			Repository *struct {
+				Collaborators struct {
+					Edges []struct {
+						Node struct {
+							Login string
+							ID    string
+						}
+						Permission        Permission
+						PermissionSources []struct {
+							Permission Permission
+							Source     struct {
+								ID   string
+								Org  string
+								Repo string
+								Team string
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	err := graphql(ctx, &rawRepo, query, map[string]interface{}{
+		"orgname":  orgname,
+		"reponame": reponame,
+		"login":    login,
+	})
+	if err != nil {
+		return PermNONE, nil, fmt.Errorf("getPermissionSources: %w", err)
+	}
+	if rawRepo.Organization.Repository == nil {
+		return PermNONE, nil, fmt.Errorf("getPermissionSources: no repository %s/%s", orgname, reponame)
+	}
+	for _, userInfo := range rawRepo.Organization.Repository.Collaborators.Edges {
+		if !strings.EqualFold(userInfo.Node.Login, login) {
+			continue
+		}
+		var sources []permissionSource
+		for _, source := range userInfo.PermissionSources {
+			var principal Principal
+			switch {
+			case source.Source.Org != "":
+				principal = Principal{Kind: KindOrg, Name: source.Source.Org, NodeID: source.Source.ID}
+			case source.Source.Team != "":
+				principal = Principal{Kind: KindTeam, Name: teamFullnames[source.Source.Team], NodeID: source.Source.ID}
+			case source.Source.Repo != "":
+				principal = Principal{Kind: KindUser, Name: userInfo.Node.Login, NodeID: userInfo.Node.ID}
+			}
+			sources = append(sources, permissionSource{Principal: principal, Permission: source.Permission})
+		}
+		return userInfo.Permission, sources, nil
+	}
+	return PermNONE, nil, nil
+}
+
+// explainSource says why a permission source applies to login: for a
+// team, which of the teams that they are an immediate member of it
+// comes through.  teamFullnames maps each team's slug to its full
+// name, and slugs the other way.
+func explainSource(source permissionSource, orgname, login string, teams teamMembership, teamFullnames, slugs map[string]string) string {
+	switch source.Principal.Kind {
+	case KindOrg:
+		if source.Principal.Name != orgname {
+			return "organization"
+		}
+		if source.Permission == PermADMIN {
+			return "org owner"
+		}
+		return "org member, through the base permission"
+	case KindUser:
+		return "granted directly on the repository"
+	}
+	team := slugs[source.Principal.Name]
+	var through []string
+	for slug, members := range teams.Members {
+		isMember := false
+		for _, member := range members {
+			isMember = isMember || strings.EqualFold(member, login)
+		}
+		if !isMember {
+			continue
+		}
+		for tip := slug; tip != ""; tip = teams.Parents[tip] {
+			if tip == team {
+				through = append(through, slug)
+				break
+			}
+		}
+	}
+	sort.Strings(through)
+	switch {
+	case len(through) == 0:
+		// The team's members changed between the two queries.
+		return "team member, by GitHub's account"
+	case len(through) == 1 && through[0] == team:
+		return "team member"
+	}
+	var names []string
+	for _, slug := range through {
+		names = append(names, teamFullnames[slug])
+	}
+	return "member of child team " + strings.Join(names, ", ")
+}
+
+var explainCommand = &command{
+	Name:    "explain",
+	Args:    []string{"LOGIN", "ORGNAME/REPO"},
+	Summary: "Explain why a user has access to a repository",
+	Description: `
+Lists every source of one user's access to one repository, as GitHub
+reports it: their role in the organization (its base permission, or
+owner), each team that they get it through (saying which child team
+they are actually a member of), and any grant directly to them.  It
+includes the sources that the report leaves out as duplicates, marking
+each one that the report does show.  Above them is the permission that
+GitHub says that they end up with, which may be more than any of the
+sources say: they only ever say READ, WRITE, or ADMIN, even for
+someone with TRIAGE or MAINTAIN.
+
+It takes a query for the sources, a query per 100 of the repository's
+collaborators to find what the report would show, and a query per 100
+teams and per 100 team members to find the teams that they get access
+through.`,
+	Examples: []example{
+		{"Explain why alice has access to datawire/telepresence.", progName + " explain alice datawire/telepresence"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return func(ctx context.Context, args []string) error {
+			login := args[0]
+			orgname, reponame, ok := strings.Cut(args[1], "/")
+			if !ok || orgname == "" || reponame == "" || strings.Contains(reponame, "/") {
+				return usageErrorf("explain: invalid repository %q (must be 'ORGNAME/REPO')", args[1])
+			}
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			teamList, err := getTeams(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			teamFullnames := make(map[string]string, len(teamList))
+			slugs := make(map[string]string, len(teamList))
+			for _, team := range teamList {
+				teamFullnames[team.Slug] = team.Fullname
+				slugs[team.Fullname] = team.Slug
+			}
+			effective, sources, err := getPermissionSources(ctx, teamFullnames, orgname, reponame, login)
+			if err != nil {
+				return err
+			}
+			if sources == nil {
+				fmt.Fprintf(os.Stdout, "%s has no access to %s/%s\n", login, orgname, reponame)
+				return nil
+			}
+			teams, err := getTeamMembership(ctx, orgname)
+			if err != nil {
+				return err
+			}
+
+			sort.SliceStable(sources, func(i, j int) bool {
+				a, b := sources[i].Principal, sources[j].Principal
+				if a.Kind != b.Kind {
+					return a.Kind < b.Kind
+				}
+				return a.Name < b.Name
+			})
+			reported, _, _, err := getCollaborators(ctx, teamFullnames, orgname, reponame, NormalizeOptions{})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "%s has %s on %s/%s:\n\n", login, effective, orgname, reponame)
+			output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(output, "Source\t| Permission\t| Why\t| In report\n")
+			fmt.Fprintf(output, "------\t| ----------\t| ---\t| ---------\n")
+			for _, source := range sources {
+				inReport := "no"
+				if perm, ok := reported[source.Principal]; ok && perm == source.Permission {
+					inReport = "yes"
+				}
+				fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\n", source.Principal, source.Permission,
+					explainSource(source, orgname, login, teams, teamFullnames, slugs), inReport)
+			}
+			output.Flush()
+			return nil
+		}
+	},
+}
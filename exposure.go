@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// PagesSite is a GitHub Pages site published from one of the
+// organization's repositories.
+type PagesSite struct {
+	Repo string
+	URL  string
+	// Public is false for a Pages site that is only visible to
+	// people with read access to the repository (an Enterprise
+	// Cloud feature).
+	Public bool
+}
+
+// getPagesSites returns every GitHub Pages site published from a
+// repository in an organization.  The GraphQL API doesn't say which
+// repos have Pages, so this uses the REST API.
+func getPagesSites(ctx context.Context, orgname string) ([]PagesSite, error) {
+	var names []string
+	for page := 1; ; page++ {
+		if ctx.Err() != nil {
+			return nil, errInterrupted
+		}
+		var rawRepos []struct {
+			Name     string `json:"name"`
+			HasPages bool   `json:"has_pages"`
+		}
+		if err := restGet(ctx, &rawRepos, "/orgs/%s/repos?per_page=100&page=%d", orgname, page); err != nil {
+			if ctx.Err() != nil {
+				return nil, errInterrupted
+			}
+			return nil, fmt.Errorf("getPagesSites: %w", err)
+		}
+		for _, repo := range rawRepos {
+			if repo.HasPages {
+				names = append(names, repo.Name)
+			}
+		}
+		if len(rawRepos) < 100 {
+			break
+		}
+	}
+
+	var ret []PagesSite
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ret, errInterrupted
+		}
+		var rawPages struct {
+			HTMLURL string `json:"html_url"`
+			Public  *bool  `json:"public"`
+		}
+		if err := restGet(ctx, &rawPages, "/repos/%s/%s/pages", orgname, name); err != nil {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			return nil, fmt.Errorf("getPagesSites: %q: %w", name, err)
+		}
+		ret = append(ret, PagesSite{
+			Repo: name,
+			URL:  rawPages.HTMLURL,
+			// Only orgs that can have private Pages sites get told
+			// whether a site is public.
+			Public: rawPages.Public == nil || *rawPages.Public,
+		})
+	}
+	return ret, nil
+}
+
+// MemberGist is a public gist of an organization member's that
+// mentions the organization.
+type MemberGist struct {
+	Owner       string
+	URL         string
+	Description string
+	UpdatedAt   time.Time
+	// MatchedIn is where the organization's name was found: the
+	// description, or the name of the file whose name or content
+	// mentions it.
+	MatchedIn string
+}
+
+// getMemberGists returns the public gists of an organization's members
+// that mention the organization's name (case-insensitively) in their
+// description, file names, or file contents.  Only each member's 100
+// most recently updated gists are looked at; truncated is the number of
+// members who have more than that.
+func getMemberGists(ctx context.Context, orgname string) (gists []MemberGist, truncated int, err error) {
+	query := `
+query getMemberGists($orgname: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    membersWithRole(first: $pageSize, after: $cursor) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        login
+        gists(first: 100, privacy: PUBLIC, orderBy: {field: UPDATED_AT, direction: DESC}) {
+          totalCount
+          nodes {
+            url
+            description
+            updatedAt
+            files(limit: 10) {
+              name
+              text
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+	var rawMembers struct {
+		Organization struct {
+			MembersWithRole struct {
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+				Nodes []struct {
+					Login string
+					Gists struct {
+						TotalCount int
+						Nodes      []struct {
+							URL         string
+							Description string
+							UpdatedAt   time.Time
+							Files       []struct {
+								Name string
+								Text string
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+	}
+	needle := strings.ToLower(orgname)
+	for args["cursor"] == nil || rawMembers.Organization.MembersWithRole.PageInfo.HasNextPage {
+		if ctx.Err() != nil {
+			return gists, truncated, errInterrupted
+		}
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawMembers, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return gists, truncated, errInterrupted
+			}
+			return nil, 0, fmt.Errorf("getMemberGists: %w", err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawMembers.Organization.MembersWithRole.PageInfo.EndCursor
+
+		for _, member := range rawMembers.Organization.MembersWithRole.Nodes {
+			if member.Gists.TotalCount > len(member.Gists.Nodes) {
+				truncated++
+			}
+			for _, gist := range member.Gists.Nodes {
+				matchedIn := ""
+				if strings.Contains(strings.ToLower(gist.Description), needle) {
+					matchedIn = "description"
+				}
+				for _, file := range gist.Files {
+					if matchedIn != "" {
+						break
+					}
+					if strings.Contains(strings.ToLower(file.Name), needle) || strings.Contains(strings.ToLower(file.Text), needle) {
+						matchedIn = file.Name
+					}
+				}
+				if matchedIn == "" {
+					continue
+				}
+				gists = append(gists, MemberGist{
+					Owner:       member.Login,
+					URL:         gist.URL,
+					Description: gist.Description,
+					UpdatedAt:   gist.UpdatedAt,
+					MatchedIn:   matchedIn,
+				})
+			}
+		}
+	}
+	return gists, truncated, nil
+}
+
+var exposureCommand = &command{
+	Name:    "exposure",
+	Args:    []string{"ORGNAME"},
+	Summary: "List places outside the organization's repositories where its code or content may be exposed",
+	Description: `
+Lists the GitHub Pages sites published from the organization's
+repositories (including the ORGNAME.github.io site), and the public
+gists of the organization's members that mention the organization's
+name in their description, file names, or file contents.
+
+Neither is covered by repository access grants, so neither shows up in
+the main report.  Only each member's 100 most recently updated public
+gists, and the first 10 files of each, are searched; --gists=false
+skips the gist search entirely, which is by far the slower half.`,
+	Examples: []example{
+		{"List Pages sites and mentioning gists for the datawire organization.", progName + " exposure datawire"},
+		{"List just the Pages sites.", progName + " exposure --gists=false datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		withPages := fs.Bool("pages", true, "list GitHub Pages sites published from the organization's repositories")
+		withGists := fs.Bool("gists", true, "search members' public gists for mentions of the organization")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+
+			if *withPages {
+				sites, err := getPagesSites(ctx, orgname)
+				if err != nil && err != errInterrupted {
+					return err
+				}
+				sort.Slice(sites, func(i, j int) bool { return sites[i].Repo < sites[j].Repo })
+				output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+				fmt.Fprintf(output, "Pages site\t| Repository\t| Visibility\n")
+				fmt.Fprintf(output, "----------\t| ----------\t| ----------\n")
+				for _, site := range sites {
+					visibility := "public"
+					if !site.Public {
+						visibility = "private"
+					}
+					fmt.Fprintf(output, "%s\t| %s\t| %s\n", site.URL, site.Repo, visibility)
+				}
+				output.Flush()
+				if err == errInterrupted {
+					fmt.Fprintf(os.Stdout, "PARTIAL REPORT: interrupted after %d Pages sites\n", len(sites))
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "%d GitHub Pages sites\n", len(sites))
+			}
+
+			if *withGists {
+				if *withPages {
+					fmt.Fprintf(os.Stdout, "\n")
+				}
+				gists, truncated, err := getMemberGists(ctx, orgname)
+				if err != nil && err != errInterrupted {
+					return err
+				}
+				sort.Slice(gists, func(i, j int) bool {
+					if gists[i].Owner != gists[j].Owner {
+						return gists[i].Owner < gists[j].Owner
+					}
+					return gists[i].URL < gists[j].URL
+				})
+				output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+				fmt.Fprintf(output, "Gist URL\t| Owner\t| Updated\t| Matched in\t| Description\n")
+				fmt.Fprintf(output, "--------\t| -----\t| -------\t| ----------\t| -----------\n")
+				for _, gist := range gists {
+					fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\t| %s\n",
+						gist.URL, gist.Owner, formatDate(gist.UpdatedAt), gist.MatchedIn, gist.Description)
+				}
+				output.Flush()
+				if err == errInterrupted {
+					fmt.Fprintf(os.Stdout, "PARTIAL REPORT: interrupted after finding %d gists\n", len(gists))
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "%d member gists mention %q\n", len(gists), orgname)
+				if truncated > 0 {
+					fmt.Fprintf(os.Stderr, "warning: %d members have more than 100 public gists; only the most recent 100 of each were searched\n", truncated)
+				}
+			}
+			return nil
+		}
+	},
+}
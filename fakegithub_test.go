@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGitHub is just enough of the GitHub API for collect and Main to
+// run against: one org, its repos, and who has access to them.
+type fakeGitHub struct {
+	Org     string
+	Members []string
+	Teams   []fakeTeam
+	Repos   []fakeRepo
+	// HiddenRepos is how many more repos the org has than it lists,
+	// as if the token couldn't see them.
+	HiddenRepos int
+	// PrivateCount, if set, is what the org says its private repo
+	// count is, rather than the true one; HidePrivateCount leaves it
+	// out, as GitHub does for most tokens but an owner's.
+	PrivateCount     *int
+	HidePrivateCount bool
+	// Delay, if set, returns how long to take to answer a
+	// getRepoUsers query for a repo, to shuffle the order that
+	// parallel requests finish in.
+	Delay func(reponame string) time.Duration
+	// App, if set, is an installation of a GitHub App in the org,
+	// and the API calls are made as it, as with --app-id.
+	App *fakeInstallation
+}
+
+// fakeInstallation is a GitHub App's installation in the fake's org.
+type fakeInstallation struct {
+	ID       int64
+	Selected bool // only on selected repositories, rather than all
+	// Permissions is the installation's, as the REST API has them:
+	// say, {"members": "read"}.
+	Permissions map[string]string
+}
+
+// fakeInstallationToken is the token that the fake hands out for its
+// app's installation, and expects every API call to be made with.
+const fakeInstallationToken = "fake-installation-token"
+
+type fakeTeam struct {
+	Slug   string
+	Parent string // the parent team's slug, if any
+	// Members is the team's immediate members.
+	Members []string
+}
+
+type fakeRepo struct {
+	Name      string
+	UpdatedAt time.Time
+	Archived  bool
+	Private   bool
+	Users     []fakeUser
+}
+
+// fakeUser is a user with access to a repo, with their effective
+// permission and the sources of it, each as "kind:name=PERMISSION"
+// (say, "org:acme=READ", "team:eng=WRITE", or "repo:api=ADMIN").
+type fakeUser struct {
+	Login      string
+	Permission string
+	Sources    []string
+}
+
+// start starts the fake, and points the API calls at it until the
+// test is over.
+func (f *fakeGitHub) start(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	oldGraphQLURL, oldRestURL, oldToken, oldChecked, oldApp := graphqlURL, restURL, githubToken, tokenChecked, githubApp
+	graphqlURL, restURL, githubToken, tokenChecked = srv.URL+"/graphql", srv.URL, "fake-token", true
+	if f.App != nil {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		githubToken, githubApp = "", &appAuth{id: "1", key: key}
+	}
+	t.Cleanup(func() {
+		srv.Close()
+		graphqlURL, restURL, githubToken, tokenChecked, githubApp = oldGraphQLURL, oldRestURL, oldToken, oldChecked, oldApp
+	})
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasPrefix(r.URL.Path, "/app/") {
+		f.serveApp(w, r)
+		return
+	}
+	if f.App != nil && r.Header.Get("Authorization") != "bearer "+fakeInstallationToken {
+		http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/orgs/"+f.Org:
+		public, private := 0, f.HiddenRepos
+		for _, repo := range f.Repos {
+			if repo.Private {
+				private++
+			} else {
+				public++
+			}
+		}
+		if f.PrivateCount != nil {
+			private = *f.PrivateCount
+		}
+		rawOrg := map[string]interface{}{
+			"login":               f.Org,
+			"public_repos":        public,
+			"total_private_repos": private,
+		}
+		if f.HidePrivateCount {
+			delete(rawOrg, "total_private_repos")
+		}
+		_ = json.NewEncoder(w).Encode(rawOrg)
+	case r.Method == http.MethodPost && r.URL.Path == "/graphql":
+		var req struct {
+			OperationName string
+			Variables     map[string]interface{}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := f.respond(req.OperationName, req.Variables)
+		if err != nil {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": []interface{}{map[string]interface{}{"message": err.Error()}},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveApp answers the REST API calls that a GitHub App makes as
+// itself, to find its installation and get a token for it.
+func (f *fakeGitHub) serveApp(w http.ResponseWriter, r *http.Request) {
+	if f.App == nil || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, `{"message": "A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+		return
+	}
+	type obj = map[string]interface{}
+	installation := obj{
+		"id":                   f.App.ID,
+		"app_slug":             "fake-app",
+		"account":              obj{"login": f.Org},
+		"repository_selection": "all",
+		"permissions":          f.App.Permissions,
+	}
+	if f.App.Selected {
+		installation["repository_selection"] = "selected"
+	}
+	prefix := fmt.Sprintf("/app/installations/%d", f.App.ID)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/app/installations":
+		_ = json.NewEncoder(w).Encode([]obj{installation})
+	case r.Method == http.MethodGet && r.URL.Path == prefix:
+		_ = json.NewEncoder(w).Encode(installation)
+	case r.Method == http.MethodPost && r.URL.Path == prefix+"/access_tokens":
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(obj{
+			"token":      fakeInstallationToken,
+			"expires_at": time.Now().Add(time.Hour),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// page returns the items of a connection that the variables ask for,
+// along with its pageInfo.
+func page(n int, variables map[string]interface{}) (start, end int, pageInfo map[string]interface{}) {
+	if cursor, ok := variables["cursor"].(string); ok {
+		start, _ = strconv.Atoi(cursor)
+	}
+	end = start + int(variables["pageSize"].(float64))
+	if end > n {
+		end = n
+	}
+	return start, end, map[string]interface{}{
+		"hasNextPage": end < n,
+		"endCursor":   strconv.Itoa(end),
+	}
+}
+
+func (f *fakeGitHub) respond(op string, variables map[string]interface{}) (interface{}, error) {
+	if orgname, ok := variables["orgname"]; ok && orgname != f.Org {
+		return nil, fmt.Errorf("no organization %q", orgname)
+	}
+	type obj = map[string]interface{}
+	switch op {
+	case "getViewerRole":
+		if f.App != nil {
+			// As GitHub does: an app has no viewer.
+			return nil, fmt.Errorf("Resource not accessible by integration")
+		}
+		return obj{
+			"viewer":       obj{"login": "tester"},
+			"organization": obj{"viewerIsAMember": true, "viewerCanAdminister": true},
+		}, nil
+	case "getTeams", "getTeamMembership":
+		start, end, pageInfo := page(len(f.Teams), variables)
+		nodes := []obj{}
+		for _, team := range f.Teams[start:end] {
+			node := obj{"slug": team.Slug, "privacy": "VISIBLE", "parentTeam": nil}
+			if team.Parent != "" {
+				node["parentTeam"] = obj{"slug": team.Parent}
+			}
+			if op == "getTeamMembership" {
+				// The query asks for the first 100.
+				_, end, pageInfo := page(len(team.Members), map[string]interface{}{"pageSize": float64(100)})
+				members := []obj{}
+				for _, login := range team.Members[:end] {
+					members = append(members, obj{"login": login})
+				}
+				node["members"] = obj{"pageInfo": pageInfo, "nodes": members}
+			}
+			nodes = append(nodes, node)
+		}
+		return obj{"organization": obj{"teams": obj{"pageInfo": pageInfo, "nodes": nodes}}}, nil
+	case "getTeamMembers":
+		for _, team := range f.Teams {
+			if team.Slug != variables["slug"] {
+				continue
+			}
+			start, end, pageInfo := page(len(team.Members), variables)
+			members := []obj{}
+			for _, login := range team.Members[start:end] {
+				members = append(members, obj{"login": login})
+			}
+			return obj{"organization": obj{"team": obj{"members": obj{"pageInfo": pageInfo, "nodes": members}}}}, nil
+		}
+		return obj{"organization": obj{"team": nil}}, nil
+	case "getOrgMembers":
+		start, end, pageInfo := page(len(f.Members), variables)
+		nodes := []obj{}
+		for _, login := range f.Members[start:end] {
+			nodes = append(nodes, obj{"login": login})
+		}
+		return obj{"organization": obj{"membersWithRole": obj{"pageInfo": pageInfo, "nodes": nodes}}}, nil
+	case "getRepos":
+		start, end, pageInfo := page(len(f.Repos), variables)
+		nodes := []obj{}
+		for _, repo := range f.Repos[start:end] {
+			nodes = append(nodes, obj{
+				"id":         "R_" + repo.Name,
+				"name":       repo.Name,
+				"url":        "https://github.com/" + f.Org + "/" + repo.Name,
+				"updatedAt":  repo.UpdatedAt,
+				"isArchived": repo.Archived,
+				"visibility": "PRIVATE",
+			})
+		}
+		return obj{"organization": obj{"repositories": obj{"pageInfo": pageInfo, "nodes": nodes}}}, nil
+	case "getRepoUsers":
+		var repo *fakeRepo
+		for i := range f.Repos {
+			if f.Repos[i].Name == variables["reponame"] {
+				repo = &f.Repos[i]
+			}
+		}
+		if repo == nil {
+			return nil, fmt.Errorf("no repository %q", variables["reponame"])
+		}
+		if f.Delay != nil {
+			time.Sleep(f.Delay(repo.Name))
+		}
+		start, end, pageInfo := page(len(repo.Users), variables)
+		edges := []obj{}
+		for _, user := range repo.Users[start:end] {
+			sources := []obj{}
+			for _, source := range user.Sources {
+				kindName, perm, _ := strings.Cut(source, "=")
+				kind, name, _ := strings.Cut(kindName, ":")
+				sources = append(sources, obj{
+					"permission": perm,
+					"source":     obj{kind: name, "id": kind + "_" + name},
+				})
+			}
+			edges = append(edges, obj{
+				"node":              obj{"login": user.Login, "id": "U_" + user.Login},
+				"permission":        user.Permission,
+				"permissionSources": sources,
+			})
+		}
+		return obj{"organization": obj{"repository": obj{"collaborators": obj{
+			"pageInfo":   pageInfo,
+			"totalCount": len(repo.Users),
+			"edges":      edges,
+		}}}}, nil
+	}
+	return nil, fmt.Errorf("fake GitHub: unknown operation %q", op)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// grantFilter is a --filter expression: a Starlark expression that is
+// evaluated once per grant, and decides whether that grant is kept.
+// It can refer to:
+//
+//	repo        .name, .url, .visibility, .license, .is_fork, .is_template,
+//	            .is_archived
+//	source      .kind ("org", "team", or "user") and .name
+//	permission  the permission, comparable with NONE, READ, TRIAGE,
+//	            WRITE, MAINTAIN, and ADMIN
+//	capability  "access", or "deployment-approver" for a required
+//	            reviewer of a deployment environment
+//	environment the environment, for a deployment approver
+//
+// A deployment approver is evaluated once per environment, with
+// whatever permission they have been granted on the repo (if any).
+type grantFilter struct {
+	expr syntax.Expr
+}
+
+func parseGrantFilter(src string) (*grantFilter, error) {
+	expr, err := (&syntax.FileOptions{}).ParseExpr("--filter", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	f := &grantFilter{expr: expr}
+	// Try it out on a made-up grant, so that a typo is reported
+	// now rather than after the whole org has been inspected.
+	_, err = f.Apply([]RepoReport{{
+		Repo:          RepoHandle{Name: "example", Visibility: "PRIVATE"},
+		Collaborators: map[Principal]Permission{{Kind: KindUser, Name: "example"}: PermREAD},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Apply returns the grants (and deployment approvers) in results that
+// the filter keeps.  If results have their Users, each user is left
+// with the sources of their access that the filter keeps, as though
+// each were a grant, and with the permission that
+// repoUser.withSources gives them.  Repos
+// that are left with nothing are dropped.
+func (f *grantFilter) Apply(results []RepoReport) ([]RepoReport, error) {
+	env := starlark.StringDict{}
+	for perm := Permission(PermNONE); perm <= PermADMIN; perm++ {
+		env[perm.String()] = starlark.MakeInt(int(perm))
+	}
+	thread := &starlark.Thread{Name: "--filter"}
+
+	var ret []RepoReport
+	for _, result := range results {
+		env["repo"] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"name":        starlark.String(result.Repo.Name),
+			"url":         starlark.String(result.Repo.URL),
+			"visibility":  starlark.String(result.Repo.Visibility),
+			"license":     starlark.String(result.Repo.License),
+			"is_fork":     starlark.Bool(result.Repo.IsFork),
+			"is_template": starlark.Bool(result.Repo.IsTemplate),
+			"is_archived": starlark.Bool(result.Repo.IsArchived),
+		})
+		eval := func(principal Principal, perm Permission, capability, environment string) (bool, error) {
+			env["source"] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+				"kind": starlark.String(principal.Kind),
+				"name": starlark.String(principal.Name),
+			})
+			env["permission"] = starlark.MakeInt(int(perm))
+			env["capability"] = starlark.String(capability)
+			env["environment"] = starlark.String(environment)
+			val, err := starlark.EvalExprOptions(&syntax.FileOptions{}, thread, f.expr, env)
+			if err != nil {
+				return false, fmt.Errorf("--filter: %s: %w", result.Repo.Name, err)
+			}
+			keep, ok := val.(starlark.Bool)
+			if !ok {
+				return false, fmt.Errorf("--filter: expression must be true or false, not a %s", val.Type())
+			}
+			return bool(keep), nil
+		}
+
+		kept := make(map[Principal]Permission)
+		for principal, perm := range result.Collaborators {
+			keep, err := eval(principal, perm, CapabilityAccess, "")
+			if err != nil {
+				return nil, err
+			}
+			if keep {
+				kept[principal] = perm
+			}
+		}
+		var keptApprovers map[Principal][]string
+		if result.DeploymentApprovers != nil {
+			keptApprovers = make(map[Principal][]string)
+			for principal, envs := range result.DeploymentApprovers {
+				for _, envName := range envs {
+					keep, err := eval(principal, result.Collaborators[principal], CapabilityDeploymentApprover, envName)
+					if err != nil {
+						return nil, err
+					}
+					if keep {
+						keptApprovers[principal] = append(keptApprovers[principal], envName)
+					}
+				}
+			}
+		}
+		var keptUsers []repoUser
+		if result.Users != nil {
+			keptUsers = []repoUser{}
+			for _, user := range result.Users {
+				var keptSources []permissionSource
+				for _, source := range user.Sources {
+					keep, err := eval(source.Principal, source.Permission, CapabilityAccess, "")
+					if err != nil {
+						return nil, err
+					}
+					if keep {
+						keptSources = append(keptSources, source)
+					}
+				}
+				if len(keptSources) > 0 {
+					keptUsers = append(keptUsers, user.withSources(keptSources))
+				}
+			}
+		}
+		if len(kept) > 0 || len(keptApprovers) > 0 || len(keptUsers) > 0 {
+			ret = append(ret, RepoReport{Repo: result.Repo, Collaborators: kept, DeploymentApprovers: keptApprovers, Users: keptUsers})
+		}
+	}
+	return ret, nil
+}
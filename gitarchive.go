@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// git runs a git command in dir, returning its stdout.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.String(), nil
+}
+
+// writeArchiveTSV writes the report as tab-separated values, with a
+// header line and then one line per repo.  Unlike writeTable's output,
+// a change to one repo's grants never changes any other line, so diffs
+// stay small.
+func writeArchiveTSV(w io.Writer, results []RepoReport, grouping Grouping, withApprovers bool) {
+	header := []string{"Repository URL"}
+	for _, b := range grouping.Buckets {
+		header = append(header, b.Title)
+	}
+	if withApprovers {
+		header = append(header, "Deployment approvers")
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(header, "\t"))
+	for _, result := range results {
+		row := []string{result.Repo.URL}
+		for _, b := range grouping.Buckets {
+			row = append(row, grouping.Format(result.Collaborators, b))
+		}
+		if withApprovers {
+			row = append(row, formatDeploymentApprovers(result.DeploymentApprovers, grouping))
+		}
+		fmt.Fprintf(w, "%s\n", strings.Join(row, "\t"))
+	}
+}
+
+// archiveRows maps each repo URL in a report written by
+// writeArchiveTSV to its row.
+func archiveRows(tsv string) map[string]string {
+	rows := make(map[string]string)
+	for i, line := range strings.Split(tsv, "\n") {
+		if i == 0 || line == "" {
+			continue
+		}
+		rows[strings.SplitN(line, "\t", 2)[0]] = line
+	}
+	return rows
+}
+
+// writeGitArchive writes the report for an org to ORGNAME.tsv in the
+// git repository dir (creating the repository if need be), and
+// commits it with a message summarizing which repos' grants changed.
+// The archived report is always one line per repo, sorted by name, so
+// that successive commits diff cleanly whatever format was printed to
+// stdout.
+//
+// dir must be the top of its repository, rather than somewhere inside
+// another one, and only the report is committed, whatever else has
+// been staged.
+func writeGitArchive(dir, orgname string, results []RepoReport, grouping Grouping, withApprovers bool) error {
+	if toplevel, err := git(dir, "rev-parse", "--show-toplevel"); err != nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if _, err := git(dir, "init", "--quiet"); err != nil {
+			return err
+		}
+	} else if !sameDir(dir, strings.TrimSpace(toplevel)) {
+		return fmt.Errorf("%s is inside the git repository %s rather than the top of its own; give a directory that is either, or that isn't in a repository", dir, strings.TrimSpace(toplevel))
+	}
+
+	sorted := append([]RepoReport(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Repo.Name < sorted[j].Repo.Name })
+	var buf bytes.Buffer
+	// Whatever was printed, the archive always uses the API's names,
+	// so that switching --ui-names on or off doesn't show up as a
+	// change.
+	grouping.UINames = false
+	writeArchiveTSV(&buf, sorted, grouping, withApprovers)
+
+	filename := orgname + ".tsv"
+	path := filepath.Join(dir, filename)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	// Compare against what was last committed, rather than what is
+	// in the file, in case an earlier commit failed.
+	old, err := git(dir, "show", "HEAD:./"+filename)
+	if err != nil {
+		old = ""
+	}
+	if old == buf.String() {
+		fmt.Fprintf(os.Stderr, "git archive: no changes to %s\n", path)
+		return nil
+	}
+
+	oldRows, newRows := archiveRows(old), archiveRows(buf.String())
+	var added, removed, changed []string
+	for url, row := range newRows {
+		oldRow, ok := oldRows[url]
+		switch {
+		case !ok:
+			added = append(added, url)
+		case oldRow != row:
+			changed = append(changed, url)
+		}
+	}
+	for url := range oldRows {
+		if _, ok := newRows[url]; !ok {
+			removed = append(removed, url)
+		}
+	}
+	var msg strings.Builder
+	if len(old) == 0 {
+		fmt.Fprintf(&msg, "%s: initial report (%d repos)\n", orgname, len(newRows))
+	} else {
+		fmt.Fprintf(&msg, "%s: %d repos added, %d removed, %d changed\n", orgname, len(added), len(removed), len(changed))
+		for _, list := range []struct {
+			Title string
+			URLs  []string
+		}{
+			{"Added", added},
+			{"Removed", removed},
+			{"Changed", changed},
+		} {
+			if len(list.URLs) == 0 {
+				continue
+			}
+			sort.Strings(list.URLs)
+			fmt.Fprintf(&msg, "\n%s:\n", list.Title)
+			for _, url := range list.URLs {
+				fmt.Fprintf(&msg, "  %s\n", url)
+			}
+		}
+	}
+
+	if _, err := git(dir, "add", "--", filename); err != nil {
+		return err
+	}
+	commitArgs := []string{"commit", "--quiet", "-m", msg.String(), "--", filename}
+	if email, _ := git(dir, "config", "user.email"); strings.TrimSpace(email) == "" {
+		// Running from cron on a machine that nobody has set up
+		// git on shouldn't stop the history from being kept.
+		commitArgs = append([]string{"-c", "user.name=" + progName, "-c", "user.email=" + progName + "@localhost"}, commitArgs...)
+	}
+	if _, err := git(dir, commitArgs...); err != nil {
+		return err
+	}
+	summary := strings.SplitN(msg.String(), "\n", 2)[0]
+	fmt.Fprintf(os.Stderr, "git archive: committed %s: %s\n", path, summary)
+	return nil
+}
+
+// sameDir returns whether a and b are the same directory, once they
+// are made absolute and their symlinks are resolved, as git's are.
+func sameDir(a, b string) bool {
+	resolve := func(path string) string {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			path = real
+		}
+		return filepath.Clean(path)
+	}
+	return resolve(a) == resolve(b)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteGitArchive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	grouping := Grouping{Buckets: []*Bucket{lookupBucket("user")}}
+	results := []RepoReport{{
+		Repo:          RepoHandle{Name: "api", URL: "https://github.com/acme/api"},
+		Collaborators: map[Principal]Permission{{Kind: KindUser, Name: "alice"}: PermWRITE},
+	}}
+	mustGit := func(t *testing.T, dir string, args ...string) string {
+		t.Helper()
+		out, err := git(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@localhost"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	t.Run("new repository", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "history")
+		if err := writeGitArchive(dir, "acme", results, grouping, false); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustGit(t, dir, "show", "HEAD:acme.tsv"); !strings.Contains(got, "https://github.com/acme/api\talice=WRITE\n") {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("only the report is committed", func(t *testing.T) {
+		dir := t.TempDir()
+		mustGit(t, dir, "init", "--quiet")
+		if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("work in progress\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mustGit(t, dir, "add", "notes.txt")
+		if err := writeGitArchive(dir, "acme", results, grouping, false); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustGit(t, dir, "show", "--name-only", "--format=", "HEAD"); got != "acme.tsv\n" {
+			t.Errorf("committed %q, want just acme.tsv", got)
+		}
+		if got := mustGit(t, dir, "diff", "--cached", "--name-only"); got != "notes.txt\n" {
+			t.Errorf("left %q staged, want notes.txt", got)
+		}
+	})
+
+	t.Run("inside another repository", func(t *testing.T) {
+		outer := t.TempDir()
+		mustGit(t, outer, "init", "--quiet")
+		dir := filepath.Join(outer, "history")
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		err := writeGitArchive(dir, "acme", results, grouping, false)
+		if err == nil || !strings.Contains(err.Error(), "is inside the git repository") {
+			t.Errorf("got error %v, want one about being inside another repository", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "acme.tsv")); !os.IsNotExist(err) {
+			t.Errorf("the report was written anyway")
+		}
+	})
+}
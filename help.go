@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// progName is what the program is called in help text and man pages.
+const progName = "collaborators"
+
+// An example is an example invocation of a command, for its help text
+// and man page.
+type example struct {
+	Description string
+	Command     string
+}
+
+// A command is the declarative description of a subcommand.  Its
+// --help output, the 'help' subcommand, and its man page are all
+// generated from this, so that they can't drift apart from each other
+// or from the flags that the command actually accepts.
+type command struct {
+	Name string
+	// Args is the names of the positional arguments that the command
+	// takes; optional arguments are written in [brackets], and the
+	// last may be followed by "..." if it can be repeated.
+	Args    []string
+	Summary string
+	// Description is one or more paragraphs, separated by blank
+	// lines.
+	Description string
+	Examples    []example
+
+	// Setup registers the command's flags on fs, and returns the
+	// function to run (with the positional arguments) once fs has
+	// been parsed.
+	Setup func(fs *flag.FlagSet) func(ctx context.Context, args []string) error
+}
+
+// commands is the list of every subcommand, in the order that they
+// are listed in help text.  The first one is the default, run if no
+// subcommand is named.  It is set in init(), because the help and man
+// commands refer to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		reportCommand,
+		explainCommand,
+		whoHasCommand,
+		dependencyAccessCommand,
+		outsideCommand,
+		teamsCommand,
+		membersCommand,
+		settingsCommand,
+		archiveCandidatesCommand,
+		actionsCommand,
+		pendingDeploymentsCommand,
+		exposureCommand,
+		checkCommand,
+		snapshotCommand,
+		diffCommand,
+		simulateCommand,
+		campaignCommand,
+		invitationsCommand,
+		helpCommand,
+		manCommand,
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func (cmd *command) synopsis() string {
+	parts := []string{progName, cmd.Name, "[flags]"}
+	if cmd == commands[0] {
+		parts[1] = "[" + cmd.Name + "]"
+	}
+	return strings.Join(append(parts, cmd.Args...), " ")
+}
+
+// checkArgs returns a usageError if args is the wrong number of
+// positional arguments for cmd.  An argument whose name ends in "..."
+// (like "[ORGNAME...]") may be repeated, so only if it is last.
+func (cmd *command) checkArgs(args []string) error {
+	min := 0
+	variadic := false
+	for _, arg := range cmd.Args {
+		if !strings.HasPrefix(arg, "[") {
+			min++
+		}
+		variadic = strings.HasSuffix(strings.TrimSuffix(arg, "]"), "...")
+	}
+	if len(args) < min || (!variadic && len(args) > len(cmd.Args)) {
+		return usageErrorf("%s: expected arguments %s, got %d argument(s)\nUsage: %s",
+			cmd.Name, strings.Join(cmd.Args, " "), len(args), cmd.synopsis())
+	}
+	return nil
+}
+
+// flagSet returns the FlagSet for cmd, along with the function that
+// will run cmd once the FlagSet has been parsed.
+func (cmd *command) flagSet() (*flag.FlagSet, func(ctx context.Context, args []string) error) {
+	fs := newFlagSet(progName + " " + cmd.Name)
+	run := cmd.Setup(fs)
+	fs.Usage = func() {
+		printHelp(fs.Output(), cmd, fs)
+	}
+	return fs, run
+}
+
+func printHelp(w io.Writer, cmd *command, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s\n\n", cmd.synopsis())
+	fmt.Fprintf(w, "%s\n\n", cmd.Summary)
+	if cmd.Description != "" {
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(cmd.Description))
+	}
+	if cmd == commands[0] {
+		fmt.Fprintf(w, "Commands:\n")
+		width := 0
+		for _, other := range commands {
+			if len(other.Name) > width {
+				width = len(other.Name)
+			}
+		}
+		for _, other := range commands {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, other.Name, other.Summary)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, "Flags:\n")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	if len(cmd.Examples) > 0 {
+		fmt.Fprintf(w, "\nExamples:\n")
+		for _, ex := range cmd.Examples {
+			fmt.Fprintf(w, "  %s\n      $ %s\n", ex.Description, ex.Command)
+		}
+	}
+}
+
+var helpCommand = &command{
+	Name:    "help",
+	Args:    []string{"[COMMAND]"},
+	Summary: "Show detailed help for a command",
+	Examples: []example{
+		{"Show help for the outside-collaborator inventory.", progName + " help outside"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return func(_ context.Context, args []string) error {
+			cmd := commands[0]
+			if len(args) > 0 {
+				if cmd = lookupCommand(args[0]); cmd == nil {
+					return usageErrorf("help: unknown command %q", args[0])
+				}
+			}
+			cmdFS, _ := cmd.flagSet()
+			printHelp(os.Stdout, cmd, cmdFS)
+			return nil
+		}
+	},
+}
+
+var manCommand = &command{
+	Name:    "man",
+	Summary: "Write man pages for every command",
+	Description: `
+Writes a man page for each command in to the output directory:
+collaborators.1 for the program as a whole, and
+collaborators-COMMAND.1 for each command.`,
+	Examples: []example{
+		{"Install the man pages for the current user.", progName + " man --dir ~/.local/share/man/man1"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		dir := fs.String("dir", ".", "directory to write the man pages in to")
+		return func(_ context.Context, _ []string) error {
+			if err := os.MkdirAll(*dir, 0o755); err != nil {
+				return err
+			}
+			write := func(filename string, cmd *command, overview bool) error {
+				var buf strings.Builder
+				cmdFS, _ := cmd.flagSet()
+				writeManPage(&buf, cmd, cmdFS, overview)
+				filename = filepath.Join(*dir, filename)
+				if err := os.WriteFile(filename, []byte(buf.String()), 0o644); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "wrote %s\n", filename)
+				return nil
+			}
+			if err := write(progName+".1", commands[0], true); err != nil {
+				return err
+			}
+			for _, cmd := range commands {
+				if err := write(progName+"-"+cmd.Name+".1", cmd, false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	},
+}
+
+// roffEscape escapes text for use in a roff document.
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeManPage writes a man(7) page for cmd.  If overview is set, the
+// page is for the program as a whole rather than for just the one
+// command, and lists the other commands.
+func writeManPage(w io.Writer, cmd *command, fs *flag.FlagSet, overview bool) {
+	name := progName
+	if !overview {
+		name += "-" + cmd.Name
+	}
+	fmt.Fprintf(w, ".TH %s 1 \"\" \"%s\" \"User Commands\"\n", strings.ToUpper(roffEscape(name)), progName)
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", roffEscape(name), roffEscape(cmd.Summary))
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B %s\n", roffEscape(cmd.synopsis()))
+
+	fmt.Fprintf(w, ".SH DESCRIPTION\n")
+	fmt.Fprintf(w, "%s\n", roffEscape(cmd.Summary+"."))
+	for _, para := range strings.Split(strings.TrimSpace(cmd.Description), "\n\n") {
+		if para != "" {
+			fmt.Fprintf(w, ".PP\n%s\n", roffEscape(para))
+		}
+	}
+
+	if overview {
+		fmt.Fprintf(w, ".SH COMMANDS\n")
+		for _, other := range commands {
+			fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(other.Name), roffEscape(other.Summary))
+		}
+	}
+
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	if len(flags) > 0 {
+		fmt.Fprintf(w, ".SH OPTIONS\n")
+		for _, f := range flags {
+			argName, usage := flag.UnquoteUsage(f)
+			fmt.Fprintf(w, ".TP\n\\fB\\-\\-%s\\fR", roffEscape(f.Name))
+			if argName != "" {
+				fmt.Fprintf(w, " \\fI%s\\fR", roffEscape(argName))
+			}
+			fmt.Fprintf(w, "\n%s", roffEscape(usage))
+			if f.DefValue != "" && f.DefValue != "false" {
+				fmt.Fprintf(w, " (default: %s)", roffEscape(f.DefValue))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+	}
+
+	if len(cmd.Examples) > 0 {
+		fmt.Fprintf(w, ".SH EXAMPLES\n")
+		for _, ex := range cmd.Examples {
+			fmt.Fprintf(w, ".PP\n%s\n.PP\n.RS\n.nf\n$ %s\n.fi\n.RE\n", roffEscape(ex.Description), roffEscape(ex.Command))
+		}
+	}
+
+	fmt.Fprintf(w, ".SH SEE ALSO\n")
+	var seeAlso []string
+	if !overview {
+		seeAlso = append(seeAlso, `\fB`+progName+`\fR(1)`)
+	}
+	for _, other := range commands {
+		if other != cmd || overview {
+			seeAlso = append(seeAlso, `\fB`+roffEscape(progName+"-"+other.Name)+`\fR(1)`)
+		}
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(seeAlso, ",\n"))
+}
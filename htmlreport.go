@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// htmlReport is what --format=html renders: a single self-contained
+// page, with a table each of repos, of users, and of teams, for
+// auditors who won't read a terminal or a CSV file.  Unlike
+// --html-site, it is one file that can be attached to an email or a
+// ticket, so it is meant for orgs of a size where one page is still
+// usable.
+type htmlReport struct {
+	Org         string
+	GeneratedAt time.Time
+	Complete    bool
+	Caveat      string
+	// Empty says why there is nothing to report on, if there isn't.
+	Empty  string
+	CSS    template.CSS
+	Script template.JS
+
+	// Columns are the headings of the repo table after the repo's
+	// own.
+	Columns []string
+	Repos   []htmlRepoRow
+	Users   []htmlAccessRow
+	Teams   []htmlAccessRow
+}
+
+type htmlRepoRow struct {
+	Name     string
+	URL      string
+	Archived bool
+	Cells    []string
+}
+
+// htmlAccessRow is a row of the user or team table: one user's or
+// team's access to one repo.
+type htmlAccessRow struct {
+	Name       string
+	Href       string
+	Note       string // like "secret", for a team
+	Repo       string // empty for a team with no repos
+	RepoURL    string
+	Permission string
+	Level      int // for sorting by permission rather than by name
+	Through    []string
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>GitHub access report for {{.Org}}</title>
+<style>{{.CSS}}</style>
+</head>
+<body>
+<h1>GitHub access report for {{.Org}}</h1>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}: {{len .Repos}} repositories, {{len .Users}} user grants, and {{len .Teams}} team grants.</p>
+{{if not .Complete}}<p class="warning">This report is incomplete: the run was interrupted before every repository had been inspected.</p>
+{{end}}{{if .Caveat}}<p class="warning">Note: {{.Caveat}}.</p>
+{{end}}{{if .Empty}}<p class="warning">Note: {{.Empty}}.</p>
+{{end}}
+<section>
+<h2>Repositories</h2>
+<input type="search" placeholder="Filter repositories">
+<table>
+<thead><tr><th>Repository</th>{{range .Columns}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Repos}}<tr><td><a href="{{.URL}}">{{.Name}}</a>{{if .Archived}} (archived){{end}}</td>{{range .Cells}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</section>
+
+<section>
+<h2>Users</h2>
+<input type="search" placeholder="Filter users">
+<table>
+<thead><tr><th>User</th><th>Repository</th><th>Permission</th><th>Through</th></tr></thead>
+<tbody>
+{{range .Users}}{{template "access" .}}{{end}}</tbody>
+</table>
+</section>
+
+<section>
+<h2>Teams</h2>
+<input type="search" placeholder="Filter teams">
+<table>
+<thead><tr><th>Team</th><th>Repository</th><th>Permission</th><th>Privacy</th></tr></thead>
+<tbody>
+{{range .Teams}}{{template "access" .}}{{end}}</tbody>
+</table>
+</section>
+<script>{{.Script}}</script>
+</body>
+</html>
+{{define "access"}}<tr><td>{{if .Href}}<a href="{{.Href}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td>{{if .Repo}}<a href="{{.RepoURL}}">{{.Repo}}</a>{{else}}(no repositories){{end}}</td><td data-sort="{{.Level}}">{{.Permission}}</td><td>{{.Note}}{{range $i, $via := .Through}}{{if $i}}, {{end}}{{$via}}{{end}}</td></tr>
+{{end}}`))
+
+const htmlReportCSS = siteCSS + `body { max-width: none; }
+th { cursor: pointer; user-select: none; }
+th[aria-sort=ascending]::after { content: " \25B2"; }
+th[aria-sort=descending]::after { content: " \25BC"; }
+section input { margin: 0.5em 0; padding: 0.3em; width: 20em; }
+.warning { background: #fff3cd; padding: 0.5em; }
+`
+
+// htmlReportJS filters each table's rows by what is typed in the box
+// above it, and sorts them by whichever column heading is clicked.
+const htmlReportJS = `(function () {
+  var sections = document.querySelectorAll("section");
+  Array.prototype.forEach.call(sections, function (section) {
+    var table = section.querySelector("table");
+    var body = table.tBodies[0];
+    var rows = Array.prototype.slice.call(body.rows);
+    section.querySelector("input").addEventListener("input", function (ev) {
+      var q = ev.target.value.trim().toLowerCase();
+      rows.forEach(function (row) {
+        row.hidden = q !== "" && row.textContent.toLowerCase().indexOf(q) < 0;
+      });
+    });
+    var headings = table.tHead.rows[0].cells;
+    Array.prototype.forEach.call(headings, function (th, col) {
+      th.addEventListener("click", function () {
+        var asc = th.getAttribute("aria-sort") !== "ascending";
+        Array.prototype.forEach.call(headings, function (other) {
+          other.removeAttribute("aria-sort");
+        });
+        th.setAttribute("aria-sort", asc ? "ascending" : "descending");
+        rows.sort(function (a, b) {
+          var x = a.cells[col].getAttribute("data-sort") || a.cells[col].textContent;
+          var y = b.cells[col].getAttribute("data-sort") || b.cells[col].textContent;
+          return (asc ? 1 : -1) * x.localeCompare(y, undefined, {numeric: true});
+        });
+        rows.forEach(function (row) {
+          body.appendChild(row);
+        });
+      });
+    });
+  });
+})();
+`
+
+// writeHTML writes the report as a standalone HTML page; see
+// htmlReport.  users and teams are the report pivoted by user and by
+// team, as from pivotByUser and pivotByTeam.  empty is why there is
+// nothing to report on, if there isn't; see emptyReason.
+func writeHTML(w io.Writer, orgname string, results []RepoReport, grouping Grouping, users []*userRepoAccess, teams []teamRepoAccess,
+	showLicense, showApprovers, complete bool, caveat, empty string, generatedAt time.Time,
+) error {
+	report := htmlReport{
+		Org:         orgname,
+		GeneratedAt: generatedAt,
+		Complete:    complete,
+		Caveat:      caveat,
+		Empty:       empty,
+		CSS:         template.CSS(htmlReportCSS),
+		Script:      template.JS(htmlReportJS),
+	}
+	if showLicense {
+		report.Columns = append(report.Columns, "License")
+	}
+	for _, b := range grouping.Buckets {
+		report.Columns = append(report.Columns, b.Title)
+	}
+	if showApprovers {
+		report.Columns = append(report.Columns, "Deployment approvers")
+	}
+	for _, result := range results {
+		row := htmlRepoRow{Name: result.Repo.Name, URL: result.Repo.URL, Archived: result.Repo.IsArchived}
+		if showLicense {
+			row.Cells = append(row.Cells, formatLicense(result.Repo.License))
+		}
+		for _, b := range grouping.Buckets {
+			row.Cells = append(row.Cells, grouping.Format(result.Collaborators, b))
+		}
+		if showApprovers {
+			row.Cells = append(row.Cells, formatDeploymentApprovers(result.DeploymentApprovers, grouping))
+		}
+		report.Repos = append(report.Repos, row)
+	}
+	for _, access := range users {
+		row := htmlAccessRow{
+			Name:       access.Login,
+			Href:       githubUserURL(access.Login),
+			Repo:       access.Repo.Name,
+			RepoURL:    access.Repo.URL,
+			Permission: permissionName(access.Permission, grouping.UINames),
+			Level:      int(access.Permission),
+		}
+		for _, principal := range sortedPrincipals(access.Sources) {
+			row.Through = append(row.Through, fmt.Sprintf("%s (%s)", principal, permissionName(access.Sources[principal], grouping.UINames)))
+		}
+		report.Users = append(report.Users, row)
+	}
+	for _, access := range teams {
+		row := htmlAccessRow{
+			Name:    access.Team,
+			Note:    "visible",
+			Repo:    access.Repo.Name,
+			RepoURL: access.Repo.URL,
+		}
+		if access.Secret {
+			row.Note = "secret"
+		}
+		if access.Repo.Name != "" {
+			row.Permission = permissionName(access.Permission, grouping.UINames)
+			row.Level = int(access.Permission)
+		}
+		report.Teams = append(report.Teams, row)
+	}
+	return htmlReportTemplate.Execute(w, report)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// An Invitation is a pending invitation to join an organization, or to
+// collaborate on one of its repositories.
+type Invitation struct {
+	ID int64
+	// Repo is empty for an invitation to the organization itself.
+	Repo string
+	// Invitee is the login of who was invited, or their email address
+	// if they were invited to the organization by email.
+	Invitee   string
+	Inviter   string
+	Role      string
+	CreatedAt time.Time
+}
+
+// getOrgInvitations returns the pending invitations to join an
+// organization.  The GraphQL API doesn't say when they were sent, so
+// this uses the REST API.
+func getOrgInvitations(ctx context.Context, orgname string) ([]Invitation, error) {
+	var ret []Invitation
+	for page := 1; ; page++ {
+		if ctx.Err() != nil {
+			return ret, errInterrupted
+		}
+		var rawInvitations []struct {
+			ID        int64     `json:"id"`
+			Login     string    `json:"login"`
+			Email     string    `json:"email"`
+			Role      string    `json:"role"`
+			CreatedAt time.Time `json:"created_at"`
+			Inviter   struct {
+				Login string `json:"login"`
+			} `json:"inviter"`
+		}
+		if err := restGet(ctx, &rawInvitations, "/orgs/%s/invitations?per_page=100&page=%d", orgname, page); err != nil {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			return nil, fmt.Errorf("getOrgInvitations: %w", err)
+		}
+		for _, inv := range rawInvitations {
+			invitee := inv.Login
+			if invitee == "" {
+				invitee = inv.Email
+			}
+			ret = append(ret, Invitation{
+				ID:        inv.ID,
+				Invitee:   invitee,
+				Inviter:   inv.Inviter.Login,
+				Role:      inv.Role,
+				CreatedAt: inv.CreatedAt,
+			})
+		}
+		if len(rawInvitations) < 100 {
+			return ret, nil
+		}
+	}
+}
+
+// getRepoInvitations returns the pending invitations to collaborate on
+// each of repos.
+func getRepoInvitations(ctx context.Context, orgname string, repos []RepoHandle) ([]Invitation, error) {
+	var ret []Invitation
+	for i, repo := range repos {
+		fmt.Fprintf(os.Stderr, "inspecting repo %d/%d %q\n", i, len(repos), repo.Name)
+		for page := 1; ; page++ {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			var rawInvitations []struct {
+				ID          int64     `json:"id"`
+				Permissions string    `json:"permissions"`
+				CreatedAt   time.Time `json:"created_at"`
+				Invitee     struct {
+					Login string `json:"login"`
+				} `json:"invitee"`
+				Inviter struct {
+					Login string `json:"login"`
+				} `json:"inviter"`
+			}
+			if err := restGet(ctx, &rawInvitations, "/repos/%s/%s/invitations?per_page=100&page=%d", orgname, repo.Name, page); err != nil {
+				if ctx.Err() != nil {
+					return ret, errInterrupted
+				}
+				return nil, fmt.Errorf("getRepoInvitations: %q: %w", repo.Name, err)
+			}
+			for _, inv := range rawInvitations {
+				ret = append(ret, Invitation{
+					ID:        inv.ID,
+					Repo:      repo.Name,
+					Invitee:   inv.Invitee.Login,
+					Inviter:   inv.Inviter.Login,
+					Role:      inv.Permissions,
+					CreatedAt: inv.CreatedAt,
+				})
+			}
+			if len(rawInvitations) < 100 {
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+// cancelInvitation cancels a pending invitation.
+func cancelInvitation(ctx context.Context, orgname string, inv Invitation) error {
+	if inv.Repo == "" {
+		if err := restDelete(ctx, "/orgs/%s/invitations/%d", orgname, inv.ID); err != nil {
+			return fmt.Errorf("cancelInvitation: %s: %w", inv.Invitee, err)
+		}
+		return nil
+	}
+	if err := restDelete(ctx, "/repos/%s/%s/invitations/%d", orgname, inv.Repo, inv.ID); err != nil {
+		return fmt.Errorf("cancelInvitation: %s: %q: %w", inv.Invitee, inv.Repo, err)
+	}
+	return nil
+}
+
+var invitationsCommand = &command{
+	Name:    "invitations",
+	Args:    []string{"ACTION", "ORGNAME"},
+	Summary: "List, or cancel stale, pending invitations to the organization and its repositories",
+	Description: `
+Pending invitations never expire on their own, so they accumulate over
+the years, and each one is a standing offer of access to whoever
+controls the invited account.  ACTION is one of:
+
+list: List every pending invitation to join the organization, and to
+collaborate on any of its non-archived repositories, oldest first.
+
+prune: List the invitations that were sent more than --older-than ago,
+and, with --yes, cancel them.  Without --yes (or with --dry-run), it
+only says what it would cancel.`,
+	Examples: []example{
+		{"List pending invitations to the datawire organization and its repositories.", progName + " invitations list datawire"},
+		{"See which invitations are more than 90 days old.", progName + " invitations --older-than=90d prune datawire"},
+		{"Cancel invitations more than 30 days old.", progName + " invitations --yes prune datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		olderThan := daysDuration(30 * 24 * time.Hour)
+		fs.Var(&olderThan, "older-than", "prune: how long ago an invitation must have been sent for it to be cancelled")
+		dryRun := fs.Bool("dry-run", false, "prune: only list the invitations that would be cancelled (the default, unless --yes)")
+		yes := fs.Bool("yes", false, "prune: actually cancel the invitations")
+		return func(ctx context.Context, args []string) error {
+			action, orgname := args[0], args[1]
+			switch action {
+			case "list", "prune":
+			default:
+				return usageErrorf("invitations: invalid ACTION %q (must be 'list' or 'prune')", action)
+			}
+			if *dryRun && *yes {
+				return usageErrorf("invitations: --dry-run and --yes are mutually exclusive")
+			}
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+
+			invitations, err := getOrgInvitations(ctx, orgname)
+			if err == nil {
+				var repos []RepoHandle
+				repos, _, err = getRepos(ctx, orgname, false)
+				if err != nil {
+					return err
+				}
+				sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+				var repoInvitations []Invitation
+				repoInvitations, err = getRepoInvitations(ctx, orgname, repos)
+				invitations = append(invitations, repoInvitations...)
+			}
+			if err != nil && err != errInterrupted {
+				return err
+			}
+			if action == "prune" {
+				cutoff := time.Now().Add(-time.Duration(olderThan))
+				var stale []Invitation
+				for _, inv := range invitations {
+					if inv.CreatedAt.Before(cutoff) {
+						stale = append(stale, inv)
+					}
+				}
+				invitations = stale
+			}
+			sort.SliceStable(invitations, func(i, j int) bool {
+				return invitations[i].CreatedAt.Before(invitations[j].CreatedAt)
+			})
+
+			output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(output, "Invitee\t| Repository\t| Role\t| Invited by\t| Sent\n")
+			fmt.Fprintf(output, "-------\t| ----------\t| ----\t| ----------\t| ----\n")
+			for _, inv := range invitations {
+				repo := inv.Repo
+				if repo == "" {
+					repo = "(organization)"
+				}
+				fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\t| %s\n", inv.Invitee, repo, inv.Role, inv.Inviter, formatDate(inv.CreatedAt))
+			}
+			output.Flush()
+			if err == errInterrupted {
+				fmt.Fprintf(os.Stdout, "PARTIAL REPORT: interrupted after finding %d invitations\n", len(invitations))
+				return err
+			}
+
+			switch {
+			case action == "list":
+				fmt.Fprintf(os.Stderr, "%d pending invitations\n", len(invitations))
+				return nil
+			case !*yes:
+				fmt.Fprintf(os.Stderr, "dry run: would cancel %d invitations sent more than %s ago; re-run with --yes to cancel them\n",
+					len(invitations), olderThan.String())
+				return nil
+			}
+			for i, inv := range invitations {
+				if ctx.Err() != nil {
+					fmt.Fprintf(os.Stderr, "cancelled %d of %d invitations before being interrupted\n", i, len(invitations))
+					return errInterrupted
+				}
+				if err := cancelInvitation(ctx, orgname, inv); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(os.Stderr, "cancelled %d invitations\n", len(invitations))
+			return nil
+		}
+	},
+}
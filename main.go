@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Flags that are accepted by every subcommand.
+var (
+	flagStats        bool
+	flagDebug        bool
+	flagPageSize     int
+	flagRetries      int
+	flagRetryBackoff time.Duration
+	flagAPIURL       string
+
+	flagGraphQLQueries string
+
+	flagDeadline       time.Duration
+	flagRequestTimeout time.Duration
+
+	flagRecordBundle     string
+	flagRecordHashLogins bool
+	flagReplayBundle     string
+
+	flagProfile      string
+	flagProfilesFile string
+
+	flagToken     string
+	flagTokenFile string
+
+	flagAppID             string
+	flagAppKeyFile        string
+	flagAppInstallationID int64
+
+	flagOTLPEndpoint string
+)
+
+// commonFlags is the names of the flags that every subcommand accepts.
+var commonFlags map[string]bool
+
+// usageError is an error in how the program was invoked, rather than
+// an error that happened while running.  A usageError with a nil err
+// has already been reported (by the flag package).
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	if e.err == nil {
+		return "usage error"
+	}
+	return e.err.Error()
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return usageError{err: fmt.Errorf(format, a...)}
+}
+
+// newFlagSet returns a FlagSet with the flags that every subcommand
+// accepts already registered.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&flagStats, "stats", false, "print per-query request, retry, latency, and error statistics to stderr when done")
+	fs.BoolVar(&flagDebug, "debug", false, "log the rate-limit cost of each GraphQL query to stderr, and the total when done")
+	fs.IntVar(&flagPageSize, "page-size", 100, "number of items to request per page of a paginated query (1-100); automatically reduced while GitHub is timing out")
+	fs.IntVar(&flagRetries, "retries", 3, "how many times to retry a read that fails with a network error, timeout, or 5xx response (changes are never retried)")
+	fs.DurationVar(&flagRetryBackoff, "retry-backoff", time.Second, "how long to wait before the first retry of a failed request; doubled for each retry after that")
+	fs.DurationVar(&flagDeadline, "deadline", 0, "stop and print what has been found so far, rather than run for longer than this `duration` (like 2h); 0 means no deadline")
+	fs.DurationVar(&flagRequestTimeout, "request-timeout", time.Minute, "give up on (and maybe retry) a request that takes longer than this `duration`")
+	fs.StringVar(&flagAPIURL, "api-url", "", "GraphQL endpoint `url` of a GitHub Enterprise Server instance, like https://github.example.com/api/graphql (default https://HOST/api/graphql if $GH_HOST is set, else github.com)")
+	fs.StringVar(&flagGraphQLQueries, "graphql-queries", queriesFull, "how to send GraphQL queries: 'full', 'minified' (without comments or extra whitespace), or 'persisted' (as the hash of the minified query, sending the query only if the server asks for it)")
+	fs.StringVar(&flagRecordBundle, "record-bundle", "", "save every API request and response to a bundle `file` (without the token) to attach to a bug report")
+	fs.BoolVar(&flagRecordHashLogins, "record-hash-logins", false, "with --record-bundle, replace logins and email addresses in the bundle with hashes")
+	fs.StringVar(&flagReplayBundle, "replay-bundle", "", "answer API requests from a bundle `file` made with --record-bundle, rather than from GitHub")
+	fs.StringVar(&flagProfile, "profile", "", "take the token, organizations, and any flags not given on the command line from the named `profile` in --profiles-file")
+	fs.StringVar(&flagProfilesFile, "profiles-file", "", "YAML or JSON `file` of named profiles for --profile (default $XDG_CONFIG_HOME/collaborators/profiles.yaml)")
+	fs.StringVar(&flagToken, "token", "", "GitHub `token` to use, rather than $GH_TOKEN or $GITHUB_TOKEN; prefer --token-file, as this is visible to other users of the host")
+	fs.StringVar(&flagTokenFile, "token-file", "", "read the GitHub token from `file`, rather than from $GH_TOKEN or $GITHUB_TOKEN")
+	fs.StringVar(&flagAppID, "app-id", "", "authenticate as an installation of the GitHub App with this `id`, rather than with a token")
+	fs.StringVar(&flagAppKeyFile, "app-private-key-file", "", "PEM `file` of the private key of the --app-id GitHub App")
+	fs.Int64Var(&flagAppInstallationID, "app-installation-id", 0, "`id` of the installation of the --app-id GitHub App to use; needed only if it has more than one")
+	fs.StringVar(&flagOTLPEndpoint, "otlp-endpoint", "", "export traces of the run and per-query metrics to the OpenTelemetry collector at this `url` (like http://localhost:4318) when done (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	if commonFlags == nil {
+		commonFlags = make(map[string]bool)
+		fs.VisitAll(func(f *flag.Flag) { commonFlags[f.Name] = true })
+	}
+	return fs
+}
+
+// parseFlags parses args with the flags of cmd, fs, fills in the rest
+// from --profile, and applies the flags that every subcommand accepts.
+// It returns the positional arguments.
+func parseFlags(cmd *command, fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, usageError{}
+	}
+	positional := fs.Args()
+	var tokenEnv string
+	if flagProfile != "" {
+		prof, err := loadProfile(flagProfilesFile, flagProfile)
+		if err != nil {
+			return nil, usageError{err: err}
+		}
+		if err := prof.apply(fs, cmd.Name); err != nil {
+			return nil, usageError{err: err}
+		}
+		if len(positional) == 0 {
+			positional = prof.Orgs
+		}
+		tokenEnv = prof.TokenEnv
+	}
+	if err := resolveToken(tokenEnv); err != nil {
+		return nil, usageError{err: err}
+	}
+	if err := pageSize.SetMax(flagPageSize); err != nil {
+		return nil, usageError{err: err}
+	}
+	if flagRetries < 0 {
+		return nil, usageErrorf("invalid --retries %d (must not be negative)", flagRetries)
+	}
+	if flagRetryBackoff <= 0 {
+		return nil, usageErrorf("invalid --retry-backoff %v (must be positive)", flagRetryBackoff)
+	}
+	if flagRequestTimeout <= 0 {
+		return nil, usageErrorf("invalid --request-timeout %v (must be positive)", flagRequestTimeout)
+	}
+	httpClient.Timeout = flagRequestTimeout
+	if flagDeadline < 0 {
+		return nil, usageErrorf("invalid --deadline %v (must not be negative)", flagDeadline)
+	}
+	if err := setAPIURL(flagAPIURL, os.Getenv("GH_HOST")); err != nil {
+		return nil, usageError{err: err}
+	}
+	if err := setQueryMode(flagGraphQLQueries); err != nil {
+		return nil, usageError{err: err}
+	}
+	if flagOTLPEndpoint == "" {
+		flagOTLPEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if flagOTLPEndpoint != "" {
+		var err error
+		if telemetry, err = newOTLPExporter(flagOTLPEndpoint); err != nil {
+			return nil, usageError{err: err}
+		}
+	}
+	switch {
+	case flagRecordBundle != "" && flagReplayBundle != "":
+		return nil, usageErrorf("--record-bundle and --replay-bundle are mutually exclusive")
+	case flagRecordHashLogins && flagRecordBundle == "":
+		return nil, usageErrorf("--record-hash-logins needs --record-bundle")
+	case flagRecordBundle != "":
+		recorder = &bundleRecorder{next: http.DefaultTransport}
+		httpClient.Transport = recorder
+	case flagReplayBundle != "":
+		replayer, manifest, err := loadBundle(flagReplayBundle)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "replaying bundle %q, recorded %s with arguments: %s\n",
+			flagReplayBundle, manifest.RecordedAt.Local().Format(time.RFC1123), strings.Join(manifest.Args, " "))
+		httpClient.Transport = replayer
+	}
+	return positional, nil
+}
+
+// commaList is a flag.Value for a comma-separated list of strings.
+type commaList []string
+
+func (l *commaList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *commaList) Set(str string) error {
+	*l = nil
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// daysDuration is a flag.Value for a time.Duration that, on top of the
+// usual time.ParseDuration syntax, accepts a whole number of days
+// ("30d") or weeks ("2w").
+type daysDuration time.Duration
+
+func (d *daysDuration) String() string {
+	dur := time.Duration(*d)
+	if dur != 0 && dur%(24*time.Hour) == 0 {
+		return strconv.FormatInt(int64(dur/(24*time.Hour)), 10) + "d"
+	}
+	return dur.String()
+}
+
+func (d *daysDuration) Set(str string) error {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(str, suffix)); err == nil && strings.HasSuffix(str, suffix) {
+			*d = daysDuration(time.Duration(n) * unit)
+			return nil
+		}
+	}
+	dur, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q (expected something like 30d, 2w, or 12h)", str)
+	}
+	*d = daysDuration(dur)
+	return nil
+}
+
+var reportCommand = &command{
+	Name:    "report",
+	Args:    []string{"[ORGNAME...]"},
+	Summary: "Print a summary of who has access to each repository in an organization",
+	Description: `
+Prints a table with a row for each non-archived repository in the
+organization, most-recently-modified first (or by name, with
+--sort=name), listing which
+organizations, teams, and individual users have been granted access
+to it and at what permission level.  A team or user only shows up if
+it was explicitly granted access; the members of a team with access
+are not listed individually, unless --expand-teams is given.  Then each
+team's grant is listed as grants to its members and the members of its
+child teams instead, as individual users, each with the highest
+permission that they get; that is what to check against a list of
+people who have left.  --filter still sees the grants to teams.
+
+Which columns the table has is chosen with --sources.  Besides "org",
+"team", and "user", individual users can be split out further as
+"member", "outside" (outside collaborators), and "bot" (GitHub App bot
+users); a user may be listed in more than one column.
+
+Which grants are reported can be narrowed further with --filter, a
+Starlark (Python-like) expression that is evaluated for each grant.
+It can use repo.name, repo.url, repo.visibility ("PUBLIC", "PRIVATE",
+or "INTERNAL"), repo.license, repo.is_fork, repo.is_template,
+repo.is_archived, source.kind ("org", "team", or "user"), source.name,
+and permission, which compares against NONE, READ, TRIAGE, WRITE,
+MAINTAIN, and ADMIN.
+With --deployment-approvers, each required reviewer of a deployment
+environment is also evaluated, once per environment, with capability
+"deployment-approver" (rather than "access") and environment set to
+the environment's name.  Repositories with no grants left are left
+out.
+
+Given more than one ORGNAME (or a file of them, with --orgs-file),
+it reports on each organization in turn and prints a single combined
+report, with an org column first.  That works with --format=table,
+markdown, csv, or json (which has a list of per-organization reports), but not
+with --by-user, --by-team, --effective, --dedupe-acl, --checkpoint, --team,
+or the outputs that are written after the run (--git-archive,
+--mongo-uri, and --html-site).
+
+Progress gets printed to stderr, and the report gets printed to
+stdout.  It needs a GitHub personal access token with the 'admin:org'
+and 'repo' scopes (see --token), and takes a couple of minutes for a
+large organization.
+
+This is the default command; "report" may be left off.`,
+	Examples: []example{
+		{"Report on the datawire organization.", progName + " datawire"},
+		{"Report only on explicitly granted access.", progName + " --exclude-sources=org datawire"},
+		{"Report on which outside collaborators and bots have been granted access.", progName + " --sources=outside,bot datawire"},
+		{"Show the distinct access patterns in use, rather than every repository.", progName + " --dedupe-acl datawire"},
+		{"List what each person can access, for offboarding reviews.", progName + " --by-user --format=csv datawire > by-user.csv"},
+		{"List the one effective permission that each person has on each repository, for an access review.", progName + " --effective --format=csv datawire > effective.csv"},
+		{"List what each team has been granted, to see whether it can be deleted.", progName + " --by-team datawire"},
+		{"Report on just the repositories that the platform team can access, for its lead to review.", progName + " --team=platform datawire"},
+		{"Report only on the telepresence repositories, leaving out any sandboxes.", progName + " --repo='telepresence*' --exclude-repo='*-sandbox' datawire"},
+		{"Report on a large organization faster, by inspecting 8 repositories at once.", progName + " --parallel=8 datawire"},
+		{"Report on several related organizations at once.", progName + " datawire telepresenceio emissary-ingress"},
+		{"Report on every organization listed in a file, for a spreadsheet.", progName + " --orgs-file=orgs.txt --format=csv > access.csv"},
+		{"Run the report as the prod-audit profile in the profiles file says to.", progName + " --profile=prod-audit"},
+		{"Check that the token will work, without waiting for a full run.", progName + " --preflight datawire"},
+		{"Report individual users with write access to private repositories.",
+			progName + ` --filter='permission >= WRITE and source.kind == "user" and repo.visibility == "PRIVATE"' datawire`},
+		{"Report who can approve deployments to each repository's environments.",
+			progName + ` --deployment-approvers --filter='capability == "deployment-approver"' datawire`},
+		{"Write the report as a Markdown table, to paste in to an access-review issue.", progName + " --format=markdown datawire | pbcopy"},
+		{"Write the report as a web page with sortable, filterable tables, for auditors.", progName + " --format=html datawire > access.html"},
+		{"Write the report as JSON, for scripts.", progName + " --format=json datawire"},
+		{"Write one row per grant, for a spreadsheet.", progName + " --format=csv datawire > access.csv"},
+		{"Load the access graph in to Neo4j.", progName + " --format=cypher datawire | cypher-shell"},
+		{"Keep a history of the report in a git repository.", progName + " --git-archive=$HOME/access-history datawire"},
+		{"Publish the report as a browsable, searchable static site.", progName + " --html-site=/srv/www/github-access datawire"},
+		{"Keep the latest report browsable on the gh-pages branch of an audit repository.", progName + " --html-site-repo=datawire/access-audit datawire"},
+		{"Upsert the report in to a MongoDB collection.", progName + " --mongo-uri=mongodb://inventory.internal:27017 --mongo-collection=assets.github_access datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		sources := commaList{"org", "team", "user"}
+		fs.Var(&sources, "sources", "comma-separated list of permission sources to report on ("+strings.Join(bucketNames(), ", ")+")")
+		var excludeSources commaList
+		fs.Var(&excludeSources, "exclude-sources", "comma-separated list of permission sources to leave out of the report")
+		var opts Options
+		var repos, excludeRepos commaList
+		fs.Var(&repos, "repo", "comma-separated list of `glob` patterns (like 'telepresence-*'); only inspect repositories whose names match one")
+		fs.Var(&excludeRepos, "exclude-repo", "comma-separated list of `glob` patterns; don't inspect repositories whose names match one")
+		fs.StringVar(&opts.Team, "team", "", "only inspect repositories that the team with this `slug` can access, including through its parent teams (one more query per 100 of them)")
+		fs.BoolVar(&opts.Normalize.KeepOwnerDuplicates, "keep-owner-duplicates", false, "don't drop the duplicate ADMIN sources that the API reports for org owners")
+		fs.BoolVar(&opts.Normalize.KeepChildTeams, "keep-child-teams", false, "don't drop child teams that have the same permission as their parent team")
+		fs.StringVar(&opts.Checkpoint, "checkpoint", "", "`file` to save progress to if interrupted, and to resume from if it exists")
+		filter := fs.String("filter", "", "only report grants for which this `expression` is true; see 'help report'")
+		fs.StringVar(&opts.Format, "format", "table", "output format: 'table', 'markdown' (a table to paste in to an issue), 'html' (a standalone page with sortable tables of repositories, users, and teams), 'json', 'csv' (one row per grant), or 'cypher' (statements to load the access graph in to Neo4j)")
+		fs.StringVar(&opts.SortBy, "sort", "updated", "order to list repositories in: 'updated' (most recently modified first) or 'name'; 'name' makes reports from different runs diff cleanly")
+		fs.BoolVar(&opts.IncludeArchived, "include-archived", false, "also report on archived repositories, which are marked as such")
+		fs.BoolVar(&opts.UINames, "ui-names", false, "name permissions as GitHub's web UI does (Read, Triage, Write, Maintain, Admin) rather than as the API does")
+		fs.BoolVar(&opts.ShowLicense, "show-license", false, "add a column with the license that GitHub detected in each repository")
+		fs.StringVar(&opts.GitArchive, "git-archive", "", "git repository `dir` to commit the report to after a complete run, for a diffable history of access")
+		fs.StringVar(&opts.HTMLSite, "html-site", "", "`dir` to write the report to after a complete run as a static site, with a page per repository and per user and a search box (one more query per 100 teams)")
+		fs.StringVar(&opts.HTMLSiteRepo, "html-site-repo", "", "`owner/name` of a repository to commit the static site (as with --html-site) to after a complete run, for GitHub Pages to serve")
+		fs.StringVar(&opts.HTMLSiteBranch, "html-site-branch", "gh-pages", "`branch` of --html-site-repo to commit the site to, replacing what was there")
+		fs.StringVar(&opts.MongoURI, "mongo-uri", "", "MongoDB `uri` to upsert one document per repository in to after a complete run")
+		fs.StringVar(&opts.MongoCollection, "mongo-collection", "collaborators.access", "`database.collection` for --mongo-uri to upsert in to")
+		fs.BoolVar(&opts.DeploymentApprovers, "deployment-approvers", false, "add a column with the required reviewers of each repository's deployment environments (one more query per repository)")
+		fs.BoolVar(&opts.ByUser, "by-user", false, "list, for each user, the repositories that they have access to and through which grants (one more query per 100 teams)")
+		fs.BoolVar(&opts.Effective, "effective", false, "list each user's effective permission on each repository: the highest that any of their grants, or being an org owner, gives them, as GitHub reports it")
+		fs.BoolVar(&opts.ExpandTeams, "expand-teams", false, "list the members of each team that has been granted access, as individuals, in place of the team (one more query per 100 teams)")
+		fs.BoolVar(&opts.ByTeam, "by-team", false, "list, for each team, the repositories that it has been granted access to")
+		fs.BoolVar(&opts.Overlap, "overlap", false, "with more than one ORGNAME, list the users who have access in more than one of them, with their highest permission in each (one more query per 100 teams per organization)")
+		fs.BoolVar(&opts.DedupeACL, "dedupe-acl", false, "group repositories that have identical sets of grants, and print each distinct set once")
+		fs.IntVar(&opts.Parallel, "parallel", 1, "inspect up to `N` repositories at once")
+		fs.BoolVar(&opts.KeepGoing, "keep-going", false, "leave out a repository that fails to be inspected, rather than give up, and exit with status 5 at the end")
+		orgsFile := fs.String("orgs-file", "", "`file` listing more organizations to report on, one per line")
+		fs.BoolVar(&opts.Preflight, "preflight", false, "instead of running the report, check with one cheap query each that the token can do everything the report, with the other flags given, needs")
+
+		return func(ctx context.Context, args []string) error {
+			switch opts.Format {
+			case "table":
+			case "markdown", "html", "json", "csv", "cypher":
+				if opts.DedupeACL {
+					return usageErrorf("--dedupe-acl only works with --format=table")
+				}
+			default:
+				return usageErrorf("invalid --format %q (must be 'table', 'markdown', 'html', 'json', 'csv', or 'cypher')", opts.Format)
+			}
+			if opts.ByUser && (opts.DedupeACL || opts.DeploymentApprovers || (opts.Format != "table" && opts.Format != "csv")) {
+				return usageErrorf("--by-user only works with --format=table or --format=csv, and not with --dedupe-acl or --deployment-approvers")
+			}
+			if opts.UINames && opts.Format != "table" && opts.Format != "markdown" && opts.Format != "html" {
+				return usageErrorf("--ui-names only works with --format=table, markdown, or html; the other formats always use the API's names")
+			}
+			if opts.Effective && (opts.ByUser || opts.DedupeACL || opts.DeploymentApprovers || (opts.Format != "table" && opts.Format != "csv")) {
+				return usageErrorf("--effective only works with --format=table or --format=csv, and not with --by-user, --dedupe-acl, or --deployment-approvers")
+			}
+			if opts.ByTeam && (opts.ByUser || opts.Effective || opts.DedupeACL || opts.DeploymentApprovers || (opts.Format != "table" && opts.Format != "csv")) {
+				return usageErrorf("--by-team only works with --format=table or --format=csv, and not with --by-user, --effective, --dedupe-acl, or --deployment-approvers")
+			}
+			if opts.Overlap && (opts.ByUser || opts.ByTeam || opts.Effective || opts.DedupeACL || opts.DeploymentApprovers || (opts.Format != "table" && opts.Format != "csv")) {
+				return usageErrorf("--overlap only works with --format=table or --format=csv, and not with --by-user, --by-team, --effective, --dedupe-acl, or --deployment-approvers")
+			}
+			if opts.ExpandTeams && (opts.ByUser || opts.ByTeam || opts.Effective || opts.Overlap || opts.Format == "html" || opts.Format == "cypher" ||
+				opts.GitArchive != "" || opts.MongoURI != "" || opts.HTMLSite != "" || opts.HTMLSiteRepo != "") {
+				return usageErrorf("--expand-teams doesn't work with --by-user, --by-team, --effective, --overlap, --format=html or cypher, or the outputs that are written after the run (--git-archive, --mongo-uri, and --html-site)")
+			}
+			if opts.DeploymentApprovers && (opts.Format == "csv" || opts.DedupeACL) {
+				return usageErrorf("--deployment-approvers doesn't work with --format=csv or --dedupe-acl")
+			}
+			if *filter != "" {
+				var err error
+				if opts.Filter, err = parseGrantFilter(*filter); err != nil {
+					return usageError{err: err}
+				}
+			}
+			if err := checkRepoPatterns("--repo", repos); err != nil {
+				return usageError{err: err}
+			}
+			if err := checkRepoPatterns("--exclude-repo", excludeRepos); err != nil {
+				return usageError{err: err}
+			}
+			opts.Repos, opts.ExcludeRepos = repos, excludeRepos
+			if owner, name, ok := strings.Cut(opts.HTMLSiteRepo, "/"); opts.HTMLSiteRepo != "" && (!ok || owner == "" || name == "" || strings.Contains(name, "/")) {
+				return usageErrorf("invalid --html-site-repo %q (must be 'owner/name')", opts.HTMLSiteRepo)
+			}
+			if _, _, err := splitMongoCollection(opts.MongoCollection); err != nil {
+				return usageError{err: err}
+			}
+			if opts.Parallel < 1 {
+				return usageErrorf("invalid --parallel %d (must be at least 1)", opts.Parallel)
+			}
+			if opts.SortBy != "updated" && opts.SortBy != "name" {
+				return usageErrorf("invalid --sort %q (must be 'updated' or 'name')", opts.SortBy)
+			}
+			for _, source := range append(append(commaList(nil), sources...), excludeSources...) {
+				if lookupBucket(source) == nil {
+					return usageErrorf("invalid permission source %q (valid sources are %s)", source, strings.Join(bucketNames(), ", "))
+				}
+			}
+			for _, source := range sources {
+				excluded := false
+				for _, exclude := range excludeSources {
+					if source == exclude {
+						excluded = true
+					}
+				}
+				if !excluded {
+					opts.Sources = append(opts.Sources, lookupBucket(source))
+				}
+			}
+			orgnames, err := listOrgs(args, *orgsFile)
+			if err != nil {
+				return err
+			}
+			switch {
+			case len(orgnames) == 0:
+				return usageErrorf("report: expected at least one ORGNAME, or --orgs-file")
+			case len(orgnames) == 1 && opts.Overlap:
+				return usageErrorf("--overlap needs more than one ORGNAME")
+			case len(orgnames) == 1:
+				return Main(ctx, orgnames[0], opts)
+			}
+			if githubApp != nil {
+				return usageErrorf("more than one organization doesn't work with --app-id, as a GitHub App installation is in only one organization")
+			}
+			if opts.ByUser || opts.ByTeam || opts.Effective || opts.DedupeACL || opts.Format == "cypher" || opts.Format == "html" || opts.Checkpoint != "" || opts.Team != "" ||
+				opts.GitArchive != "" || opts.MongoURI != "" || opts.HTMLSite != "" || opts.HTMLSiteRepo != "" {
+				return usageErrorf("more than one organization only works with --format=table, markdown, csv, or json, and not with --by-user, --by-team, --effective, --dedupe-acl, --checkpoint, --team, --git-archive, --mongo-uri, or --html-site(-repo)")
+			}
+			return MainMulti(ctx, orgnames, opts)
+		}
+	},
+}
+
+// runCommand runs the command named by the first element of args
+// (or the default command, if the first element isn't the name of a
+// command) with the rest of args.
+func runCommand(ctx context.Context, args []string) error {
+	cmd := commands[0]
+	if len(args) > 0 {
+		if named := lookupCommand(args[0]); named != nil {
+			cmd, args = named, args[1:]
+		}
+	}
+	fs, run := cmd.flagSet()
+	args, err := parseFlags(cmd, fs, args)
+	if err != nil {
+		return err
+	}
+	if err := cmd.checkArgs(args); err != nil {
+		return err
+	}
+	if flagDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, startTime.Add(flagDeadline))
+		defer cancel()
+		go func() {
+			<-ctx.Done()
+			if ctx.Err() == context.DeadlineExceeded {
+				fmt.Fprintf(os.Stderr, "--deadline of %v reached; stopping\n", flagDeadline)
+			}
+		}()
+	}
+	ctx, span := startSpan(ctx, progName+" "+cmd.Name, false)
+	err = run(ctx, args)
+	span.End(err)
+	return err
+}
+
+// startTime is when the program started; --deadline counts from
+// here.
+var startTime = time.Now()
+
+func main() {
+	// On the first SIGINT/SIGTERM, cancel whatever requests are in
+	// flight, stop starting new work, and print what we have.
+	// Un-register after that, so that a second one kills us
+	// immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		fmt.Fprintln(os.Stderr, "interrupted; stopping (interrupt again to quit immediately)")
+	}()
+
+	err := runCommand(ctx, os.Args[1:])
+	if recorder != nil {
+		if saveErr := recorder.Save(flagRecordBundle, bundleArgs(os.Args[1:]), flagRecordHashLogins); saveErr != nil {
+			fmt.Fprintln(os.Stderr, "error: --record-bundle:", saveErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "recorded the run's API requests to %q; replay it with --replay-bundle\n", flagRecordBundle)
+		}
+	}
+	if flagStats {
+		stats.Print(os.Stderr)
+	}
+	if telemetry != nil {
+		// Not ctx, which an interrupted run has cancelled.
+		if exportErr := telemetry.Export(context.Background(), stats); exportErr != nil {
+			fmt.Fprintln(os.Stderr, "error: --otlp-endpoint:", exportErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "exported the run's traces and metrics to %s\n", flagOTLPEndpoint)
+		}
+	}
+	if flagDebug {
+		cost, requests := stats.TotalCost()
+		fmt.Fprintf(os.Stderr, "debug: total rate-limit cost: %d points over %d requests\n", cost, requests)
+	}
+	var uerr usageError
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.As(err, &uerr):
+		if uerr.err != nil {
+			fmt.Fprintln(os.Stderr, "error:", uerr.err)
+		}
+		os.Exit(2)
+	case errors.Is(err, errFindings):
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(4)
+	case errors.Is(err, errRepoFailures):
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(5)
+	case errors.Is(err, errInterrupted) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// A command that was stopped before it had anything to
+		// show returns the error from the request that was cut
+		// off, rather than errInterrupted.
+		if flagDeadline > 0 && time.Since(startTime) >= flagDeadline {
+			fmt.Fprintf(os.Stderr, "error: %v: stopped at the --deadline of %v\n", err, flagDeadline)
+		} else {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(3)
+	default:
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// orgMember is a member of an org, and their role in it.
+type orgMember struct {
+	Login string
+	// Owner is whether they are one of the org's owners, who have
+	// ADMIN on every repo whatever they have been granted.
+	Owner bool
+	// TwoFactor is whether they have two-factor authentication
+	// enabled, or nil if the token isn't allowed to know (only the
+	// org's owners are).
+	TwoFactor *bool
+}
+
+// twoFactorStatus describes member.TwoFactor.
+func (member orgMember) twoFactorStatus() string {
+	switch {
+	case member.TwoFactor == nil:
+		return "unknown"
+	case *member.TwoFactor:
+		return "enabled"
+	default:
+		return "disabled"
+	}
+}
+
+func (member orgMember) role() string {
+	if member.Owner {
+		return "OWNER"
+	}
+	return "MEMBER"
+}
+
+// getMemberRoles returns every member of an organization, with their
+// role and whether they have two-factor authentication enabled, sorted
+// by login.
+func getMemberRoles(ctx context.Context, orgname string) ([]orgMember, error) {
+	query := `
+query getMemberRoles($orgname: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    membersWithRole(first: $pageSize, after: $cursor) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      edges {
+        role
+        hasTwoFactorEnabled
+        node {
+          login
+        }
+      }
+    }
+  }
+}`
+	var rawMembers struct {
+		Organization struct {
+			MembersWithRole struct {
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+				Edges []struct {
+					Role                string
+					HasTwoFactorEnabled *bool
+					Node                struct {
+						Login string
+					}
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+	}
+	var ret []orgMember
+	for args["cursor"] == nil || rawMembers.Organization.MembersWithRole.PageInfo.HasNextPage {
+		// Don't decode a null hasTwoFactorEnabled in to the
+		// previous page's edges.
+		rawMembers.Organization.MembersWithRole.Edges = nil
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawMembers, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, fmt.Errorf("getMemberRoles: %w", err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawMembers.Organization.MembersWithRole.PageInfo.EndCursor
+
+		for _, edge := range rawMembers.Organization.MembersWithRole.Edges {
+			ret = append(ret, orgMember{
+				Login:     edge.Node.Login,
+				Owner:     edge.Role == "ADMIN",
+				TwoFactor: edge.HasTwoFactorEnabled,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return strings.ToLower(ret[i].Login) < strings.ToLower(ret[j].Login) })
+	return ret, nil
+}
+
+func writeMembersTable(w io.Writer, members []orgMember) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Login\t| Role\t| 2FA\n")
+	fmt.Fprintf(output, "-----\t| ----\t| ---\n")
+	for _, member := range members {
+		fmt.Fprintf(output, "%s\t| %s\t| %s\n", member.Login, member.role(), member.twoFactorStatus())
+	}
+	output.Flush()
+}
+
+func writeMembersCSV(w io.Writer, members []orgMember) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"login", "role", "two_factor"})
+	for _, member := range members {
+		_ = output.Write([]string{member.Login, member.role(), member.twoFactorStatus()})
+	}
+	output.Flush()
+	return output.Error()
+}
+
+var membersCommand = &command{
+	Name:    "members",
+	Args:    []string{"ORGNAME"},
+	Summary: "List the organization's members, their roles, and their 2FA status",
+	Description: `
+Lists every member of the organization, saying whether each is an
+OWNER (who can administer every repository, whatever they have been
+granted) or a plain MEMBER, and whether they have two-factor
+authentication enabled.  GitHub only tells the org's owners about
+other members' 2FA, so with anyone else's token it is "unknown".
+
+With --owners, only the owners are listed; with --without-2fa, only
+the members known not to have 2FA enabled.
+
+It takes a query per 100 members.`,
+	Examples: []example{
+		{"List the owners of the datawire organization.", progName + " members --owners datawire"},
+		{"List the members of the datawire organization without 2FA.", progName + " members --without-2fa datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		owners := fs.Bool("owners", false, "only list the org's owners")
+		without2FA := fs.Bool("without-2fa", false, "only list members who are known not to have two-factor authentication enabled")
+		format := fs.String("format", "table", "output format: 'table' or 'csv'")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if *format != "table" && *format != "csv" {
+				return usageErrorf("members: invalid --format %q (must be 'table' or 'csv')", *format)
+			}
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			all, err := getMemberRoles(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			var members []orgMember
+			nOwners, nWithout, nUnknown := 0, 0, 0
+			for _, member := range all {
+				if member.Owner {
+					nOwners++
+				}
+				switch member.twoFactorStatus() {
+				case "disabled":
+					nWithout++
+				case "unknown":
+					nUnknown++
+				}
+				if (*owners && !member.Owner) || (*without2FA && member.twoFactorStatus() != "disabled") {
+					continue
+				}
+				members = append(members, member)
+			}
+
+			if *format == "csv" {
+				if err := writeMembersCSV(os.Stdout, members); err != nil {
+					return err
+				}
+			} else {
+				writeMembersTable(os.Stdout, members)
+			}
+			fmt.Fprintf(os.Stderr, "%d members, %d of them owners; %d without 2FA\n", len(all), nOwners, nWithout)
+			if nUnknown > 0 {
+				fmt.Fprintf(os.Stderr, "warning: whether %d members have 2FA enabled is unknown, as only the org's owners can see it\n", nUnknown)
+			}
+			return nil
+		}
+	},
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// splitMongoCollection splits a --mongo-collection of the form
+// "DATABASE.COLLECTION".
+func splitMongoCollection(name string) (database, collection string, err error) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid --mongo-collection %q (must be DATABASE.COLLECTION)", name)
+	}
+	return parts[0], parts[1], nil
+}
+
+// writeMongo upserts one document per repo in to a MongoDB collection.
+// Each document is the repo's entry in --format=json, plus the org and
+// the time of the run, and is keyed by the repo's node ID and the time
+// of the run, so each run adds a new generation of documents rather
+// than overwriting the last.
+func writeMongo(ctx context.Context, uri, collectionName, orgname string, runAt time.Time, results []RepoReport, grouping Grouping) error {
+	dbname, collname, err := splitMongoCollection(collectionName)
+	if err != nil {
+		return err
+	}
+	// BSON dates only have millisecond precision; truncate so that
+	// the runAt in the _id is exactly the runAt that gets stored.
+	runAt = runAt.UTC().Truncate(time.Millisecond)
+
+	var models []mongo.WriteModel
+	for _, result := range results {
+		if result.Repo.ID == "" {
+			return fmt.Errorf("repo %q has no node ID", result.Repo.Name)
+		}
+		// Go through JSON so that the fields are named the same
+		// as in --format=json.
+		data, err := json.Marshal(newJSONRepo(result, grouping))
+		if err != nil {
+			return err
+		}
+		var fields bson.D
+		if err := bson.UnmarshalExtJSON(data, false, &fields); err != nil {
+			return err
+		}
+		id := bson.D{{Key: "repoId", Value: result.Repo.ID}, {Key: "runAt", Value: runAt}}
+		doc := append(bson.D{
+			{Key: "_id", Value: id},
+			{Key: "org", Value: orgname},
+			{Key: "runAt", Value: runAt},
+		}, fields...)
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: id}}).
+			SetReplacement(doc).
+			SetUpsert(true))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	_, err = client.Database(dbname).Collection(collname).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
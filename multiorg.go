@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// orgResults is what was collected about one org, for a report that
+// covers several.
+type orgResults struct {
+	Org  string
+	Role viewerRole
+	// Grouping has the org's own Members.
+	Grouping Grouping
+	// Teams is only fetched for --overlap and --expand-teams.
+	Teams     teamMembership
+	Results   []RepoReport
+	Total     int
+	Invisible int
+	Complete  bool
+}
+
+// listOrgs returns the orgs named in args, followed by those listed in
+// orgsFile (if it isn't empty), one per line, leaving out any that are
+// named twice.  Blank lines and lines starting with "#" in orgsFile are
+// ignored.
+func listOrgs(args []string, orgsFile string) ([]string, error) {
+	names := append([]string(nil), args...)
+	if orgsFile != "" {
+		f, err := os.Open(orgsFile)
+		if err != nil {
+			return nil, fmt.Errorf("--orgs-file: %w", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			names = append(names, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("--orgs-file: %w", err)
+		}
+	}
+	var ret []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		// Org names, like logins, are case-insensitive.
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			ret = append(ret, name)
+		}
+	}
+	return ret, nil
+}
+
+// jsonMultiReport is the schema of --format=json for a report on more
+// than one org: each org's report, as it would be on its own.
+type jsonMultiReport struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Complete is false if the run was interrupted, in which case
+	// Orgs stops at the org that was being inspected then.
+	Complete bool         `json:"complete"`
+	Orgs     []jsonReport `json:"orgs"`
+}
+
+func writeOrgsJSON(w io.Writer, orgs []orgResults, complete bool) error {
+	doc := jsonMultiReport{
+		SchemaVersion: 1,
+		Complete:      complete,
+		Orgs:          []jsonReport{},
+	}
+	for _, org := range orgs {
+		doc.Orgs = append(doc.Orgs, newJSONReport(org.Org, org.Results, org.Grouping, org.Complete, org.Invisible, org.Role))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// MainMulti is Main for more than one org: it inspects each org in
+// turn, and prints a single report with an org column.  It supports
+// fewer options than Main; see the report command's checks.
+func MainMulti(ctx context.Context, orgnames []string, opts Options) error {
+	if err := requireToken(ctx); err != nil {
+		return err
+	}
+	if opts.Preflight {
+		for _, orgname := range orgnames {
+			if err := preflight(ctx, orgname, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var orgs []orgResults
+	var failed repoFailures
+	var err error
+	for _, orgname := range orgnames {
+		org := orgResults{Org: orgname, Grouping: Grouping{Buckets: opts.Sources, UINames: opts.UINames}}
+		orgs = append(orgs, org)
+		if org.Role, err = getViewerRole(ctx, orgname); err != nil {
+			break
+		}
+		if org.Grouping.NeedsMembers() || opts.Overlap {
+			if org.Grouping.Members, err = getOrgMembers(ctx, orgname); err != nil {
+				break
+			}
+		}
+		if opts.Overlap || opts.ExpandTeams {
+			if org.Teams, err = getTeamMembership(ctx, orgname); err != nil {
+				break
+			}
+		}
+		org.Results, org.Total, org.Invisible, err = collect(ctx, orgname, opts)
+		var orgFailed repoFailures
+		if errors.As(err, &orgFailed) {
+			failed = append(failed, orgFailed...)
+		}
+		if err == nil || err == errInterrupted || orgFailed != nil {
+			if opts.Filter != nil {
+				var filterErr error
+				if org.Results, filterErr = opts.Filter.Apply(org.Results); filterErr != nil {
+					return filterErr
+				}
+			}
+			if opts.ExpandTeams {
+				org.Results = expandTeams(org.Results, org.Teams)
+			}
+			org.Complete = err == nil
+			orgs[len(orgs)-1] = org
+		}
+		if orgFailed != nil {
+			// With --keep-going, on to the next org.
+			err = nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil && err != errInterrupted {
+		if ctx.Err() == nil {
+			return err
+		}
+		// Cut off while getting ready to inspect an org, rather
+		// than part-way through it.
+		err = errInterrupted
+	}
+
+	partialOutput := os.Stdout
+	switch {
+	case opts.Overlap:
+		users := findOverlap(orgs)
+		if opts.Format == "csv" {
+			if err := writeOverlapCSV(os.Stdout, orgs, users); err != nil {
+				return err
+			}
+			partialOutput = os.Stderr
+		} else {
+			writeOverlapTable(os.Stdout, orgs, users, opts.UINames)
+		}
+		outside := 0
+		for _, user := range users {
+			if user.Outside() {
+				outside++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%d users have access in more than one organization, %d of them as outside collaborators in at least one\n", len(users), outside)
+	case opts.Format == "json":
+		if err := writeOrgsJSON(os.Stdout, orgs, err == nil && failed == nil); err != nil {
+			return err
+		}
+		partialOutput = os.Stderr
+	case opts.Format == "csv":
+		if err := writeOrgsCSV(os.Stdout, orgs, true, opts.IncludeArchived); err != nil {
+			return err
+		}
+		partialOutput = os.Stderr
+	default:
+		if opts.Format == "markdown" {
+			writeOrgsMarkdown(os.Stdout, orgs, true, opts.ShowLicense, opts.DeploymentApprovers)
+		} else {
+			writeOrgsTable(os.Stdout, orgs, true, opts.ShowLicense, opts.DeploymentApprovers)
+		}
+		for _, org := range orgs {
+			// An org that was cut off before its role was
+			// known has nothing in the table to caveat.
+			if caveat := org.Role.Caveat(org.Org); caveat != "" && org.Role.Login != "" {
+				fmt.Fprintf(os.Stdout, "NOTE: %s\n", caveat)
+			}
+			if reason := emptyReason(org.Org, org.Total, org.Invisible, opts); reason != "" && org.Complete {
+				fmt.Fprintf(os.Stdout, "NOTE: %s\n", reason)
+			}
+		}
+	}
+	if err == errInterrupted {
+		last := orgs[len(orgs)-1]
+		fmt.Fprintf(partialOutput, "PARTIAL REPORT: interrupted after %d of %d organizations, and %d of %d repositories in %q\n",
+			len(orgs)-1, len(orgnames), len(last.Results), last.Total, last.Org)
+		return err
+	}
+	for _, org := range orgs {
+		printCoverage(org.Org, org.Invisible)
+	}
+	if failed != nil {
+		return failed
+	}
+	return nil
+}
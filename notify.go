@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// notifyConfig is the diff command's --notify file: where to send each
+// owning team's share of the changes, so that a request to put right
+// an unexpected grant goes to the people who can.
+type notifyConfig struct {
+	// Channels are Slack incoming webhook URLs (each of which posts
+	// to one channel), by team, named as in the report ("eng/dev").
+	Channels map[string]string `json:"channels"`
+	// Owners say which team owns the repos whose names match their
+	// globs, for repos where the teams with ADMIN aren't the right
+	// ones.  The first match wins.
+	Owners []notifyOwner `json:"owners"`
+	// Default is the webhook for the changes to repos whose owning
+	// team has no channel, or that have no owning team.  If it is
+	// empty, those changes are only printed.
+	Default string `json:"default"`
+}
+
+type notifyOwner struct {
+	Repos []string `json:"repos"`
+	Team  string   `json:"team"`
+}
+
+func loadNotifyConfig(filename string) (*notifyConfig, error) {
+	var cfg notifyConfig
+	if err := readConfigFile(filename, &cfg); err != nil {
+		return nil, err
+	}
+	for _, owner := range cfg.Owners {
+		if owner.Team == "" {
+			return nil, fmt.Errorf("%s: an owners entry has no team", filename)
+		}
+		if err := checkRepoPatterns("owners", owner.Repos); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// owningTeams returns the teams that own repo: the team of the first
+// of cfg's Owners whose globs match its name, or else the teams that
+// have ADMIN on it, which can change who has access.  grants is the
+// repo's grants.
+func (cfg *notifyConfig) owningTeams(repo string, grants []jsonGrant) []string {
+	for _, owner := range cfg.Owners {
+		for _, pattern := range owner.Repos {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(repo)); ok {
+				return []string{owner.Team}
+			}
+		}
+	}
+	var teams []string
+	for _, grant := range grants {
+		if grant.Kind == KindTeam && grant.Permission == PermADMIN {
+			teams = append(teams, grant.Source)
+		}
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// groupByOwner splits changes up by the team that owns each change's
+// repo, as of after (or before, for a repo that has been deleted).  A
+// change to a repo with more than one owning team goes to each of
+// them; one to a repo with none is under "".
+func (cfg *notifyConfig) groupByOwner(changes []grantChange, before, after *snapshotFile) map[string][]grantChange {
+	grants := make(map[string][]jsonGrant)
+	for _, snap := range []*snapshotFile{before, after} {
+		for _, repo := range snap.Repos {
+			grants[repo.Name] = repo.Grants
+		}
+	}
+	ret := make(map[string][]grantChange)
+	for _, change := range changes {
+		teams := cfg.owningTeams(change.Repo, grants[change.Repo])
+		if len(teams) == 0 {
+			teams = []string{""}
+		}
+		for _, team := range teams {
+			ret[team] = append(ret[team], change)
+		}
+	}
+	return ret
+}
+
+// notify posts each owning team's changes to its channel, or to the
+// default one.  Changes with nowhere to go are noted on stderr.
+func (cfg *notifyConfig) notify(ctx context.Context, orgname string, since time.Time, groups map[string][]grantChange) error {
+	teams := make([]string, 0, len(groups))
+	for team := range groups {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	for _, team := range teams {
+		changes := groups[team]
+		webhook := cfg.Channels[team]
+		if webhook == "" {
+			webhook = cfg.Default
+		}
+		owner := "team " + team
+		if team == "" {
+			owner = "no team"
+		}
+		if webhook == "" {
+			fmt.Fprintf(os.Stderr, "warning: --notify: %d changes to repositories owned by %s not sent, as there is no channel for them\n", len(changes), owner)
+			continue
+		}
+		var table bytes.Buffer
+		writeChanges(&table, changes)
+		text := fmt.Sprintf("%d access changes in %s repositories owned by %s since %s:\n```\n%s```",
+			len(changes), orgname, owner, since.Format("2006-01-02 15:04 MST"), table.String())
+		if err := postSlack(ctx, webhook, text); err != nil {
+			return fmt.Errorf("--notify: %s: %w", owner, err)
+		}
+		fmt.Fprintf(os.Stderr, "--notify: sent %d changes to repositories owned by %s\n", len(changes), owner)
+	}
+	return nil
+}
+
+// postSlack posts text to a Slack incoming webhook.  It doesn't go
+// through httpClient, so that the webhook's URL, which is a secret,
+// is never written to a --record-bundle.
+func postSlack(ctx context.Context, webhook, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	httpreq, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	httpreq.Header.Add("Content-Type", "application/json")
+	client := &http.Client{Timeout: httpClient.Timeout}
+	httpresp, err := client.Do(httpreq)
+	if urlErr, ok := err.(*url.Error); ok {
+		// Leave the URL out of the error.
+		return urlErr.Err
+	} else if err != nil {
+		return err
+	}
+	defer httpresp.Body.Close()
+	if httpresp.StatusCode != http.StatusOK {
+		respbody, _ := ioutil.ReadAll(httpresp.Body)
+		return fmt.Errorf("HTTP %s: %s", httpresp.Status, bytes.TrimSpace(respbody))
+	}
+	return nil
+}
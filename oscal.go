@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// oscalVersion is the version of the OSCAL schema that writeOSCAL
+// writes documents for.
+const oscalVersion = "1.1.2"
+
+// oscalNS is the namespace of the properties that writeOSCAL adds to
+// observations.
+const oscalNS = "https://github.com/datawire/collaborators"
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// The OSCAL assessment results model, or as much of it as writeOSCAL
+// uses; see https://pages.nist.gov/OSCAL/reference/1.1.2/assessment-results/json-reference/.
+type (
+	oscalDocument struct {
+		AssessmentResults oscalAssessmentResults `json:"assessment-results"`
+	}
+	oscalAssessmentResults struct {
+		UUID     string        `json:"uuid"`
+		Metadata oscalMetadata `json:"metadata"`
+		ImportAP struct {
+			Href string `json:"href"`
+		} `json:"import-ap"`
+		Results []oscalResult `json:"results"`
+	}
+	oscalMetadata struct {
+		Title        string    `json:"title"`
+		LastModified time.Time `json:"last-modified"`
+		Version      string    `json:"version"`
+		OSCALVersion string    `json:"oscal-version"`
+	}
+	oscalResult struct {
+		UUID             string     `json:"uuid"`
+		Title            string     `json:"title"`
+		Description      string     `json:"description"`
+		Start            time.Time  `json:"start"`
+		End              *time.Time `json:"end,omitempty"`
+		ReviewedControls struct {
+			ControlSelections []oscalControlSelection `json:"control-selections"`
+		} `json:"reviewed-controls"`
+		Observations []oscalObservation `json:"observations,omitempty"`
+		Findings     []oscalFinding     `json:"findings,omitempty"`
+		Remarks      string             `json:"remarks,omitempty"`
+	}
+	oscalControlSelection struct {
+		Description     string           `json:"description,omitempty"`
+		IncludeControls []oscalControlID `json:"include-controls,omitempty"`
+	}
+	oscalControlID struct {
+		ControlID string `json:"control-id"`
+	}
+	oscalObservation struct {
+		UUID        string      `json:"uuid"`
+		Title       string      `json:"title"`
+		Description string      `json:"description"`
+		Props       []oscalProp `json:"props,omitempty"`
+		Methods     []string    `json:"methods"`
+		Types       []string    `json:"types,omitempty"`
+		Collected   time.Time   `json:"collected"`
+	}
+	oscalProp struct {
+		Name  string `json:"name"`
+		NS    string `json:"ns"`
+		Value string `json:"value"`
+	}
+	oscalFinding struct {
+		UUID        string `json:"uuid"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Target      struct {
+			Type     string `json:"type"`
+			TargetID string `json:"target-id"`
+			Status   struct {
+				State string `json:"state"`
+			} `json:"status"`
+		} `json:"target"`
+		RelatedObservations []oscalRelatedObservation `json:"related-observations,omitempty"`
+	}
+	oscalRelatedObservation struct {
+		ObservationUUID string `json:"observation-uuid"`
+	}
+)
+
+// writeOSCAL writes the findings of checks as an OSCAL assessment
+// results document, for compliance tooling.  Each finding becomes an
+// observation, as does each check that found nothing (as evidence that
+// it was run).  Each control that the checks assess becomes an OSCAL
+// finding: "not-satisfied" if any of its checks found something of
+// warning severity or above, and "satisfied" otherwise.  importAP is
+// the href of the assessment plan that the results are for.  end is
+// nil if the run was interrupted.
+func writeOSCAL(w io.Writer, orgname, importAP string, checks []enabledCheck, findings []Finding, repos int, start time.Time, end *time.Time) error {
+	collected := time.Now().UTC()
+	if end != nil {
+		collected = *end
+	}
+	var doc oscalDocument
+	ar := &doc.AssessmentResults
+	ar.UUID = newUUID()
+	ar.Metadata = oscalMetadata{
+		Title:        fmt.Sprintf("GitHub access review of the %s organization", orgname),
+		LastModified: collected,
+		Version:      collected.Format("2006-01-02"),
+		OSCALVersion: oscalVersion,
+	}
+	ar.ImportAP.Href = importAP
+
+	result := oscalResult{
+		UUID:  newUUID(),
+		Title: fmt.Sprintf("%s check %s", progName, orgname),
+		Description: fmt.Sprintf("The results of %d checks against the access grants on %d repositories in the %s GitHub organization.",
+			len(checks), repos, orgname),
+		Start: start.UTC(),
+		End:   end,
+	}
+	if end == nil {
+		result.Remarks = "The run was interrupted, so not every repository was checked."
+	}
+
+	// Observations, and which of them bear on each control.
+	type controlStatus struct {
+		checks       []string
+		observations []oscalRelatedObservation
+		failed       bool
+	}
+	controls := make(map[string]*controlStatus)
+	for _, check := range checks {
+		for _, control := range check.Controls {
+			if controls[control] == nil {
+				controls[control] = &controlStatus{}
+			}
+			controls[control].checks = append(controls[control].checks, check.Name())
+		}
+	}
+	observe := func(check enabledCheck, obs oscalObservation, failed bool) {
+		obs.UUID = newUUID()
+		obs.Methods = []string{"TEST"}
+		obs.Collected = collected
+		result.Observations = append(result.Observations, obs)
+		for _, control := range check.Controls {
+			status := controls[control]
+			status.observations = append(status.observations, oscalRelatedObservation{ObservationUUID: obs.UUID})
+			status.failed = status.failed || failed
+		}
+	}
+	for _, check := range checks {
+		found := false
+		for _, finding := range findings {
+			if finding.Check != check.Name() {
+				continue
+			}
+			found = true
+			props := []oscalProp{
+				{Name: "check", NS: oscalNS, Value: finding.Check},
+				{Name: "severity", NS: oscalNS, Value: finding.Severity.String()},
+			}
+			if finding.Repo != "" {
+				props = append(props, oscalProp{Name: "repository", NS: oscalNS, Value: finding.Repo})
+			}
+			if finding.Principal != (Principal{}) {
+				props = append(props, oscalProp{Name: "principal", NS: oscalNS, Value: finding.Principal.String()})
+			}
+			title := finding.Check
+			if finding.Repo != "" {
+				title += ": " + finding.Repo
+			}
+			observe(check, oscalObservation{
+				Title:       title,
+				Description: finding.Message,
+				Props:       props,
+				Types:       []string{"finding"},
+			}, finding.Severity >= SeverityWarning)
+		}
+		if !found {
+			observe(check, oscalObservation{
+				Title:       check.Name(),
+				Description: fmt.Sprintf("Checked for %s, and found none.", check.Description()),
+				Props:       []oscalProp{{Name: "check", NS: oscalNS, Value: check.Name()}},
+			}, false)
+		}
+	}
+
+	// Findings, one per control.
+	controlIDs := make([]string, 0, len(controls))
+	for control := range controls {
+		controlIDs = append(controlIDs, control)
+	}
+	sort.Strings(controlIDs)
+	selection := oscalControlSelection{}
+	for _, control := range controlIDs {
+		status := controls[control]
+		selection.IncludeControls = append(selection.IncludeControls, oscalControlID{ControlID: control})
+		finding := oscalFinding{
+			UUID:                newUUID(),
+			Title:               strings.ToUpper(control),
+			Description:         "Assessed by: " + strings.Join(status.checks, ", "),
+			RelatedObservations: status.observations,
+		}
+		finding.Target.Type = "objective-id"
+		finding.Target.TargetID = control + "_obj"
+		finding.Target.Status.State = "satisfied"
+		if status.failed {
+			finding.Target.Status.State = "not-satisfied"
+		}
+		result.Findings = append(result.Findings, finding)
+	}
+	if len(controlIDs) == 0 {
+		selection.Description = "None of the checks that were run are mapped to controls."
+	}
+	result.ReviewedControls.ControlSelections = []oscalControlSelection{selection}
+
+	ar.Results = []oscalResult{result}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// userOverlap is a user who has access to repos in more than one of
+// the orgs of a multi-org report, for --overlap.
+type userOverlap struct {
+	Login string
+	// Access is the user's access in each org, in the same order as
+	// the orgs; its Permission is PermNONE in an org where they have
+	// none.
+	Access []orgAccess
+}
+
+// orgAccess is one user's access in one org.
+type orgAccess struct {
+	// Permission is the highest permission that the user has on any
+	// of the org's repos.
+	Permission Permission
+	// Outside is set if the user isn't a member of the org, which is
+	// how contractors are usually given access.
+	Outside bool
+}
+
+// Outside reports whether the user is an outside collaborator in any
+// of the orgs.
+func (u userOverlap) Outside() bool {
+	for _, access := range u.Access {
+		if access.Outside {
+			return true
+		}
+	}
+	return false
+}
+
+// findOverlap returns the users who have access in more than one of
+// orgs, sorted by login.  Each org must have its Teams and its
+// Grouping's Members.
+func findOverlap(orgs []orgResults) []userOverlap {
+	byLogin := make(map[string]*userOverlap)
+	for i, org := range orgs {
+		for _, access := range pivotByUser(org.Results, org.Grouping, org.Teams, org.Grouping.Members) {
+			user := byLogin[access.Login]
+			if user == nil {
+				user = &userOverlap{Login: access.Login, Access: make([]orgAccess, len(orgs))}
+				byLogin[access.Login] = user
+			}
+			if access.Permission > user.Access[i].Permission {
+				user.Access[i] = orgAccess{Permission: access.Permission, Outside: !org.Grouping.Members[access.Login]}
+			}
+		}
+	}
+	var ret []userOverlap
+	for _, user := range byLogin {
+		n := 0
+		for _, access := range user.Access {
+			if access.Permission > PermNONE {
+				n++
+			}
+		}
+		if n > 1 {
+			ret = append(ret, *user)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Login < ret[j].Login })
+	return ret
+}
+
+// writeOverlapTable writes a row for each of users, with a column for
+// each org saying what their highest permission in it is, marked
+// "(outside)" if they are an outside collaborator there.
+func writeOverlapTable(w io.Writer, orgs []orgResults, users []userOverlap, uiNames bool) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "User")
+	for _, org := range orgs {
+		fmt.Fprintf(output, "\t| %s", org.Org)
+	}
+	fmt.Fprintf(output, "\n----")
+	for _, org := range orgs {
+		fmt.Fprintf(output, "\t| %s", strings.Repeat("-", len(org.Org)))
+	}
+	fmt.Fprintf(output, "\n")
+	for _, user := range users {
+		fmt.Fprintf(output, "%s", user.Login)
+		for _, access := range user.Access {
+			switch {
+			case access.Permission == PermNONE:
+				fmt.Fprintf(output, "\t| -")
+			case access.Outside:
+				fmt.Fprintf(output, "\t| %s (outside)", permissionName(access.Permission, uiNames))
+			default:
+				fmt.Fprintf(output, "\t| %s", permissionName(access.Permission, uiNames))
+			}
+		}
+		fmt.Fprintf(output, "\n")
+	}
+	output.Flush()
+}
+
+// writeOverlapCSV writes a row for each org that each of users has
+// access in.
+func writeOverlapCSV(w io.Writer, orgs []orgResults, users []userOverlap) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"login", "org", "permission", "outside"})
+	for _, user := range users {
+		for i, access := range user.Access {
+			if access.Permission == PermNONE {
+				continue
+			}
+			_ = output.Write([]string{user.Login, orgs[i].Org, access.Permission.String(), strconv.FormatBool(access.Outside)})
+		}
+	}
+	output.Flush()
+	return output.Error()
+}
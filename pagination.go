@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// pageSizer picks the page size ("first: N") for paginated queries.
+// Bigger pages mean fewer requests, but GitHub will time out or
+// refuse (MAX_NODE_LIMIT_EXCEEDED) if a page is too expensive, which
+// depends a lot on the shape of the org.  So we start at the
+// configured size, halve it whenever GitHub gives up on a page, and
+// work back up to the configured size once pages are succeeding
+// again.
+type pageSizer struct {
+	mu     sync.Mutex
+	max    int
+	cur    int
+	streak int
+}
+
+// pageSizeRestoreAfter is how many successful pages in a row it takes
+// before the page size gets doubled back towards the maximum.
+const pageSizeRestoreAfter = 5
+
+var pageSize = &pageSizer{max: 100, cur: 100}
+
+// SetMax sets the configured page size; it must be between 1 and
+// 100.
+func (p *pageSizer) SetMax(n int) error {
+	if n < 1 || n > 100 {
+		return fmt.Errorf("page size must be between 1 and 100, got %d", n)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.max = n
+	p.cur = n
+	p.streak = 0
+	return nil
+}
+
+func (p *pageSizer) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cur
+}
+
+// Succeeded records that a page was fetched successfully.
+func (p *pageSizer) Succeeded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.streak++
+	if p.streak >= pageSizeRestoreAfter && p.cur < p.max {
+		p.cur *= 2
+		if p.cur > p.max {
+			p.cur = p.max
+		}
+		p.streak = 0
+	}
+}
+
+// Failed records that fetching a page failed with err, and returns
+// whether it is worth retrying the page with the (now smaller) page
+// size.
+func (p *pageSizer) Failed(err error) bool {
+	if !isPageTooExpensive(err) {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.streak = 0
+	if p.cur <= 1 {
+		return false
+	}
+	p.cur /= 2
+	fmt.Fprintf(os.Stderr, "page was too expensive, reducing page size to %d: %v\n", p.cur, err)
+	return true
+}
+
+// isPageTooExpensive returns whether err looks like GitHub giving up
+// on a query because of how much data it asked for, rather than
+// something that a smaller page wouldn't fix.
+func isPageTooExpensive(err error) bool {
+	msg := err.Error()
+	for _, needle := range []string{
+		"MAX_NODE_LIMIT_EXCEEDED",
+		"exceeds the maximum limit",
+		"This may be the result of a timeout",
+		"couldn't respond to your request in time",
+		"HTTP 502",
+		"HTTP 504",
+	} {
+		if strings.Contains(msg, needle) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// preflightCheck is one of preflight's checks.  Run returns a short
+// description of what it found.
+type preflightCheck struct {
+	Name string
+	Run  func() (string, error)
+}
+
+// preflight checks, with one cheap query per capability, that the
+// token can do each of the things that a run with opts needs, so that
+// a misconfigured token fails in seconds rather than part-way through
+// a long run.  It prints the result of each check to stderr.
+func preflight(ctx context.Context, orgname string, opts Options) error {
+	var reponame string
+	checks := []preflightCheck{
+		{
+			// Not a failure if it isn't an owner, but the
+			// report won't be complete.
+			Name: "token user's role",
+			Run: func() (string, error) {
+				role, err := getViewerRole(ctx, orgname)
+				return fmt.Sprintf("%s is an org %s", role.Login, role), err
+			},
+		},
+		{
+			Name: "list teams",
+			Run: func() (string, error) {
+				var resp struct {
+					Organization struct {
+						Teams struct {
+							TotalCount int
+						}
+					}
+				}
+				err := graphql(ctx, &resp, `
+query preflightTeams($orgname: String!) {
+  organization(login: $orgname) {
+    teams(first: 1) {
+      totalCount
+    }
+  }
+}`, map[string]interface{}{
+					"orgname": orgname,
+				})
+				return fmt.Sprintf("%d teams", resp.Organization.Teams.TotalCount), err
+			},
+		},
+		{
+			Name: "list repositories",
+			Run: func() (string, error) {
+				var resp struct {
+					Organization struct {
+						Repositories struct {
+							TotalCount int
+							Nodes      []struct {
+								Name string
+							}
+						}
+					}
+				}
+				err := graphql(ctx, &resp, `
+query preflightRepos($orgname: String!) {
+  organization(login: $orgname) {
+    repositories(first: 1, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      totalCount
+      nodes {
+        name
+      }
+    }
+  }
+}`, map[string]interface{}{
+					"orgname": orgname,
+				})
+				if nodes := resp.Organization.Repositories.Nodes; len(nodes) > 0 {
+					reponame = nodes[0].Name
+				}
+				return fmt.Sprintf("%d repositories", resp.Organization.Repositories.TotalCount), err
+			},
+		},
+		{
+			// See getRepos.  Not a failure if the private
+			// count is missing, but the coverage can't be
+			// verified.
+			Name: "count the org's repositories",
+			Run: func() (string, error) {
+				var rawOrg struct {
+					PublicRepos       int  `json:"public_repos"`
+					TotalPrivateRepos *int `json:"total_private_repos"`
+				}
+				if err := restGet(ctx, &rawOrg, "/orgs/%s", orgname); err != nil {
+					return "", err
+				}
+				if rawOrg.TotalPrivateRepos == nil {
+					return fmt.Sprintf("%d public, but this token can't see how many private ones there are, so coverage can't be verified", rawOrg.PublicRepos), nil
+				}
+				return fmt.Sprintf("%d public and %d private", rawOrg.PublicRepos, *rawOrg.TotalPrivateRepos), nil
+			},
+		},
+		{
+			Name: "list collaborators",
+			Run: func() (string, error) {
+				if reponame == "" {
+					// Nothing to report on, so nothing to fail.
+					return "skipped, as there is no repository to try it on", nil
+				}
+				var resp struct {
+					Organization struct {
+						Repository struct {
+							Collaborators struct {
+								TotalCount int
+							}
+						}
+					}
+				}
+				// The same fields as getRepoUsers, in case any of
+				// them needs more access than the rest.
+				err := graphql(ctx, &resp, `
+query preflightCollaborators($orgname: String!, $reponame: String!) {
+  organization(login: $orgname) {
+    repository(name: $reponame) {
+      collaborators(first: 1) {
+        totalCount
+        edges {
+          permission
+          permissionSources {
+            permission
+          }
+        }
+      }
+    }
+  }
+}`, map[string]interface{}{
+					"orgname":  orgname,
+					"reponame": reponame,
+				})
+				return fmt.Sprintf("%d collaborators on %q", resp.Organization.Repository.Collaborators.TotalCount, reponame), err
+			},
+		},
+	}
+	if opts.Team != "" {
+		checks = append(checks, preflightCheck{
+			Name: "list --team's repositories",
+			Run: func() (string, error) {
+				var resp struct {
+					Organization struct {
+						Team *struct {
+							Repositories struct {
+								TotalCount int
+							}
+						}
+					}
+				}
+				err := graphql(ctx, &resp, `
+query preflightTeamRepos($orgname: String!, $slug: String!) {
+  organization(login: $orgname) {
+    team(slug: $slug) {
+      repositories(first: 1) {
+        totalCount
+      }
+    }
+  }
+}`, map[string]interface{}{
+					"orgname": orgname,
+					"slug":    opts.Team,
+				})
+				if err != nil {
+					return "", err
+				}
+				if resp.Organization.Team == nil {
+					return "", fmt.Errorf("no team %q that this token can see", opts.Team)
+				}
+				return fmt.Sprintf("%d repositories", resp.Organization.Team.Repositories.TotalCount), nil
+			},
+		})
+	}
+	grouping := Grouping{Buckets: opts.Sources}
+	if grouping.NeedsMembers() || opts.needsTeamMembership() || opts.Overlap {
+		checks = append(checks, preflightCheck{
+			Name: "list members",
+			Run: func() (string, error) {
+				var resp struct {
+					Organization struct {
+						MembersWithRole struct {
+							TotalCount int
+						}
+					}
+				}
+				err := graphql(ctx, &resp, `
+query preflightMembers($orgname: String!) {
+  organization(login: $orgname) {
+    membersWithRole(first: 1) {
+      totalCount
+    }
+  }
+}`, map[string]interface{}{
+					"orgname": orgname,
+				})
+				return fmt.Sprintf("%d members", resp.Organization.MembersWithRole.TotalCount), err
+			},
+		})
+	}
+	if opts.needsTeamMembership() || opts.Overlap {
+		checks = append(checks, preflightCheck{
+			Name: "list team members",
+			Run: func() (string, error) {
+				var resp struct {
+					Organization struct {
+						Teams struct {
+							Nodes []struct {
+								Slug    string
+								Members struct {
+									TotalCount int
+								}
+							}
+						}
+					}
+				}
+				err := graphql(ctx, &resp, `
+query preflightTeamMembers($orgname: String!) {
+  organization(login: $orgname) {
+    teams(first: 1) {
+      nodes {
+        slug
+        members(membership: IMMEDIATE, first: 1) {
+          totalCount
+        }
+      }
+    }
+  }
+}`, map[string]interface{}{
+					"orgname": orgname,
+				})
+				if err != nil {
+					return "", err
+				}
+				if nodes := resp.Organization.Teams.Nodes; len(nodes) > 0 {
+					return fmt.Sprintf("%d members of team %q", nodes[0].Members.TotalCount, nodes[0].Slug), nil
+				}
+				return "skipped, as there is no team to try it on", nil
+			},
+		})
+	}
+	if opts.DeploymentApprovers {
+		checks = append(checks, preflightCheck{
+			Name: "list deployment environments",
+			Run: func() (string, error) {
+				if reponame == "" {
+					return "skipped, as there is no repository to try it on", nil
+				}
+				var resp struct {
+					Organization struct {
+						Repository struct {
+							Environments struct {
+								TotalCount int
+							}
+						}
+					}
+				}
+				err := graphql(ctx, &resp, `
+query preflightEnvironments($orgname: String!, $reponame: String!) {
+  organization(login: $orgname) {
+    repository(name: $reponame) {
+      environments(first: 1) {
+        totalCount
+        nodes {
+          protectionRules(first: 1) {
+            nodes {
+              type
+            }
+          }
+        }
+      }
+    }
+  }
+}`, map[string]interface{}{
+					"orgname":  orgname,
+					"reponame": reponame,
+				})
+				return fmt.Sprintf("%d environments on %q", resp.Organization.Repository.Environments.TotalCount, reponame), err
+			},
+		})
+	}
+	if opts.HTMLSiteRepo != "" {
+		checks = append(checks, preflightCheck{
+			Name: "push to --html-site-repo",
+			Run: func() (string, error) {
+				owner, name, _ := strings.Cut(opts.HTMLSiteRepo, "/")
+				var rawRepo struct {
+					Permissions *struct {
+						Push bool `json:"push"`
+					} `json:"permissions"`
+				}
+				if err := restGet(ctx, &rawRepo, "/repos/%s/%s", owner, name); err != nil {
+					return "", err
+				}
+				switch {
+				case rawRepo.Permissions == nil:
+					// As for a GitHub App's token.
+					return fmt.Sprintf("%s exists, but GitHub doesn't say whether this token can push to it", opts.HTMLSiteRepo), nil
+				case !rawRepo.Permissions.Push:
+					return "", fmt.Errorf("this token can't push to %s", opts.HTMLSiteRepo)
+				}
+				return fmt.Sprintf("can push to %s", opts.HTMLSiteRepo), nil
+			},
+		})
+	}
+
+	failed := 0
+	for _, check := range checks {
+		result, err := check.Run()
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "preflight: %s: FAILED: %v\n", check.Name, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "preflight: %s: ok (%s)\n", check.Name, result)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("preflight: %d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A profile is a named set of flags for running one audit job, kept in
+// the profiles file, so that several jobs on the same host can each
+// have their own organizations, token, output, and policy without
+// fighting over environment variables or repeating long command lines.
+// Flags given on the command line override the profile's.
+type profile struct {
+	// TokenEnv is the name of the environment variable that holds
+	// the profile's GitHub token, to use instead of GH_TOKEN or
+	// GITHUB_TOKEN; see resolveToken.
+	TokenEnv string `json:"token_env"`
+	// Orgs are the organizations to run against, if none are named
+	// on the command line.
+	Orgs []string `json:"orgs"`
+	// Flags are values for the flags that every command accepts, like
+	// "api-url" or "deadline".
+	Flags map[string]interface{} `json:"flags"`
+	// Commands are values for each command's own flags, by command
+	// name, like {"check": {"config": "policy.yaml"}}.
+	Commands map[string]map[string]interface{} `json:"commands"`
+}
+
+// profilesFile is the profiles file's content.
+type profilesFile struct {
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+// defaultProfilesFile returns where the profiles file is if
+// --profiles-file isn't given.
+func defaultProfilesFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("--profile: %w; give --profiles-file", err)
+	}
+	return filepath.Join(dir, progName, "profiles.yaml"), nil
+}
+
+// loadProfile returns the profile called name in the profiles file
+// filename (or if that is empty, the default one).
+func loadProfile(filename, name string) (*profile, error) {
+	if filename == "" {
+		var err error
+		if filename, err = defaultProfilesFile(); err != nil {
+			return nil, err
+		}
+	}
+	var file profilesFile
+	if err := readConfigFile(filename, &file); err != nil {
+		return nil, fmt.Errorf("--profile: %w", err)
+	}
+	prof := file.Profiles[name]
+	if prof == nil {
+		return nil, fmt.Errorf("--profile: %s: no profile named %q", filename, name)
+	}
+	for cmdName := range prof.Commands {
+		if lookupCommand(cmdName) == nil {
+			return nil, fmt.Errorf("--profile: %s: profile %q: unknown command %q", filename, name, cmdName)
+		}
+	}
+	return prof, nil
+}
+
+// profileFlagValue converts a flag's value in a profile to the string
+// that would be given on the command line: a list is joined with
+// commas, as in --sources=org,team.
+func profileFlagValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = profileFlagValue(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// apply sets each of fs's flags that the profile has a value for,
+// unless it was given on the command line.  fs is the flags of the command called cmdName.
+func (prof *profile) apply(fs *flag.FlagSet, cmdName string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	set := func(values map[string]interface{}, isCommon bool) error {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			switch {
+			case name == "profile" || name == "profiles-file":
+				return fmt.Errorf("--profile: a profile can't set --%s", name)
+			case isCommon && !commonFlags[name]:
+				return fmt.Errorf("--profile: --%s isn't accepted by every command; set it for the commands that accept it", name)
+			case fs.Lookup(name) == nil:
+				return fmt.Errorf("--profile: %s has no --%s flag", cmdName, name)
+			case given[name]:
+				continue
+			}
+			if err := fs.Set(name, profileFlagValue(values[name])); err != nil {
+				return fmt.Errorf("--profile: --%s: %w", name, err)
+			}
+		}
+		return nil
+	}
+	if err := set(prof.Flags, true); err != nil {
+		return err
+	}
+	if err := set(prof.Commands[cmdName], false); err != nil {
+		return err
+	}
+	if prof.TokenEnv != "" {
+		token := os.Getenv(prof.TokenEnv)
+		if token == "" {
+			return fmt.Errorf("--profile: the profile's token_env, %s, isn't set", prof.TokenEnv)
+		}
+		// Everything that talks to the API reads GH_TOKEN.
+		if err := os.Setenv("GH_TOKEN", token); err != nil {
+			return fmt.Errorf("--profile: %w", err)
+		}
+	}
+	return nil
+}
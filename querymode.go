@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// How GraphQL queries are sent, with --graphql-queries.  Some GitHub
+// Enterprise Server instances sit behind a gateway that limits the
+// size of queries, or only allows queries that it has been told about
+// in advance.
+const (
+	// queriesFull sends each query as it is written.
+	queriesFull = "full"
+	// queriesMinified sends each query without its comments and
+	// insignificant whitespace.
+	queriesMinified = "minified"
+	// queriesPersisted sends each query as the SHA-256 of its
+	// minified text, using the automatic persisted query protocol: if
+	// the server says that it doesn't know that hash, the request is
+	// sent again with the minified query too, for the server to
+	// remember.
+	queriesPersisted = "persisted"
+)
+
+var queryModes = []string{queriesFull, queriesMinified, queriesPersisted}
+
+// setQueryMode validates a --graphql-queries value.
+func setQueryMode(mode string) error {
+	for _, valid := range queryModes {
+		if mode == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --graphql-queries %q (must be '%s')", mode, strings.Join(queryModes, "', '"))
+}
+
+// persistedQueryExtension is the "extensions" of a request that
+// refers to a persisted query by its hash.
+type persistedQueryExtension struct {
+	PersistedQuery struct {
+		Version    int    `json:"version"`
+		SHA256Hash string `json:"sha256Hash"`
+	} `json:"persistedQuery"`
+}
+
+// isPersistedQueryNotFound returns whether errors (from a GraphQL
+// response) say that the server doesn't know a persisted query's hash.
+func isPersistedQueryNotFound(errors []interface{}) bool {
+	for _, gqlerr := range errors {
+		obj, ok := gqlerr.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if obj["message"] == "PersistedQueryNotFound" {
+			return true
+		}
+		if ext, ok := obj["extensions"].(map[string]interface{}); ok && ext["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+// minifiedQueries caches minifyQuery, since the same few queries are
+// sent over and over.
+var minifiedQueries sync.Map
+
+// minifyQuery returns query without its comments, commas, or any
+// whitespace that isn't needed to keep two names apart.  String
+// literals (including block strings) are left as they are.
+func minifyQuery(query string) string {
+	if cached, ok := minifiedQueries.Load(query); ok {
+		return cached.(string)
+	}
+	isNameChar := func(c byte) bool {
+		return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+	}
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+			space = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+			space = true
+		case strings.HasPrefix(query[i:], `"""`):
+			end := i + 3
+			for end < len(query) && !strings.HasPrefix(query[end:], `"""`) {
+				if strings.HasPrefix(query[end:], `\"""`) {
+					end += 3
+				}
+				end++
+			}
+			end += 3
+			if end > len(query) {
+				end = len(query)
+			}
+			b.WriteString(query[i:end])
+			i, space = end, false
+		case c == '"':
+			end := i + 1
+			for end < len(query) && query[end] != '"' {
+				if query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			if end > len(query) {
+				end = len(query)
+			}
+			b.WriteString(query[i:end])
+			i, space = end, false
+		default:
+			if space && b.Len() > 0 && isNameChar(b.String()[b.Len()-1]) && isNameChar(c) {
+				b.WriteByte(' ')
+			}
+			b.WriteByte(c)
+			i, space = i+1, false
+		}
+	}
+	minified := b.String()
+	minifiedQueries.Store(query, minified)
+	return minified
+}
+
+// queryHash returns the hash that a persisted query is known by.
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter paces requests against one of GitHub's rate limits, so
+// that a long run slows down as it nears the limit rather than running
+// in to it part-way through.  Every response tells us how much of the
+// limit is left and when it resets; once less than paceBelow of it is
+// left, requests are spread out evenly over the time until the reset,
+// and once it is used up they wait for the reset.
+type rateLimiter struct {
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	cost      int
+	resetAt   time.Time
+	// next is the earliest that the next request may be made.
+	next time.Time
+}
+
+// paceBelow is the fraction of the rate limit below which requests
+// start being spread out.
+const paceBelow = 0.2
+
+// maxRateLimitRetries is how many times a request that was rejected
+// because of a rate limit is retried before giving up; see withRetries.
+const maxRateLimitRetries = 5
+
+// The GraphQL API's rate limit is in points, and the REST API's in
+// requests; they are separate from each other.
+var (
+	graphqlRateLimit = &rateLimiter{}
+	restRateLimit    = &rateLimiter{}
+)
+
+// Update records the rate-limit status reported by a response to a
+// request that cost cost.
+func (r *rateLimiter) Update(limit, remaining, cost int, resetAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.known = true
+	r.limit = limit
+	r.remaining = remaining
+	r.cost = cost
+	r.resetAt = resetAt
+}
+
+// UntilReset returns how long it is until the rate limit resets, or a
+// minute if that isn't known.
+func (r *rateLimiter) UntilReset() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.known || !r.resetAt.After(time.Now()) {
+		return time.Minute
+	}
+	return time.Until(r.resetAt) + time.Second
+}
+
+// Wait blocks until it is time to make the next request, or until ctx
+// is done, returning ctx's error in that case.
+func (r *rateLimiter) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	start := now
+	if r.next.After(start) {
+		start = r.next
+	}
+	var interval time.Duration
+	if r.known && r.resetAt.After(now) && r.limit > 0 && float64(r.remaining) < paceBelow*float64(r.limit) {
+		cost := r.cost
+		if cost < 1 {
+			cost = 1
+		}
+		if r.remaining < cost {
+			start = r.resetAt.Add(time.Second)
+			fmt.Fprintf(os.Stderr, "rate limit used up; waiting until it resets at %s\n", r.resetAt.Local().Format(time.Kitchen))
+			// Until a response says otherwise, the requests
+			// queued up behind this one only need to wait for
+			// it.
+			r.known = false
+		} else {
+			interval = r.resetAt.Sub(now) / time.Duration(r.remaining/cost)
+		}
+	}
+	r.next = start.Add(interval)
+	r.mu.Unlock()
+
+	return sleep(ctx, time.Until(start))
+}
+
+// rateLimitedError is returned for a request that was rejected because
+// of a rate limit, and says how long to wait before trying again.
+type rateLimitedError struct {
+	wait time.Duration
+	err  error
+}
+
+func (e *rateLimitedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rateLimitedError) Unwrap() error {
+	return e.err
+}
+
+// checkRateLimited returns a *rateLimitedError if httpresp says that
+// the request was rejected because of a primary or secondary rate
+// limit, or nil if it wasn't.
+func checkRateLimited(httpresp *http.Response, body []byte) error {
+	if httpresp.StatusCode != http.StatusForbidden && httpresp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	err := fmt.Errorf("HTTP %s: %s", httpresp.Status, strings.TrimSpace(string(body)))
+	if secs, parseErr := strconv.Atoi(httpresp.Header.Get("Retry-After")); parseErr == nil {
+		return &rateLimitedError{wait: time.Duration(secs) * time.Second, err: err}
+	}
+	if httpresp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, parseErr := strconv.ParseInt(httpresp.Header.Get("X-RateLimit-Reset"), 10, 64); parseErr == nil {
+			return &rateLimitedError{wait: time.Until(time.Unix(reset, 0)) + time.Second, err: err}
+		}
+	}
+	if strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		// GitHub says to wait at least a minute if it doesn't say
+		// how long.
+		return &rateLimitedError{wait: time.Minute, err: err}
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// RepoReport is everything that we collected about who has access to
+// a single repository.
+type RepoReport struct {
+	Repo          RepoHandle
+	Collaborators map[Principal]Permission
+	// DeploymentApprovers maps each required reviewer of the repo's
+	// deployment environments to the environments that they can
+	// approve deployments to.  It is only collected if asked for.
+	DeploymentApprovers map[Principal][]string
+	// Users is everyone who has access to the repo, each with their
+	// effective permission as GitHub reports it and the sources
+	// that it comes from.  It is only collected if asked for.
+	Users []repoUser
+}
+
+// formatLicense returns a human-readable form of RepoHandle.License.
+func formatLicense(spdxID string) string {
+	switch spdxID {
+	case "":
+		return "(none)"
+	case "NOASSERTION":
+		return "(unrecognized)"
+	default:
+		return spdxID
+	}
+}
+
+// sortedPrincipals returns the principals in collaborators, sorted
+// by kind and then name.
+func sortedPrincipals(collaborators map[Principal]Permission) []Principal {
+	ret := make([]Principal, 0, len(collaborators))
+	for principal := range collaborators {
+		ret = append(ret, principal)
+	}
+	sortPrincipals(ret)
+	return ret
+}
+
+// sortPrincipals sorts principals by kind and then name.
+func sortPrincipals(principals []Principal) {
+	sort.Slice(principals, func(i, j int) bool {
+		if principals[i].Kind != principals[j].Kind {
+			return principals[i].Kind < principals[j].Kind
+		}
+		return principals[i].Name < principals[j].Name
+	})
+}
+
+// repoLabel returns how a repo is identified in a table: by its URL,
+// marked if it is archived.
+func repoLabel(repo RepoHandle) string {
+	if repo.IsArchived {
+		return repo.URL + " (archived)"
+	}
+	return repo.URL
+}
+
+// writeTable writes the report as a table with one row per repo and
+// one column per bucket in grouping, and optionally columns with each
+// repo's license and deployment approvers.
+func writeTable(w io.Writer, results []RepoReport, grouping Grouping, showLicense, showApprovers bool) {
+	writeOrgsTable(w, []orgResults{{Results: results, Grouping: grouping}}, false, showLicense, showApprovers)
+}
+
+// writeOrgsTable writes the reports of several orgs as a single table,
+// like writeTable, with an "Org" column first if withOrg.  Each org is
+// formatted with its own Grouping, since whether a user is a member
+// depends on the org, but they must all have the same Buckets.
+func writeOrgsTable(w io.Writer, orgs []orgResults, withOrg, showLicense, showApprovers bool) {
+	buckets := orgs[0].Grouping.Buckets
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if withOrg {
+		fmt.Fprintf(output, "Org\t| ")
+	}
+	fmt.Fprintf(output, "Repository URL")
+	if showLicense {
+		fmt.Fprintf(output, "\t| License")
+	}
+	for _, b := range buckets {
+		fmt.Fprintf(output, "\t| %s", b.Title)
+	}
+	if showApprovers {
+		fmt.Fprintf(output, "\t| Deployment approvers")
+	}
+	fmt.Fprintf(output, "\n")
+	if withOrg {
+		fmt.Fprintf(output, "---\t| ")
+	}
+	fmt.Fprintf(output, "--------------")
+	if showLicense {
+		fmt.Fprintf(output, "\t| -------")
+	}
+	for _, b := range buckets {
+		fmt.Fprintf(output, "\t| %s", strings.Repeat("-", len(b.Title)))
+	}
+	if showApprovers {
+		fmt.Fprintf(output, "\t| --------------------")
+	}
+	fmt.Fprintf(output, "\n")
+	for _, org := range orgs {
+		for _, result := range org.Results {
+			if withOrg {
+				fmt.Fprintf(output, "%s\t| ", org.Org)
+			}
+			fmt.Fprintf(output, "%s", repoLabel(result.Repo))
+			if showLicense {
+				fmt.Fprintf(output, "\t| %s", formatLicense(result.Repo.License))
+			}
+			for _, b := range buckets {
+				fmt.Fprintf(output, "\t| %s", org.Grouping.Format(result.Collaborators, b))
+			}
+			if showApprovers {
+				fmt.Fprintf(output, "\t| %s", formatDeploymentApprovers(result.DeploymentApprovers, org.Grouping))
+			}
+			fmt.Fprintf(output, "\n")
+		}
+	}
+	output.Flush()
+}
+
+// mdEscape escapes text for use in a cell of a Markdown table.
+var mdEscape = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`",
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`,
+).Replace
+
+// writeMarkdown writes the report as a GitHub-flavored Markdown table,
+// with the same columns as writeTable, for pasting in to an issue or a
+// wiki page.
+func writeMarkdown(w io.Writer, results []RepoReport, grouping Grouping, showLicense, showApprovers bool) {
+	writeOrgsMarkdown(w, []orgResults{{Results: results, Grouping: grouping}}, false, showLicense, showApprovers)
+}
+
+// writeOrgsMarkdown is writeMarkdown for the reports of several orgs,
+// as writeOrgsTable is to writeTable.
+func writeOrgsMarkdown(w io.Writer, orgs []orgResults, withOrg, showLicense, showApprovers bool) {
+	buckets := orgs[0].Grouping.Buckets
+	var header []string
+	if withOrg {
+		header = append(header, "Org")
+	}
+	header = append(header, "Repository")
+	if showLicense {
+		header = append(header, "License")
+	}
+	for _, b := range buckets {
+		header = append(header, b.Title)
+	}
+	if showApprovers {
+		header = append(header, "Deployment approvers")
+	}
+	row := func(cells []string) {
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+	row(header)
+	rule := make([]string, len(header))
+	for i := range rule {
+		rule[i] = "---"
+	}
+	row(rule)
+	for _, org := range orgs {
+		for _, result := range org.Results {
+			var cells []string
+			if withOrg {
+				cells = append(cells, mdEscape(org.Org))
+			}
+			repo := fmt.Sprintf("[%s](%s)", mdEscape(result.Repo.Name), result.Repo.URL)
+			if result.Repo.IsArchived {
+				repo += " (archived)"
+			}
+			cells = append(cells, repo)
+			if showLicense {
+				cells = append(cells, mdEscape(formatLicense(result.Repo.License)))
+			}
+			for _, b := range buckets {
+				cells = append(cells, mdEscape(org.Grouping.Format(result.Collaborators, b)))
+			}
+			if showApprovers {
+				cells = append(cells, mdEscape(formatDeploymentApprovers(result.DeploymentApprovers, org.Grouping)))
+			}
+			row(cells)
+		}
+	}
+	// Without a blank line, anything printed after the table (like
+	// a NOTE) would be taken as another row.
+	fmt.Fprintf(w, "\n")
+}
+
+// writeACLClusters writes the report grouped by ACL: each distinct
+// set of grants (considering only the buckets in grouping) is listed
+// once, along with every repo that has exactly that set of grants.  The
+// most common ACLs are listed first, and ties are broken by the URL of
+// their first repo.
+func writeACLClusters(w io.Writer, results []RepoReport, grouping Grouping) {
+	type cluster struct {
+		Buckets []string
+		Repos   []string
+	}
+	var clusters []*cluster
+	byKey := make(map[string]*cluster)
+	for _, result := range results {
+		formatted := make([]string, len(grouping.Buckets))
+		for i, b := range grouping.Buckets {
+			formatted[i] = grouping.Format(result.Collaborators, b)
+		}
+		key := strings.Join(formatted, "\n")
+		c, ok := byKey[key]
+		if !ok {
+			c = &cluster{Buckets: formatted}
+			byKey[key] = c
+			clusters = append(clusters, c)
+		}
+		c.Repos = append(c.Repos, repoLabel(result.Repo))
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if len(clusters[i].Repos) != len(clusters[j].Repos) {
+			return len(clusters[i].Repos) > len(clusters[j].Repos)
+		}
+		return clusters[i].Repos[0] < clusters[j].Repos[0]
+	})
+
+	fmt.Fprintf(w, "%d distinct ACLs across %d repositories\n", len(clusters), len(results))
+	for i, c := range clusters {
+		fmt.Fprintf(w, "\nACL #%d (%d repositories)\n", i+1, len(c.Repos))
+		output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for j, b := range grouping.Buckets {
+			items := c.Buckets[j]
+			if items == "" {
+				items = "(none)"
+			}
+			fmt.Fprintf(output, "  %s:\t%s\n", b.Title, items)
+		}
+		output.Flush()
+		fmt.Fprintf(w, "  Repositories:\n")
+		for _, repo := range c.Repos {
+			fmt.Fprintf(w, "    %s\n", repo)
+		}
+	}
+}
+
+// jsonReport is the schema of --format=json.  Fields may be added, but
+// existing ones won't be changed or removed without bumping
+// SchemaVersion.
+type jsonReport struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Org           string `json:"org"`
+	// Complete is false if the run was interrupted, in which case
+	// Repos only has the repos that were inspected before then.
+	Complete bool `json:"complete"`
+	// InvisibleRepos is how many of the org's repos the token
+	// couldn't see, and so aren't included.  Unless
+	// CoverageVerified, there's no telling, and it is null.
+	InvisibleRepos   *int `json:"invisibleRepos"`
+	CoverageVerified bool `json:"coverageVerified"`
+	// TokenRole is the token user's role in the org: "owner",
+	// "member", or "non-member"; or with --app-id, "app" if the app's
+	// installation can see what an owner would, or "limited-app" if
+	// not.  Anything other than "owner" or "app" means the report may
+	// be missing things; see viewerRole.
+	TokenRole string     `json:"tokenRole"`
+	Repos     []jsonRepo `json:"repos"`
+}
+
+type jsonRepo struct {
+	Name       string      `json:"name"`
+	URL        string      `json:"url"`
+	Visibility string      `json:"visibility"`
+	License    string      `json:"license"`
+	Archived   bool        `json:"archived"`
+	Grants     []jsonGrant `json:"grants"`
+	// DeploymentApprovers is only included if they were collected.
+	DeploymentApprovers []jsonApprover `json:"deploymentApprovers,omitempty"`
+}
+
+type jsonGrant struct {
+	Source     string        `json:"source"`
+	Kind       PrincipalKind `json:"kind"`
+	Permission Permission    `json:"permission"`
+}
+
+type jsonApprover struct {
+	Source       string        `json:"source"`
+	Kind         PrincipalKind `json:"kind"`
+	Capability   string        `json:"capability"`
+	Environments []string      `json:"environments"`
+}
+
+// writeJSON writes the report as a single JSON document.  Only grants
+// that fall in at least one of grouping's buckets are included.
+func writeJSON(w io.Writer, orgname string, results []RepoReport, grouping Grouping, complete bool, invisible int, role viewerRole) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newJSONReport(orgname, results, grouping, complete, invisible, role))
+}
+
+// newJSONReport returns the --format=json document for an org.
+func newJSONReport(orgname string, results []RepoReport, grouping Grouping, complete bool, invisible int, role viewerRole) jsonReport {
+	doc := jsonReport{
+		SchemaVersion: 1,
+		Org:           orgname,
+		Complete:      complete,
+		TokenRole:     role.String(),
+		Repos:         []jsonRepo{},
+	}
+	if invisible != coverageUnknown {
+		doc.InvisibleRepos = &invisible
+		doc.CoverageVerified = true
+	}
+	for _, result := range results {
+		doc.Repos = append(doc.Repos, newJSONRepo(result, grouping))
+	}
+	return doc
+}
+
+// newJSONRepo returns a repo's entry in --format=json.  Only grants that
+// fall in at least one of grouping's buckets are included.
+func newJSONRepo(result RepoReport, grouping Grouping) jsonRepo {
+	repo := jsonRepo{
+		Name:       result.Repo.Name,
+		URL:        result.Repo.URL,
+		Visibility: result.Repo.Visibility,
+		License:    result.Repo.License,
+		Archived:   result.Repo.IsArchived,
+		Grants:     []jsonGrant{},
+	}
+	for _, principal := range sortedPrincipals(result.Collaborators) {
+		if !grouping.Matches(principal) {
+			continue
+		}
+		repo.Grants = append(repo.Grants, jsonGrant{
+			Source:     principal.Name,
+			Kind:       principal.Kind,
+			Permission: result.Collaborators[principal],
+		})
+	}
+	for _, principal := range sortedApprovers(result.DeploymentApprovers) {
+		if !grouping.Matches(principal) {
+			continue
+		}
+		repo.DeploymentApprovers = append(repo.DeploymentApprovers, jsonApprover{
+			Source:       principal.Name,
+			Kind:         principal.Kind,
+			Capability:   CapabilityDeploymentApprover,
+			Environments: result.DeploymentApprovers[principal],
+		})
+	}
+	return repo
+}
+
+// writeCSV writes the report as CSV, with one row per grant (rather
+// than per repo), so that it can be sorted and pivoted in a
+// spreadsheet.  Only grants that fall in at least one of grouping's
+// buckets are included.  withArchived adds an "archived" column.
+func writeCSV(w io.Writer, results []RepoReport, grouping Grouping, withArchived bool) error {
+	return writeOrgsCSV(w, []orgResults{{Results: results, Grouping: grouping}}, false, withArchived)
+}
+
+// writeOrgsCSV writes the reports of several orgs as CSV, like
+// writeCSV, with an "org" column first if withOrg.
+func writeOrgsCSV(w io.Writer, orgs []orgResults, withOrg, withArchived bool) error {
+	output := csv.NewWriter(w)
+	header := []string{"repository", "url", "kind", "source", "permission"}
+	if withOrg {
+		header = append([]string{"org"}, header...)
+	}
+	if withArchived {
+		header = append(header, "archived")
+	}
+	_ = output.Write(header)
+	for _, org := range orgs {
+		for _, result := range org.Results {
+			for _, principal := range sortedPrincipals(result.Collaborators) {
+				if !org.Grouping.Matches(principal) {
+					continue
+				}
+				row := []string{
+					result.Repo.Name,
+					result.Repo.URL,
+					string(principal.Kind),
+					principal.Name,
+					result.Collaborators[principal].String(),
+				}
+				if withOrg {
+					row = append([]string{org.Org}, row...)
+				}
+				if withArchived {
+					row = append(row, strconv.FormatBool(result.Repo.IsArchived))
+				}
+				_ = output.Write(row)
+			}
+		}
+	}
+	output.Flush()
+	return output.Error()
+}
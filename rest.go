@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// restGet makes a GET request to the GitHub REST API, for the few
+// things that the GraphQL API doesn't expose.  path is a format string
+// for the args, which get path-escaped before being substituted in to
+// it.  --stats groups requests by the unexpanded path (with each
+// argument shown as "{}"), the same as by GraphQL operation name.
+//
+// REST requests are charged against a separate rate limit from GraphQL
+// queries, so they are recorded with a cost of 0, and paced separately.
+func restGet(ctx context.Context, out interface{}, path string, args ...interface{}) error {
+	return restRequest(ctx, http.MethodGet, nil, out, path, args...)
+}
+
+// restDelete makes a DELETE request to the GitHub REST API, in the
+// same way as restGet.
+func restDelete(ctx context.Context, path string, args ...interface{}) error {
+	return restRequest(ctx, http.MethodDelete, nil, nil, path, args...)
+}
+
+// restPost makes a POST request to the GitHub REST API, with in as its
+// JSON body, in the same way as restGet.
+func restPost(ctx context.Context, in, out interface{}, path string, args ...interface{}) error {
+	return restRequest(ctx, http.MethodPost, in, out, path, args...)
+}
+
+// restPatch makes a PATCH request to the GitHub REST API, in the same
+// way as restPost.
+func restPatch(ctx context.Context, in, out interface{}, path string, args ...interface{}) error {
+	return restRequest(ctx, http.MethodPatch, in, out, path, args...)
+}
+
+func restRequest(ctx context.Context, method string, in, out interface{}, path string, args ...interface{}) error {
+	opname := method + " " + strings.NewReplacer("%s", "{}", "%d", "{}").Replace(strings.SplitN(path, "?", 2)[0])
+	for i, arg := range args {
+		if str, ok := arg.(string); ok {
+			args[i] = url.PathEscape(str)
+		}
+	}
+	var reqbody []byte
+	if in != nil {
+		var err error
+		if reqbody, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	transient := isTransient
+	if method != http.MethodGet {
+		// The request may have been carried out before it failed,
+		// and doing it again could fail (a second DELETE gets a
+		// 404) or do it twice.  Only a rate limit, which GitHub
+		// returns without doing anything, is retried.
+		transient = func(error) bool { return false }
+	}
+	return withRetries(ctx, restRateLimit, opname, transient, func(attempt int) error {
+		return restRequestOnce(ctx, method, reqbody, out, opname, fmt.Sprintf(path, args...), attempt)
+	})
+}
+
+func restRequestOnce(ctx context.Context, method string, reqbody []byte, out interface{}, opname, path string, attempt int) (err error) {
+	ctx, span := startSpan(ctx, opname, true)
+	start := time.Now()
+	remaining := "unknown"
+	defer func() {
+		latency := time.Since(start)
+		stats.record(opname, attempt, latency, 0, err)
+		span.SetAttr("http.request.method", method)
+		span.End(err)
+		if flagDebug {
+			fmt.Fprintf(os.Stderr, "debug: %s: rest-remaining=%s latency=%v err=%v\n", opname, remaining, latency.Round(time.Millisecond), err)
+		}
+	}()
+
+	var body io.Reader
+	if reqbody != nil {
+		body = bytes.NewReader(reqbody)
+	}
+	httpreq, err := http.NewRequestWithContext(ctx, method, restURL+path, body)
+	if err != nil {
+		return err
+	}
+	if reqbody != nil {
+		httpreq.Header.Add("Content-Type", "application/json")
+	}
+	auth, err := authorization(ctx)
+	if err != nil {
+		return err
+	}
+	httpreq.Header.Add("Authorization", auth)
+	httpreq.Header.Add("Accept", "application/vnd.github+json")
+	httpreq.Header.Add("X-GitHub-Api-Version", "2022-11-28")
+
+	httpresp, err := httpClient.Do(httpreq)
+	if err != nil {
+		return err
+	}
+	defer httpresp.Body.Close()
+	if val := httpresp.Header.Get("X-RateLimit-Remaining"); val != "" {
+		remaining = val
+	}
+	limit, limitErr := strconv.Atoi(httpresp.Header.Get("X-RateLimit-Limit"))
+	left, leftErr := strconv.Atoi(httpresp.Header.Get("X-RateLimit-Remaining"))
+	reset, resetErr := strconv.ParseInt(httpresp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if limitErr == nil && leftErr == nil && resetErr == nil {
+		restRateLimit.Update(limit, left, 1, time.Unix(reset, 0))
+	}
+
+	respbody, err := ioutil.ReadAll(httpresp.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkRateLimited(httpresp, respbody); err != nil {
+		return err
+	}
+	switch httpresp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	default:
+		return fmt.Errorf("HTTP %s: %s", httpresp.Status, bytes.TrimSpace(respbody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respbody, out)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// httpClient is used for every request to GitHub.  It has a timeout
+// (--request-timeout) so that a connection that hangs turns in to an
+// error that can be retried, rather than hanging the run.
+var httpClient = &http.Client{Timeout: time.Minute}
+
+// sleep waits for d, or until ctx is done, returning ctx's error in
+// that case.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isTransient returns whether err looks like a failure that might well
+// not happen again if the request were simply repeated: a network
+// error or timeout, or GitHub having a bad moment.
+func isTransient(err error) bool {
+	if errors.Is(err, errNotRecorded) {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	msg := err.Error()
+	for _, prefix := range []string{"HTTP 500", "HTTP 502", "HTTP 503", "HTTP 504"} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetries calls do, after waiting for limiter.  If that fails
+// because of a rate limit, it waits as long as GitHub asked and tries
+// again, up to maxRateLimitRetries times.  If it fails in a way that
+// transient says is worth retrying, it waits --retry-backoff, then
+// twice that, and so on, up to --retries times.  It stops waiting, and
+// doesn't retry, once ctx is done.  do is passed the number of the
+// attempt: 0 the first time, 1 for the first retry, and so on.
+func withRetries(ctx context.Context, limiter *rateLimiter, opname string, transient func(error) bool, do func(attempt int) error) error {
+	rateLimited, failed := 0, 0
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := do(attempt)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// The request was cut off, not failed.
+			return err
+		}
+		if rlErr, ok := err.(*rateLimitedError); ok {
+			if rateLimited >= maxRateLimitRetries {
+				return err
+			}
+			rateLimited++
+			if rlErr.wait < time.Second {
+				rlErr.wait = time.Second
+			}
+			fmt.Fprintf(os.Stderr, "%s: rate limited; retrying in %v: %v\n", opname, rlErr.wait.Round(time.Second), rlErr.err)
+			if err := sleep(ctx, rlErr.wait); err != nil {
+				return err
+			}
+			continue
+		}
+		if !transient(err) || failed >= flagRetries {
+			return err
+		}
+		wait := flagRetryBackoff << failed
+		failed++
+		fmt.Fprintf(os.Stderr, "%s: retrying in %v (retry %d of %d): %v\n", opname, wait, failed, flagRetries, err)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// BranchProtection is the branch protection rule that applies to a
+// repository's default branch.
+type BranchProtection struct {
+	AllowsForcePushes     bool
+	AllowsDeletions       bool
+	RequiresLinearHistory bool
+	// RequiresApprovingReviews is whether changes have to be made
+	// through a pull request, with at least
+	// RequiredApprovingReviewCount approvals.
+	RequiresApprovingReviews     bool
+	RequiredApprovingReviewCount int
+}
+
+// RepoSettings are the settings of a repository that determine what
+// WRITE access to it can actually do: if its default branch isn't
+// protected, anyone who can push can rewrite or delete it without a
+// review.
+type RepoSettings struct {
+	HasIssues          bool
+	MergeCommitAllowed bool
+	SquashMergeAllowed bool
+	RebaseMergeAllowed bool
+
+	// DefaultBranch is empty if the repository is empty.
+	DefaultBranch string
+	// Protection is nil if the default branch has no protection
+	// rule, or if the token isn't allowed to see it (which takes
+	// ADMIN on the repository).
+	Protection *BranchProtection
+}
+
+// MergeMethods returns the ways that pull requests can be merged:
+// "merge", "squash", and "rebase".
+func (s RepoSettings) MergeMethods() []string {
+	var ret []string
+	if s.MergeCommitAllowed {
+		ret = append(ret, "merge")
+	}
+	if s.SquashMergeAllowed {
+		ret = append(ret, "squash")
+	}
+	if s.RebaseMergeAllowed {
+		ret = append(ret, "rebase")
+	}
+	return ret
+}
+
+// AllowsForcePushes returns whether anyone with WRITE can force-push
+// to the default branch.
+func (s RepoSettings) AllowsForcePushes() bool {
+	return s.Protection == nil || s.Protection.AllowsForcePushes
+}
+
+// AllowsDeletions returns whether anyone with WRITE can delete the
+// default branch.
+func (s RepoSettings) AllowsDeletions() bool {
+	return s.Protection == nil || s.Protection.AllowsDeletions
+}
+
+// RequiresLinearHistory returns whether merge commits can't be pushed
+// to the default branch.
+func (s RepoSettings) RequiresLinearHistory() bool {
+	return s.Protection != nil && s.Protection.RequiresLinearHistory
+}
+
+// RequiredApprovals returns how many approvals a pull request to the
+// default branch needs, or -1 if changes don't have to go through a
+// pull request at all.
+func (s RepoSettings) RequiredApprovals() int {
+	if s.Protection == nil || !s.Protection.RequiresApprovingReviews {
+		return -1
+	}
+	return s.Protection.RequiredApprovingReviewCount
+}
+
+// writeSettings writes each repo's settings as a table.
+func writeSettings(w io.Writer, repos []RepoHandle) {
+	yesNo := func(b bool, yes, no string) string {
+		if b {
+			return yes
+		}
+		return no
+	}
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Repository URL\t| Issues\t| Merge methods\t| Default branch\t| Pull requests\t| Linear history\t| Force pushes\t| Deletions\n")
+	fmt.Fprintf(output, "--------------\t| ------\t| -------------\t| --------------\t| -------------\t| --------------\t| ------------\t| ---------\n")
+	for _, repo := range repos {
+		s := repo.Settings
+		branch := s.DefaultBranch
+		switch {
+		case branch == "":
+			branch = "(empty)"
+		case s.Protection == nil:
+			branch += " (unprotected)"
+		}
+		prs := "not required"
+		if n := s.RequiredApprovals(); n >= 0 {
+			prs = fmt.Sprintf("required, %d approvals", n)
+		}
+		fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\t| %s\t| %s\t| %s\t| %s\n",
+			repoLabel(repo),
+			yesNo(s.HasIssues, "enabled", "disabled"),
+			strings.Join(s.MergeMethods(), " "),
+			branch,
+			prs,
+			yesNo(s.RequiresLinearHistory(), "required", "not required"),
+			yesNo(s.AllowsForcePushes(), "allowed", "blocked"),
+			yesNo(s.AllowsDeletions(), "allowed", "blocked"))
+	}
+	output.Flush()
+}
+
+var settingsCommand = &command{
+	Name:    "settings",
+	Args:    []string{"ORGNAME"},
+	Summary: "List the merge and branch protection settings of every repository",
+	Description: `
+Prints a table with a row for each repository, saying whether it has
+issues enabled, which merge methods its pull requests can use, and
+how its default branch is protected: whether changes need a pull
+request (and how many approvals), whether history has to be linear,
+and whether the branch can be force-pushed to or deleted.
+
+These settings decide what WRITE access can actually do: on a
+repository whose default branch is unprotected, anyone with WRITE can
+rewrite its history without a review.  The repo-settings check (see
+"check --list") turns them into policy.
+
+Seeing a branch protection rule takes ADMIN on the repository; if
+the token doesn't have it, the default branch shows as unprotected.`,
+	Examples: []example{
+		{"List the settings of each repository in the datawire organization.", progName + " settings datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		includeArchived := fs.Bool("include-archived", false, "also include archived repositories")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			role, err := getViewerRole(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			repos, invisible, err := getRepos(ctx, orgname, *includeArchived)
+			if err != nil {
+				return err
+			}
+			sortRepos(repos, "name")
+			writeSettings(os.Stdout, repos)
+			if caveat := role.Caveat(orgname); caveat != "" {
+				fmt.Fprintf(os.Stdout, "NOTE: %s\n", caveat)
+			}
+			printCoverage(orgname, invisible)
+			return nil
+		}
+	},
+}
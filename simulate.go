@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// teamChanges is a hypothetical set of changes to an org's teams, to
+// see what they would do to who has access to what before making them.
+type teamChanges struct {
+	// DeleteTeams is the slugs of teams to delete, along with their
+	// child teams, as GitHub does.
+	DeleteTeams []string
+	// RemoveMembers maps team slugs to the logins of immediate
+	// members to remove from them.
+	RemoveMembers map[string][]string
+}
+
+// Apply returns results as they would be after the changes to teams:
+// without the grants to deleted teams, and with each user's Users
+// entry left with only the sources that they would still have.  The
+// org's grant and grants directly to the user are always kept.  A
+// user's permission is as repoUser.withSources has it: if they had
+// more than their sources said (say, MAINTAIN) and lose the source it
+// may have come from, what they are left with is marked approximate.
+//
+// GitHub may say that a user gets access through a team that, as far
+// as teams goes, they aren't in: say, a secret team whose members the
+// token can't see.  Unless the team is deleted, they are assumed to
+// keep that access, and if the changes affect the team, they are
+// returned in unseen, by team slug, so that they can be warned about.
+//
+// It returns an error if the changes name a team that doesn't exist, or
+// a user who isn't an immediate member of the team.  Neither argument
+// is modified.
+func (c teamChanges) Apply(results []RepoReport, teams teamMembership) (_ []RepoReport, unseen map[string][]string, _ error) {
+	deleted := make(map[string]bool)
+	for _, slug := range c.DeleteTeams {
+		if _, ok := teams.Members[slug]; !ok {
+			return nil, nil, fmt.Errorf("no team %q that this token can see", slug)
+		}
+		deleted[slug] = true
+	}
+	isDeleted := func(slug string) bool {
+		for tip := slug; tip != ""; tip = teams.Parents[tip] {
+			if deleted[tip] {
+				return true
+			}
+		}
+		return false
+	}
+
+	after := teamMembership{
+		Members: make(map[string][]string, len(teams.Members)),
+		Parents: teams.Parents,
+	}
+	for slug, logins := range teams.Members {
+		if !isDeleted(slug) {
+			after.Members[slug] = logins
+		}
+	}
+	for slug, remove := range c.RemoveMembers {
+		logins, ok := teams.Members[slug]
+		if !ok {
+			return nil, nil, fmt.Errorf("no team %q that this token can see", slug)
+		}
+		drop := make(map[string]bool)
+		for _, login := range remove {
+			drop[login] = true
+		}
+		var kept []string
+		for _, login := range logins {
+			if drop[login] {
+				delete(drop, login)
+				continue
+			}
+			kept = append(kept, login)
+		}
+		if len(drop) > 0 {
+			return nil, nil, fmt.Errorf("%s isn't an immediate member of team %q", strings.Join(sortedKeys(drop), ", "), slug)
+		}
+		if _, ok := after.Members[slug]; ok {
+			after.Members[slug] = kept
+		}
+	}
+
+	beforeUsers, afterUsers := teams.Users(), after.Users()
+	unseenSets := make(map[string]map[string]bool)
+	ret := make([]RepoReport, len(results))
+	for i, result := range results {
+		collaborators := make(map[Principal]Permission, len(result.Collaborators))
+		for principal, perm := range result.Collaborators {
+			if principal.Kind == KindTeam && isDeleted(teamSlug(principal.Name)) {
+				continue
+			}
+			collaborators[principal] = perm
+		}
+		result.Collaborators = collaborators
+		users := make([]repoUser, 0, len(result.Users))
+		for _, user := range result.Users {
+			var kept []permissionSource
+			for _, source := range user.Sources {
+				if source.Principal.Kind == KindTeam {
+					slug := teamSlug(source.Principal.Name)
+					switch {
+					case isDeleted(slug):
+						continue
+					case !beforeUsers[slug][user.Login]:
+						if len(afterUsers[slug]) == len(beforeUsers[slug]) {
+							// The changes don't touch
+							// the team, so it doesn't
+							// matter.
+							break
+						}
+						if unseenSets[slug] == nil {
+							unseenSets[slug] = make(map[string]bool)
+						}
+						unseenSets[slug][user.Login] = true
+					case !afterUsers[slug][user.Login]:
+						continue
+					}
+				}
+				kept = append(kept, source)
+			}
+			if len(kept) > 0 {
+				users = append(users, user.withSources(kept))
+			}
+		}
+		result.Users = users
+		ret[i] = result
+	}
+	unseen = make(map[string][]string, len(unseenSets))
+	for slug, logins := range unseenSets {
+		unseen[slug] = sortedKeys(logins)
+	}
+	return ret, unseen, nil
+}
+
+// accessChange is a change in a user's effective permission on a repo.
+// After is PermNONE if they would lose access altogether.  If
+// Approximate is set, After is only the least that they would be left
+// with, and they may keep Before.
+type accessChange struct {
+	Login       string
+	Repo        RepoHandle
+	Before      Permission
+	After       Permission
+	Approximate bool
+}
+
+// Change returns "removed", "lowered", "may be lowered", or "raised".
+func (c accessChange) Change() string {
+	switch {
+	case c.After == PermNONE:
+		return "removed"
+	case c.After < c.Before && c.Approximate:
+		return "may be lowered"
+	case c.After < c.Before:
+		return "lowered"
+	default:
+		return "raised"
+	}
+}
+
+// diffAccess returns the effective permissions that differ between
+// before and after, sorted by login and then by repo name.
+func diffAccess(before, after []*userRepoAccess) []accessChange {
+	type key struct{ login, repo string }
+	afterPerms := make(map[key]*userRepoAccess, len(after))
+	for _, access := range after {
+		afterPerms[key{access.Login, access.Repo.Name}] = access
+	}
+	var ret []accessChange
+	for _, access := range before {
+		k := key{access.Login, access.Repo.Name}
+		change := accessChange{Login: access.Login, Repo: access.Repo, Before: access.Permission}
+		if a := afterPerms[k]; a != nil {
+			change.After, change.Approximate = a.Permission, a.Approximate
+		}
+		delete(afterPerms, k)
+		if change.After != change.Before {
+			ret = append(ret, change)
+		}
+	}
+	for _, access := range afterPerms {
+		ret = append(ret, accessChange{Login: access.Login, Repo: access.Repo, Before: PermNONE, After: access.Permission})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Login != ret[j].Login {
+			return ret[i].Login < ret[j].Login
+		}
+		return ret[i].Repo.Name < ret[j].Repo.Name
+	})
+	return ret
+}
+
+func writeAccessChangesTable(w io.Writer, changes []accessChange) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "User\t| Repository URL\t| Change\t| Before\t| After\n")
+	fmt.Fprintf(output, "----\t| --------------\t| ------\t| ------\t| -----\n")
+	prev := ""
+	for _, change := range changes {
+		login := change.Login
+		if login == prev {
+			login = ""
+		}
+		prev = change.Login
+		after := change.After.String()
+		switch {
+		case change.After == PermNONE:
+			after = ""
+		case change.Approximate:
+			after = "at least " + after
+		}
+		fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\t| %s\n", login, repoLabel(change.Repo), change.Change(), change.Before, after)
+	}
+	output.Flush()
+}
+
+func writeAccessChangesCSV(w io.Writer, changes []accessChange) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"login", "repository", "url", "change", "before", "after", "after_is_minimum"})
+	for _, change := range changes {
+		_ = output.Write([]string{change.Login, change.Repo.Name, change.Repo.URL, change.Change(), change.Before.String(), change.After.String(),
+			strconv.FormatBool(change.Approximate)})
+	}
+	output.Flush()
+	return output.Error()
+}
+
+var simulateCommand = &command{
+	Name:    "simulate",
+	Args:    []string{"ORGNAME"},
+	Summary: "Show whose access would change if teams were deleted or had members removed",
+	Description: `
+Predicts what deleting teams (--delete-team) or removing people from
+teams (--remove-member) would do, before doing it in GitHub's web UI.
+It collects the same data as the main report, works out each user's
+effective permission on each repository (as with --effective) as
+things are and as they would be after the changes, and lists each one
+that would differ: who would lose access to a repository altogether,
+and who would be left with a lower permission through some other
+grant.  Nothing in GitHub is changed.
+
+Deleting a team deletes its child teams too, as GitHub does.  Removing
+someone from a team only removes them from that team; if they are
+also in one of its child teams, they keep the team's grants, and so
+nothing changes.  Everyone keeps what the org's base permission, or
+being an org owner, gives them.
+
+If GitHub says that someone gets access through a team that the token
+can't see them in (say, a secret team), they are assumed to keep it
+unless the team is deleted, and a warning says who they are.
+
+GitHub only says which grants give someone READ, WRITE, or ADMIN.  If
+someone has TRIAGE or MAINTAIN, and would lose the grant that it may
+come from, their change is "may be lowered", to at least what their
+other grants give.
+
+It takes a query per 100 teams, per 100 team members, and per 100
+collaborators of each repository.`,
+	Examples: []example{
+		{"See what deleting the old-guard team would do.", progName + " simulate --delete-team=old-guard datawire"},
+		{"See what taking alice off the ops and eng teams would do.", progName + " simulate --remove-member=ops:alice,eng:alice datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		var deleteTeams, removeMembers commaList
+		fs.Var(&deleteTeams, "delete-team", "comma-separated list of `slug`s of teams to delete")
+		fs.Var(&removeMembers, "remove-member", "comma-separated list of `team:login` pairs, each a user to remove from a team")
+		format := fs.String("format", "table", "output format: 'table' or 'csv'")
+		opts := Options{RepoUsers: true}
+		fs.IntVar(&opts.Parallel, "parallel", 1, "inspect up to `N` repositories at once")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if *format != "table" && *format != "csv" {
+				return usageErrorf("simulate: invalid --format %q (must be 'table' or 'csv')", *format)
+			}
+			changes := teamChanges{DeleteTeams: deleteTeams, RemoveMembers: make(map[string][]string)}
+			for _, pair := range removeMembers {
+				slug, login, ok := strings.Cut(pair, ":")
+				if !ok || slug == "" || login == "" {
+					return usageErrorf("simulate: invalid --remove-member %q (must be 'team:login')", pair)
+				}
+				changes.RemoveMembers[slug] = append(changes.RemoveMembers[slug], login)
+			}
+			if len(deleteTeams) == 0 && len(removeMembers) == 0 {
+				return usageErrorf("simulate: expected at least one --delete-team or --remove-member")
+			}
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			if _, err := getViewerRole(ctx, orgname); err != nil {
+				return err
+			}
+			teams, err := getTeamMembership(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			// Check the changes before the long part.
+			if _, _, err := changes.Apply(nil, teams); err != nil {
+				return fmt.Errorf("simulate: %w", err)
+			}
+
+			results, total, invisible, err := collect(ctx, orgname, opts)
+			if err != nil && err != errInterrupted {
+				return err
+			}
+			afterResults, unseen, _ := changes.Apply(results, teams)
+			var unseenTeams []string
+			for slug := range unseen {
+				unseenTeams = append(unseenTeams, slug)
+			}
+			sort.Strings(unseenTeams)
+			for _, slug := range unseenTeams {
+				fmt.Fprintf(os.Stderr, "warning: team %q: GitHub says that it gives %s access, but this token can't see them among its members; assuming that they keep it\n",
+					slug, strings.Join(unseen[slug], ", "))
+			}
+			grouping := Grouping{Buckets: []*Bucket{lookupBucket("org"), lookupBucket("team"), lookupBucket("user")}}
+			diff := diffAccess(effectiveAccess(results, grouping), effectiveAccess(afterResults, grouping))
+
+			partialOutput := os.Stdout
+			if *format == "csv" {
+				if err := writeAccessChangesCSV(os.Stdout, diff); err != nil {
+					return err
+				}
+				partialOutput = os.Stderr
+			} else {
+				writeAccessChangesTable(os.Stdout, diff)
+			}
+			if err == errInterrupted {
+				fmt.Fprintf(partialOutput, "PARTIAL REPORT: interrupted after %d of %d repositories\n", len(results), total)
+				return err
+			}
+			if len(diff) == 0 && partialOutput == os.Stdout {
+				fmt.Fprintf(os.Stdout, "NOTE: nobody's effective access to any of the %d repositories would change\n", total)
+			}
+			users, removed := make(map[string]bool), 0
+			for _, change := range diff {
+				users[change.Login] = true
+				if change.After == PermNONE {
+					removed++
+				}
+			}
+			fmt.Fprintf(os.Stderr, "%d users' access would change: %d of their permissions on repositories would be removed, and %d changed\n",
+				len(users), removed, len(diff)-removed)
+			printCoverage(orgname, invisible)
+			return nil
+		}
+	},
+}
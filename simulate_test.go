@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimulatePermissions(t *testing.T) {
+	org := Principal{Kind: KindOrg, Name: "acme", NodeID: "O_acme"}
+	eng := Principal{Kind: KindTeam, Name: "eng", NodeID: "T_eng"}
+	ops := Principal{Kind: KindTeam, Name: "ops", NodeID: "T_ops"}
+	repo := RepoHandle{Name: "api", URL: "https://github.com/acme/api"}
+	teams := teamMembership{Members: map[string][]string{
+		"eng": {"bob", "carol"},
+		"ops": {"carol"},
+	}}
+	results := []RepoReport{{
+		Repo:          repo,
+		Collaborators: map[Principal]Permission{eng: PermWRITE, ops: PermREAD},
+		Users: []repoUser{
+			{Login: "bob", Permission: PermWRITE, Sources: []permissionSource{{org, PermREAD}, {eng, PermWRITE}}},
+			// MAINTAIN, though no source says so.
+			{Login: "carol", Permission: PermMAINTAIN, Sources: []permissionSource{{org, PermREAD}, {eng, PermWRITE}, {ops, PermREAD}}},
+		},
+	}}
+	grouping := Grouping{Buckets: []*Bucket{lookupBucket("org"), lookupBucket("team"), lookupBucket("user")}}
+
+	testcases := map[string]struct {
+		changes teamChanges
+		want    []accessChange
+	}{
+		"losing a lesser source keeps MAINTAIN": {
+			changes: teamChanges{RemoveMembers: map[string][]string{"ops": {"carol"}}},
+			want:    nil,
+		},
+		"losing the highest source may lower MAINTAIN": {
+			changes: teamChanges{RemoveMembers: map[string][]string{"eng": {"carol"}}},
+			want:    []accessChange{{Login: "carol", Repo: repo, Before: PermMAINTAIN, After: PermREAD, Approximate: true}},
+		},
+		"losing the highest source lowers WRITE": {
+			changes: teamChanges{RemoveMembers: map[string][]string{"eng": {"bob"}}},
+			want:    []accessChange{{Login: "bob", Repo: repo, Before: PermWRITE, After: PermREAD}},
+		},
+		"deleting a team": {
+			changes: teamChanges{DeleteTeams: []string{"eng"}},
+			want: []accessChange{
+				{Login: "bob", Repo: repo, Before: PermWRITE, After: PermREAD},
+				{Login: "carol", Repo: repo, Before: PermMAINTAIN, After: PermREAD, Approximate: true},
+			},
+		},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			after, _, err := tc.changes.Apply(results, teams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := diffAccess(effectiveAccess(results, grouping), effectiveAccess(after, grouping))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+			for _, change := range got {
+				if want := map[bool]string{true: "may be lowered", false: "lowered"}[change.Approximate]; change.Change() != want {
+					t.Errorf("%s: got %q, want %q", change.Login, change.Change(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A static site is an HTML version of the report that stays usable for
+// an org with thousands of repos: rather than one enormous page, there
+// is a page for each repo and for each user, and an index page that
+// searches them in the browser.  It is plain files, so it can be
+// published to any static host (or opened from disk).
+
+// siteGrant is a row on a repo's page, or on a user's page.
+type siteGrant struct {
+	Name       string
+	Href       string // empty if there is no page to link to
+	Permission string
+	Via        []string
+}
+
+type sitePage struct {
+	Org         string
+	Title       string
+	Root        string // relative path from the page to the site root
+	GeneratedAt time.Time
+	URL         string // the repo or user on GitHub
+	Grants      []siteGrant
+	People      []siteGrant
+}
+
+type siteIndex struct {
+	Org         string
+	Root        string
+	GeneratedAt time.Time
+	Repos       []siteGrant
+	Users       []siteGrant
+}
+
+// siteEntry is an entry in the search index.
+type siteEntry struct {
+	Name string `json:"n"`
+	Kind string `json:"k"`
+	Href string `json:"h"`
+}
+
+var siteTemplates = template.Must(template.New("site").Funcs(template.FuncMap{
+	"rows": func(heading string, through bool, rows []siteGrant) interface{} {
+		return struct {
+			Heading string
+			Through bool
+			Rows    []siteGrant
+		}{heading, through, rows}
+	},
+	"page": func(org, title, root string, at time.Time) sitePage {
+		return sitePage{Org: org, Title: title, Root: root, GeneratedAt: at}
+	},
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.Root}}style.css">
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">{{.Org}}</a></nav>
+{{end}}
+
+{{define "foot"}}<footer>Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}</footer>
+</body>
+</html>
+{{end}}
+
+{{define "grants"}}<table>
+<thead><tr><th>{{.Heading}}</th><th>Permission</th>{{if .Through}}<th>Through</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr><td>{{if .Href}}<a href="{{.Href}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td>{{.Permission}}</td>{{if $.Through}}<td>{{range $i, $via := .Via}}{{if $i}}, {{end}}{{$via}}{{end}}</td>{{end}}</tr>
+{{else}}<tr><td colspan="3">(none)</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}
+
+{{define "repo"}}{{template "head" .}}<h1>{{.Title}}</h1>
+<p><a href="{{.URL}}">{{.URL}}</a></p>
+<h2>Grants</h2>
+{{template "grants" (rows "Source" false .Grants)}}
+<h2>People with access</h2>
+{{template "grants" (rows "User" true .People)}}
+{{template "foot" .}}{{end}}
+
+{{define "user"}}{{template "head" .}}<h1>{{.Title}}</h1>
+<p><a href="{{.URL}}">{{.URL}}</a></p>
+<h2>Repositories</h2>
+{{template "grants" (rows "Repository" true .Grants)}}
+{{template "foot" .}}{{end}}
+
+{{define "index"}}{{template "head" (page .Org .Org .Root .GeneratedAt)}}<h1>{{.Org}}</h1>
+<p>{{len .Repos}} repositories and {{len .Users}} users.</p>
+<input id="search" type="search" placeholder="Search repositories and users" autofocus>
+<ul id="results"></ul>
+<details><summary>All repositories</summary><ul>
+{{range .Repos}}<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{end}}</ul></details>
+<details><summary>All users</summary><ul>
+{{range .Users}}<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{end}}</ul></details>
+<script src="search-index.js"></script>
+<script src="search.js"></script>
+{{template "foot" .}}{{end}}
+`))
+
+const siteCSS = `body { font-family: sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+#search { font-size: 1.2em; padding: 0.3em; width: 100%; }
+footer { color: #777; font-size: 0.8em; margin-top: 3em; }
+`
+
+// siteSearchJS lists the entries of searchIndex (from search-index.js)
+// whose names contain what has been typed in the search box.
+const siteSearchJS = `(function () {
+  var input = document.getElementById("search");
+  var results = document.getElementById("results");
+  input.addEventListener("input", function () {
+    var q = input.value.trim().toLowerCase();
+    results.textContent = "";
+    if (q === "") {
+      return;
+    }
+    var shown = 0;
+    for (var i = 0; i < searchIndex.length && shown < 100; i++) {
+      var entry = searchIndex[i];
+      if (entry.n.toLowerCase().indexOf(q) < 0) {
+        continue;
+      }
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = entry.h;
+      a.textContent = entry.n;
+      li.appendChild(a);
+      li.appendChild(document.createTextNode(" (" + entry.k + ")"));
+      results.appendChild(li);
+      shown++;
+    }
+  });
+})();
+`
+
+// sitePagePath returns the path of the page for a repo or user,
+// relative to the site root.  Neither repo names nor logins can
+// contain a slash.
+func sitePagePath(kind, name string) string {
+	return kind + "s/" + name + ".html"
+}
+
+// siteHref returns a link to the page for a repo or user, relative to
+// the site root; a bot's login has brackets in it.
+func siteHref(kind, name string) string {
+	return kind + "s/" + url.PathEscape(name) + ".html"
+}
+
+// githubUserURL returns the address of a user's profile on GitHub, or
+// for a bot, of its app's page, since bots don't have profiles.
+func githubUserURL(login string) string {
+	if isBot(Principal{Kind: KindUser, Name: login}) {
+		return "https://github.com/apps/" + url.PathEscape(strings.TrimSuffix(login, "[bot]"))
+	}
+	return "https://github.com/" + url.PathEscape(login)
+}
+
+// buildHTMLSite renders the report as a static site, returning each
+// file's contents by its slash-separated path in the site.  users is
+// the report pivoted by user, as from pivotByUser.
+func buildHTMLSite(orgname string, results []RepoReport, grouping Grouping, users []*userRepoAccess, generatedAt time.Time) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	writePage := func(name, tmpl string, data interface{}) error {
+		var buf bytes.Buffer
+		if err := siteTemplates.ExecuteTemplate(&buf, tmpl, data); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		files[name] = buf.Bytes()
+		return nil
+	}
+
+	byRepo := make(map[string][]siteGrant)
+	byUser := make(map[string][]siteGrant)
+	var userOrder []string
+	for _, access := range users {
+		var via []string
+		for _, principal := range sortedPrincipals(access.Sources) {
+			via = append(via, fmt.Sprintf("%s (%s)", principal, permissionName(access.Sources[principal], grouping.UINames)))
+		}
+		perm := permissionName(access.Permission, grouping.UINames)
+		byRepo[access.Repo.Name] = append(byRepo[access.Repo.Name], siteGrant{
+			Name: access.Login, Href: "../" + siteHref("user", access.Login), Permission: perm, Via: via,
+		})
+		if byUser[access.Login] == nil {
+			userOrder = append(userOrder, access.Login)
+		}
+		byUser[access.Login] = append(byUser[access.Login], siteGrant{
+			Name: access.Repo.Name, Href: "../" + siteHref("repo", access.Repo.Name), Permission: perm, Via: via,
+		})
+	}
+
+	index := siteIndex{Org: orgname, GeneratedAt: generatedAt}
+	var search []siteEntry
+	sorted := append([]RepoReport(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Repo.Name < sorted[j].Repo.Name })
+	for _, result := range sorted {
+		page := sitePage{
+			Org:         orgname,
+			Title:       result.Repo.Name,
+			Root:        "../",
+			GeneratedAt: generatedAt,
+			URL:         result.Repo.URL,
+			People:      byRepo[result.Repo.Name],
+		}
+		if result.Repo.IsArchived {
+			page.Title += " (archived)"
+		}
+		for _, principal := range sortedPrincipals(result.Collaborators) {
+			if !grouping.Matches(principal) {
+				continue
+			}
+			grant := siteGrant{Name: principal.String(), Permission: permissionName(result.Collaborators[principal], grouping.UINames)}
+			if principal.Kind == KindUser {
+				grant.Href = "../" + siteHref("user", principal.Name)
+			}
+			page.Grants = append(page.Grants, grant)
+		}
+		if err := writePage(sitePagePath("repo", result.Repo.Name), "repo", page); err != nil {
+			return nil, err
+		}
+		href := siteHref("repo", result.Repo.Name)
+		index.Repos = append(index.Repos, siteGrant{Name: result.Repo.Name, Href: href})
+		search = append(search, siteEntry{Name: result.Repo.Name, Kind: "repository", Href: href})
+	}
+	for _, login := range userOrder {
+		page := sitePage{
+			Org:         orgname,
+			Title:       login,
+			Root:        "../",
+			GeneratedAt: generatedAt,
+			URL:         githubUserURL(login),
+			Grants:      byUser[login],
+		}
+		if err := writePage(sitePagePath("user", login), "user", page); err != nil {
+			return nil, err
+		}
+		href := siteHref("user", login)
+		index.Users = append(index.Users, siteGrant{Name: login, Href: href})
+		search = append(search, siteEntry{Name: login, Kind: "user", Href: href})
+	}
+
+	if err := writePage("index.html", "index", index); err != nil {
+		return nil, err
+	}
+	searchJSON, err := json.Marshal(search)
+	if err != nil {
+		return nil, err
+	}
+	files["search-index.js"] = []byte("var searchIndex = " + string(searchJSON) + ";\n")
+	files["search.js"] = []byte(siteSearchJS)
+	files["style.css"] = []byte(siteCSS)
+	return files, nil
+}
+
+// writeHTMLSite writes a site from buildHTMLSite to dir.  The repos and
+// users subdirectories are replaced, so that pages for repos that have
+// since been deleted (or users who have since lost access) don't
+// linger.
+func writeHTMLSite(dir string, files map[string][]byte) error {
+	for _, sub := range []string{"repos", "users"} {
+		if err := os.RemoveAll(filepath.Join(dir, sub)); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), content, 0o644); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "HTML site: wrote %d files to %s\n", len(files), dir)
+	return nil
+}
+
+// siteChunkSize is roughly how much of a site to send in each request
+// when publishing it, to stay well clear of the API's limits on the
+// size of a request.
+const siteChunkSize = 4 << 20
+
+// publishHTMLSite commits a site from buildHTMLSite to branch of repo
+// ("OWNER/NAME"), replacing whatever was there, so that GitHub Pages
+// can serve it.  It goes through the API with the same token as
+// everything else, rather than needing git credentials.  The branch is
+// created if need be, but the repo must have at least one commit
+// already, since the API can't write to an empty repo.
+func publishHTMLSite(ctx context.Context, repo, branch, orgname string, files map[string][]byte) error {
+	owner, name, _ := strings.Cut(repo, "/")
+	// Without an empty .nojekyll, Pages would run the site through
+	// Jekyll.
+	paths := []string{".nojekyll"}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	count := len(paths)
+
+	// Send the files as the content of tree entries, which creates
+	// their blobs along the way.  Each request's tree is based on the
+	// last one's, so the last one has everything.
+	type treeEntry struct {
+		Path    string `json:"path"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Content string `json:"content"`
+	}
+	var treeSHA string
+	for len(paths) > 0 {
+		req := struct {
+			BaseTree string      `json:"base_tree,omitempty"`
+			Tree     []treeEntry `json:"tree"`
+		}{BaseTree: treeSHA}
+		size := 0
+		for len(paths) > 0 && (len(req.Tree) == 0 || size+len(files[paths[0]]) <= siteChunkSize) {
+			req.Tree = append(req.Tree, treeEntry{Path: paths[0], Mode: "100644", Type: "blob", Content: string(files[paths[0]])})
+			size += len(files[paths[0]])
+			paths = paths[1:]
+		}
+		var resp struct {
+			SHA string `json:"sha"`
+		}
+		if err := restPost(ctx, req, &resp, "/repos/%s/%s/git/trees", owner, name); err != nil {
+			return fmt.Errorf("publishHTMLSite: %w", err)
+		}
+		treeSHA = resp.SHA
+	}
+
+	// matching-refs is a prefix match, but unlike getting the ref
+	// itself, it doesn't fail if there is no such branch yet.
+	var refs []struct {
+		Ref    string `json:"ref"`
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := restGet(ctx, &refs, "/repos/%s/%s/git/matching-refs/heads/%s", owner, name, branch); err != nil {
+		return fmt.Errorf("publishHTMLSite: %w", err)
+	}
+	parents := []string{}
+	for _, ref := range refs {
+		if ref.Ref == "refs/heads/"+branch {
+			parents = append(parents, ref.Object.SHA)
+		}
+	}
+
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	err := restPost(ctx, map[string]interface{}{
+		"message": fmt.Sprintf("Access report for %s", orgname),
+		"tree":    treeSHA,
+		"parents": parents,
+	}, &commit, "/repos/%s/%s/git/commits", owner, name)
+	if err != nil {
+		return fmt.Errorf("publishHTMLSite: %w", err)
+	}
+	if len(parents) == 0 {
+		err = restPost(ctx, map[string]interface{}{
+			"ref": "refs/heads/" + branch,
+			"sha": commit.SHA,
+		}, nil, "/repos/%s/%s/git/refs", owner, name)
+	} else {
+		err = restPatch(ctx, map[string]interface{}{
+			"sha": commit.SHA,
+		}, nil, "/repos/%s/%s/git/refs/heads/%s", owner, name, branch)
+	}
+	if err != nil {
+		return fmt.Errorf("publishHTMLSite: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "HTML site: committed %d files to the %s branch of %s\n", count, branch, repo)
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// snapshotVersion is the version of the snapshot file format that
+// this version writes.  A snapshot from another version can't be
+// diffed against, since a grant that is represented differently would
+// look like it had changed.
+const snapshotVersion = 1
+
+// snapshotFile is a snapshot of every grant on every repo in an org,
+// as written by the snapshot command for the diff command to compare
+// against.
+type snapshotFile struct {
+	SnapshotVersion int       `json:"snapshotVersion"`
+	Org             string    `json:"org"`
+	TakenAt         time.Time `json:"takenAt"`
+	IncludeArchived bool      `json:"includeArchived"`
+	// Repos are the repos' entries in --format=json, sorted by name.
+	Repos []jsonRepo `json:"repos"`
+}
+
+// allGrants is a Grouping that matches every grant.
+func allGrants() Grouping {
+	return Grouping{Buckets: []*Bucket{lookupBucket("org"), lookupBucket("team"), lookupBucket("user")}}
+}
+
+func newSnapshotFile(orgname string, opts Options, results []RepoReport) *snapshotFile {
+	snap := &snapshotFile{
+		SnapshotVersion: snapshotVersion,
+		Org:             orgname,
+		TakenAt:         time.Now().UTC(),
+		IncludeArchived: opts.IncludeArchived,
+		Repos:           []jsonRepo{},
+	}
+	grouping := allGrants()
+	for _, result := range results {
+		snap.Repos = append(snap.Repos, newJSONRepo(result, grouping))
+	}
+	sort.Slice(snap.Repos, func(i, j int) bool { return snap.Repos[i].Name < snap.Repos[j].Name })
+	return snap
+}
+
+func loadSnapshot(filename string) (*snapshotFile, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(bs, &snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if snap.SnapshotVersion != snapshotVersion {
+		return nil, fmt.Errorf("%s: not a snapshot, or from an incompatible version (snapshotVersion %d; expected %d)",
+			filename, snap.SnapshotVersion, snapshotVersion)
+	}
+	return &snap, nil
+}
+
+func (snap *snapshotFile) Save(filename string) error {
+	bs, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write-then-rename, as with checkpoints, so that a failed write
+	// can't clobber the previous snapshot.
+	if err := ioutil.WriteFile(filename+".tmp", append(bs, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// A grantChange is a grant that differs between two snapshots.
+// Before is PermNONE for a grant that was added, and After is PermNONE
+// for one that was removed.
+type grantChange struct {
+	Repo   string        `json:"repo"`
+	URL    string        `json:"url"`
+	Kind   PrincipalKind `json:"kind"`
+	Source string        `json:"source"`
+	Before Permission    `json:"before"`
+	After  Permission    `json:"after"`
+}
+
+// Change returns "added", "removed", or "changed".
+func (c grantChange) Change() string {
+	switch {
+	case c.Before == PermNONE:
+		return "added"
+	case c.After == PermNONE:
+		return "removed"
+	default:
+		return "changed"
+	}
+}
+
+// diffSnapshots returns the grants that differ between before and
+// after, sorted by repo and then by principal.  If complete is false,
+// after is missing some of the org's repos, so repos that are only in
+// before are left out rather than reported as having lost all their
+// grants.
+func diffSnapshots(before, after *snapshotFile, complete bool) []grantChange {
+	type grantKey struct {
+		repo      string
+		principal Principal
+	}
+	beforeGrants := make(map[grantKey]Permission)
+	afterGrants := make(map[grantKey]Permission)
+	urls := make(map[string]string)
+	inAfter := make(map[string]bool)
+	for _, repo := range before.Repos {
+		urls[repo.Name] = repo.URL
+		for _, grant := range repo.Grants {
+			beforeGrants[grantKey{repo.Name, Principal{Kind: grant.Kind, Name: grant.Source}}] = grant.Permission
+		}
+	}
+	for _, repo := range after.Repos {
+		urls[repo.Name] = repo.URL
+		inAfter[repo.Name] = true
+		for _, grant := range repo.Grants {
+			afterGrants[grantKey{repo.Name, Principal{Kind: grant.Kind, Name: grant.Source}}] = grant.Permission
+		}
+	}
+
+	var changes []grantChange
+	add := func(key grantKey, beforePerm, afterPerm Permission) {
+		changes = append(changes, grantChange{
+			Repo:   key.repo,
+			URL:    urls[key.repo],
+			Kind:   key.principal.Kind,
+			Source: key.principal.Name,
+			Before: beforePerm,
+			After:  afterPerm,
+		})
+	}
+	for key, beforePerm := range beforeGrants {
+		if !complete && !inAfter[key.repo] {
+			continue
+		}
+		if afterPerm := afterGrants[key]; afterPerm != beforePerm {
+			add(key, beforePerm, afterPerm)
+		}
+	}
+	for key, afterPerm := range afterGrants {
+		if _, ok := beforeGrants[key]; !ok {
+			add(key, PermNONE, afterPerm)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Repo != changes[j].Repo {
+			return changes[i].Repo < changes[j].Repo
+		}
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Source < changes[j].Source
+	})
+	return changes
+}
+
+// writeChanges writes changes as a table.
+func writeChanges(w io.Writer, changes []grantChange) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Change\t| Repository URL\t| Source\t| Before\t| After\n")
+	fmt.Fprintf(output, "------\t| --------------\t| ------\t| ------\t| -----\n")
+	for _, change := range changes {
+		before, after := change.Before.String(), change.After.String()
+		if change.Before == PermNONE {
+			before = ""
+		}
+		if change.After == PermNONE {
+			after = ""
+		}
+		fmt.Fprintf(output, "%s\t| %s\t| %s:%s\t| %s\t| %s\n", change.Change(), change.URL, change.Kind, change.Source, before, after)
+	}
+	output.Flush()
+}
+
+var snapshotCommand = &command{
+	Name:    "snapshot",
+	Args:    []string{"ORGNAME", "FILE"},
+	Summary: "Save every grant in an organization to a snapshot file, for diff",
+	Description: `
+Collects the same data as the main report, and writes every grant on
+every repository (with no --sources filtering) to FILE as versioned
+JSON.  Use the diff command to compare the organization's current
+state against it later.
+
+Only a complete run writes a snapshot; an interrupted one would make
+the missing repositories look like they had lost all of their grants.`,
+	Examples: []example{
+		{"Take a snapshot of the datawire organization.", progName + " snapshot datawire datawire.snapshot.json"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		var opts Options
+		fs.BoolVar(&opts.IncludeArchived, "include-archived", false, "also include archived repositories")
+		fs.IntVar(&opts.Parallel, "parallel", 1, "inspect up to `N` repositories at once")
+		return func(ctx context.Context, args []string) error {
+			orgname, filename := args[0], args[1]
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			if _, err := getViewerRole(ctx, orgname); err != nil {
+				return err
+			}
+			results, total, invisible, err := collect(ctx, orgname, opts)
+			if err == errInterrupted {
+				fmt.Fprintf(os.Stderr, "interrupted after %d of %d repositories; not writing a snapshot\n", len(results), total)
+				return err
+			}
+			if err != nil {
+				return err
+			}
+			if err := newSnapshotFile(orgname, opts, results).Save(filename); err != nil {
+				return fmt.Errorf("snapshot: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "wrote a snapshot of %d repositories to %q\n", len(results), filename)
+			printCoverage(orgname, invisible)
+			return nil
+		}
+	},
+}
+
+var diffCommand = &command{
+	Name:    "diff",
+	Args:    []string{"FILE"},
+	Summary: "List the grants that have changed since a snapshot",
+	Description: `
+Collects the current state of the organization that the snapshot in
+FILE (written by the snapshot command) is of, and lists each grant
+that has been added, removed, or changed since, so that a periodic
+access review only has to look at what is new.  A repository that has
+been created or deleted since shows up as all of its grants being
+added or removed.
+
+With --save, a complete run also replaces FILE (or writes another
+file) with the current state, ready for next time.  If the run is
+interrupted, only the repositories that were inspected are compared,
+and nothing is saved.
+
+With --notify, a complete run also posts the changes to Slack, split
+up by the team that owns each repository, so that each team is only
+asked about its own repositories.  The file (YAML or JSON) has
+"channels", a Slack incoming webhook URL for each team; "owners", a
+list of {"repos": [GLOB...], "team": TEAM} for repositories whose
+owner isn't the team (or teams) with ADMIN on it; and "default", the
+webhook for the changes that no team's channel gets.`,
+	Examples: []example{
+		{"Review what has changed since last week, and roll the snapshot forward.",
+			progName + " diff --save=datawire.snapshot.json datawire.snapshot.json"},
+		{"List the changes as JSON, for scripts.", progName + " diff --format=json datawire.snapshot.json"},
+		{"Send each team the changes to its repositories.",
+			progName + " diff --notify=notify.yaml --save=datawire.snapshot.json datawire.snapshot.json"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		format := fs.String("format", "table", "output format: 'table' or 'json'")
+		save := fs.String("save", "", "after a complete run, write the current state as a snapshot to `file` (which may be FILE itself)")
+		notifyFile := fs.String("notify", "", "after a complete run, post the changes to each repository's owning team's Slack channel, as configured in the YAML or JSON `file`")
+		var opts Options
+		fs.IntVar(&opts.Parallel, "parallel", 1, "inspect up to `N` repositories at once")
+		return func(ctx context.Context, args []string) error {
+			if *format != "table" && *format != "json" {
+				return usageErrorf("diff: invalid --format %q (must be 'table' or 'json')", *format)
+			}
+			before, err := loadSnapshot(args[0])
+			if err != nil {
+				return fmt.Errorf("diff: %w", err)
+			}
+			var notifyCfg *notifyConfig
+			if *notifyFile != "" {
+				if notifyCfg, err = loadNotifyConfig(*notifyFile); err != nil {
+					return usageErrorf("--notify: %w", err)
+				}
+			}
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			if _, err := getViewerRole(ctx, before.Org); err != nil {
+				return err
+			}
+			opts.IncludeArchived = before.IncludeArchived
+			results, total, invisible, err := collect(ctx, before.Org, opts)
+			if err != nil && err != errInterrupted {
+				return err
+			}
+			after := newSnapshotFile(before.Org, opts, results)
+			changes := diffSnapshots(before, after, err == nil)
+
+			partialOutput := os.Stdout
+			if *format == "json" {
+				if changes == nil {
+					changes = []grantChange{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(changes); err != nil {
+					return err
+				}
+				partialOutput = os.Stderr
+			} else {
+				writeChanges(os.Stdout, changes)
+			}
+			if err == errInterrupted {
+				fmt.Fprintf(partialOutput, "PARTIAL REPORT: interrupted after %d of %d repositories\n", len(results), total)
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%d grants changed since %s\n", len(changes), before.TakenAt.Local().Format(time.RFC1123))
+			printCoverage(before.Org, invisible)
+			if notifyCfg != nil {
+				// A failure leaves the snapshot as it was, so that
+				// the changes are sent again next time.
+				if err := notifyCfg.notify(ctx, before.Org, before.TakenAt, notifyCfg.groupByOwner(changes, before, after)); err != nil {
+					return err
+				}
+			}
+			if *save != "" {
+				if err := after.Save(*save); err != nil {
+					return fmt.Errorf("--save: %w", err)
+				}
+			}
+			return nil
+		}
+	},
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// starlarkCheck is a user-defined Check, written in Starlark (a dialect
+// of Python; see https://github.com/bazelbuild/starlark).  A script
+// defines:
+//
+//	name = "no-contractor-write"        # required
+//	description = "..."                 # optional
+//	severity = "error"                  # optional; default "warning"
+//
+//	def evaluate(snapshot, options):    # options is optional
+//	    return [{"repo": ..., "principal": "user:LOGIN", "message": ...}]
+//
+// snapshot has .org, .members and .owners (lists of logins), .teams, .suspended
+// (the logins of suspended users, if they were collected), .users (a
+// dict of login to .company and .verified_emails, if they were
+// collected), and .repos.
+// Each team has .name (its full name, as in grants), .slug, and
+// .secret.  Each repo has .name, .url, .visibility, .license (an SPDX ID),
+// .settings, .grants, and .deployment_approvers; .settings has
+// .has_issues, .merge_methods, .default_branch, .protected,
+// .allows_force_pushes, .allows_deletions, .requires_linear_history,
+// and .required_approvals (-1 if pull requests aren't required); each
+// grant has .kind ("org", "team", or "user"), .name, .permission
+// ("READ", ...), and .level (the permission as a number, for
+// comparisons), and each deployment approver has .kind, .name, and
+// .environments (a list of names).  options is the
+// check's "options" from the config file, or None.
+type starlarkCheck struct {
+	filename    string
+	name        string
+	description string
+	severity    Severity
+	evaluate    *starlark.Function
+	options     starlark.Value
+}
+
+// loadStarlarkCheck loads the Starlark check in filename.
+func loadStarlarkCheck(filename string) (*starlarkCheck, error) {
+	thread := &starlark.Thread{Name: filename}
+	globals, err := starlark.ExecFile(thread, filename, nil, starlark.StringDict{
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	})
+	if err != nil {
+		return nil, err
+	}
+	check := &starlarkCheck{
+		filename: filename,
+		severity: SeverityWarning,
+		options:  starlark.None,
+	}
+	name, ok := starlark.AsString(globals["name"])
+	if !ok || name == "" {
+		return nil, fmt.Errorf("%s: must set name to a string", filename)
+	}
+	check.name = name
+	if val, ok := globals["description"]; ok {
+		if check.description, ok = starlark.AsString(val); !ok {
+			return nil, fmt.Errorf("%s: description must be a string", filename)
+		}
+	}
+	if val, ok := globals["severity"]; ok {
+		str, ok := starlark.AsString(val)
+		if !ok {
+			return nil, fmt.Errorf("%s: severity must be a string", filename)
+		}
+		if err := check.severity.UnmarshalText([]byte(str)); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	if check.evaluate, ok = globals["evaluate"].(*starlark.Function); !ok {
+		return nil, fmt.Errorf("%s: must define an evaluate(snapshot) function", filename)
+	}
+	if n := check.evaluate.NumParams(); n < 1 || n > 2 {
+		return nil, fmt.Errorf("%s: evaluate must take (snapshot) or (snapshot, options)", filename)
+	}
+	return check, nil
+}
+
+func (c *starlarkCheck) Name() string {
+	return c.name
+}
+
+func (c *starlarkCheck) Description() string {
+	if c.description == "" {
+		return "(" + c.filename + ")"
+	}
+	return c.description + " (" + c.filename + ")"
+}
+
+func (c *starlarkCheck) DefaultSeverity() Severity {
+	return c.severity
+}
+
+func (c *starlarkCheck) Configure(options json.RawMessage) error {
+	thread := &starlark.Thread{Name: c.filename}
+	val, err := starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(options)}, nil)
+	if err != nil {
+		return err
+	}
+	c.options = val
+	return nil
+}
+
+// Evaluate runs the script's evaluate function.  Since a Check can't
+// fail, a script that does is reported as a Finding, rather than being
+// mistaken for one that found nothing.
+func (c *starlarkCheck) Evaluate(snap *Snapshot) []Finding {
+	ret, err := c.run(snap)
+	if err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok && len(evalErr.CallStack) > 0 {
+			err = fmt.Errorf("%s: %s", evalErr.CallStack[len(evalErr.CallStack)-1].Pos, evalErr.Msg)
+		}
+		return []Finding{{Message: fmt.Sprintf("check failed: %v", err)}}
+	}
+	return ret
+}
+
+func (c *starlarkCheck) run(snap *Snapshot) ([]Finding, error) {
+	args := starlark.Tuple{snapshotToStarlark(snap)}
+	if c.evaluate.NumParams() == 2 {
+		args = append(args, c.options)
+	}
+	thread := &starlark.Thread{Name: c.filename}
+	result, err := starlark.Call(thread, c.evaluate, args, nil)
+	if err != nil {
+		return nil, err
+	}
+	if result == starlark.None {
+		return nil, nil
+	}
+	iter := starlark.Iterate(result)
+	if iter == nil {
+		return nil, fmt.Errorf("evaluate returned a %s, not a list", result.Type())
+	}
+	defer iter.Done()
+	var ret []Finding
+	var item starlark.Value
+	for iter.Next(&item) {
+		dict, ok := item.(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("evaluate returned a list containing a %s, not a dict", item.Type())
+		}
+		var finding Finding
+		for _, field := range []struct {
+			Key string
+			Dst *string
+		}{
+			{"repo", &finding.Repo},
+			{"message", &finding.Message},
+		} {
+			if val, found, _ := dict.Get(starlark.String(field.Key)); found {
+				if *field.Dst, ok = starlark.AsString(val); !ok {
+					return nil, fmt.Errorf("finding %s must be a string", field.Key)
+				}
+			}
+		}
+		if val, found, _ := dict.Get(starlark.String("principal")); found {
+			str, ok := starlark.AsString(val)
+			if !ok {
+				return nil, fmt.Errorf("finding principal must be a string")
+			}
+			principal, err := parsePrincipal(str)
+			if err != nil {
+				return nil, err
+			}
+			finding.Principal = principal
+		}
+		ret = append(ret, finding)
+	}
+	return ret, nil
+}
+
+// snapshotToStarlark converts snap in to the value that Starlark
+// checks' evaluate function receives.
+func snapshotToStarlark(snap *Snapshot) starlark.Value {
+	members := make([]string, 0, len(snap.Members))
+	for login := range snap.Members {
+		members = append(members, login)
+	}
+	sort.Strings(members)
+	memberList := make([]starlark.Value, len(members))
+	for i, login := range members {
+		memberList[i] = starlark.String(login)
+	}
+
+	ownerList := make([]starlark.Value, len(snap.Owners))
+	for i, login := range snap.Owners {
+		ownerList[i] = starlark.String(login)
+	}
+
+	teams := make([]starlark.Value, len(snap.Teams))
+	for i, team := range snap.Teams {
+		teams[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"name":   starlark.String(team.Fullname),
+			"slug":   starlark.String(team.Slug),
+			"secret": starlark.Bool(team.Secret),
+		})
+	}
+
+	suspended := make([]string, 0, len(snap.Suspended))
+	for login := range snap.Suspended {
+		suspended = append(suspended, login)
+	}
+	sort.Strings(suspended)
+	suspendedList := make([]starlark.Value, len(suspended))
+	for i, login := range suspended {
+		suspendedList[i] = starlark.String(login)
+	}
+
+	users := starlark.NewDict(len(snap.Users))
+	for login, details := range snap.Users {
+		emails := make([]starlark.Value, len(details.VerifiedEmails))
+		for i, email := range details.VerifiedEmails {
+			emails[i] = starlark.String(email)
+		}
+		_ = users.SetKey(starlark.String(login), starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"company":         starlark.String(details.Company),
+			"verified_emails": starlark.NewList(emails),
+		}))
+	}
+
+	repos := make([]starlark.Value, len(snap.Repos))
+	for i, repo := range snap.Repos {
+		var grants []starlark.Value
+		for _, principal := range sortedPrincipals(repo.Collaborators) {
+			perm := repo.Collaborators[principal]
+			grants = append(grants, starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+				"kind":       starlark.String(principal.Kind),
+				"name":       starlark.String(principal.Name),
+				"permission": starlark.String(perm.String()),
+				"level":      starlark.MakeInt(int(perm)),
+			}))
+		}
+		var approvers []starlark.Value
+		for _, principal := range sortedApprovers(repo.DeploymentApprovers) {
+			var envs []starlark.Value
+			for _, env := range repo.DeploymentApprovers[principal] {
+				envs = append(envs, starlark.String(env))
+			}
+			approvers = append(approvers, starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+				"kind":         starlark.String(principal.Kind),
+				"name":         starlark.String(principal.Name),
+				"environments": starlark.NewList(envs),
+			}))
+		}
+		repos[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"name":                 starlark.String(repo.Repo.Name),
+			"url":                  starlark.String(repo.Repo.URL),
+			"visibility":           starlark.String(repo.Repo.Visibility),
+			"license":              starlark.String(repo.Repo.License),
+			"is_archived":          starlark.Bool(repo.Repo.IsArchived),
+			"settings":             starlarkSettings(repo.Repo.Settings),
+			"grants":               starlark.NewList(grants),
+			"deployment_approvers": starlark.NewList(approvers),
+		})
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"org":       starlark.String(snap.Org),
+		"members":   starlark.NewList(memberList),
+		"owners":    starlark.NewList(ownerList),
+		"teams":     starlark.NewList(teams),
+		"suspended": starlark.NewList(suspendedList),
+		"users":     users,
+		"repos":     starlark.NewList(repos),
+	})
+}
+
+// starlarkSettings converts a repo's settings for a Starlark check.
+func starlarkSettings(s RepoSettings) starlark.Value {
+	var methods []starlark.Value
+	for _, method := range s.MergeMethods() {
+		methods = append(methods, starlark.String(method))
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"has_issues":              starlark.Bool(s.HasIssues),
+		"merge_methods":           starlark.NewList(methods),
+		"default_branch":          starlark.String(s.DefaultBranch),
+		"protected":               starlark.Bool(s.Protection != nil),
+		"allows_force_pushes":     starlark.Bool(s.AllowsForcePushes()),
+		"allows_deletions":        starlark.Bool(s.AllowsDeletions()),
+		"requires_linear_history": starlark.Bool(s.RequiresLinearHistory()),
+		"required_approvals":      starlark.MakeInt(s.RequiredApprovals()),
+	})
+}
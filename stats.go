@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram that
+// gets printed by --stats.  They're the same as the Prometheus client
+// defaults, which are a reasonable spread for HTTP calls.
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type queryStats struct {
+	// Requests is how many times the query was asked, and Retries
+	// how many more times it was sent because an earlier attempt
+	// failed; see withRetries.  Errors, Cost, and Latencies are
+	// over every attempt.
+	Requests  int
+	Retries   int
+	Errors    int
+	Cost      int
+	Latencies []time.Duration
+}
+
+// runStats accumulates per-query metrics over the course of a run, so
+// that we can tell whether a slow run is slow because of us or because
+// of GitHub.
+type runStats struct {
+	mu      sync.Mutex
+	queries map[string]*queryStats
+}
+
+var stats = &runStats{
+	queries: make(map[string]*queryStats),
+}
+
+// record records a request for a query that took latency to complete,
+// cost cost rate-limit points, and failed with err (if not nil).
+// attempt is 0 for the first time that the query was sent, and counts
+// up for each retry.
+func (s *runStats) record(query string, attempt int, latency time.Duration, cost int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	qs, ok := s.queries[query]
+	if !ok {
+		qs = &queryStats{}
+		s.queries[query] = qs
+	}
+	if attempt == 0 {
+		qs.Requests++
+	} else {
+		qs.Retries++
+	}
+	qs.Cost += cost
+	if err != nil {
+		qs.Errors++
+	}
+	qs.Latencies = append(qs.Latencies, latency)
+}
+
+// TotalCost returns the total rate-limit cost of every request so far,
+// along with how many requests there were, counting retries.
+func (s *runStats) TotalCost() (cost, requests int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, qs := range s.queries {
+		cost += qs.Cost
+		requests += qs.Requests + qs.Retries
+	}
+	return cost, requests
+}
+
+// percentile returns the p-th percentile (0 < p <= 1) of an already
+// sorted list of durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// Print writes a human-readable summary of the stats to w.
+func (s *runStats) Print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.queries))
+	for name := range s.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Query\t| Requests\t| Retries\t| Errors\t| Error rate\t| Cost\t| p50\t| p90\t| p99\t| Max\n")
+	fmt.Fprintf(table, "-----\t| --------\t| -------\t| ------\t| ----------\t| ----\t| ---\t| ---\t| ---\t| ---\n")
+	totalRequests, totalRetries, totalErrors, totalCost := 0, 0, 0, 0
+	for _, name := range names {
+		qs := s.queries[name]
+		sorted := append([]time.Duration(nil), qs.Latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		totalRequests += qs.Requests
+		totalRetries += qs.Retries
+		totalErrors += qs.Errors
+		totalCost += qs.Cost
+		// The error rate is per attempt, retries included.
+		fmt.Fprintf(table, "%s\t| %d\t| %d\t| %d\t| %.1f%%\t| %d\t| %v\t| %v\t| %v\t| %v\n",
+			name,
+			qs.Requests,
+			qs.Retries,
+			qs.Errors,
+			100*float64(qs.Errors)/float64(qs.Requests+qs.Retries),
+			qs.Cost,
+			percentile(sorted, 0.50).Round(time.Millisecond),
+			percentile(sorted, 0.90).Round(time.Millisecond),
+			percentile(sorted, 0.99).Round(time.Millisecond),
+			percentile(sorted, 1).Round(time.Millisecond))
+	}
+	fmt.Fprintf(table, "(total)\t| %d\t| %d\t| %d\t|\t| %d\t|\t|\t|\t|\n", totalRequests, totalRetries, totalErrors, totalCost)
+	table.Flush()
+
+	for _, name := range names {
+		qs := s.queries[name]
+		fmt.Fprintf(w, "\n%s latency histogram:\n", name)
+		counts := make([]int, len(latencyBuckets)+1)
+		for _, latency := range qs.Latencies {
+			i := sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })
+			counts[i]++
+		}
+		for i, count := range counts {
+			label := "+Inf"
+			if i < len(latencyBuckets) {
+				label = latencyBuckets[i].String()
+			}
+			fmt.Fprintf(w, "  <= %-8s %d\n", label, count)
+		}
+	}
+}
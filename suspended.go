@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// getSuspendedUsers returns which of logins belong to users that a
+// GitHub Enterprise Server site admin has suspended, and when.  A
+// suspended user can't sign in, but keeps their grants and team
+// memberships until somebody removes them.  Only the REST API says
+// whether a user is suspended, so this takes one request per login.
+func getSuspendedUsers(ctx context.Context, logins []string) (map[string]time.Time, error) {
+	ret := make(map[string]time.Time)
+	for i, login := range logins {
+		if ctx.Err() != nil {
+			return ret, errInterrupted
+		}
+		if i%100 == 0 {
+			fmt.Fprintf(os.Stderr, "checking users for suspension %d/%d\n", i, len(logins))
+		}
+		var user struct {
+			SuspendedAt *time.Time `json:"suspended_at"`
+		}
+		if err := restGet(ctx, &user, "/users/%s", login); err != nil {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			return nil, fmt.Errorf("getSuspendedUsers: %q: %w", login, err)
+		}
+		if user.SuspendedAt != nil {
+			ret[login] = *user.SuspendedAt
+		}
+	}
+	return ret, nil
+}
+
+// snapshotUsers returns the logins of everyone in snap who could have
+// been suspended: the org's members, and the users who have been
+// granted access to a repo directly.  Bots can't be.
+func snapshotUsers(snap *Snapshot) []string {
+	seen := make(map[string]bool)
+	for login := range snap.Members {
+		seen[login] = true
+	}
+	for _, repo := range snap.Repos {
+		for principal := range repo.Collaborators {
+			if principal.Kind == KindUser && !isBot(principal) {
+				seen[principal.Name] = true
+			}
+		}
+	}
+	ret := make([]string, 0, len(seen))
+	for login := range seen {
+		ret = append(ret, login)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// teamRepoAccess is the access that one team has been granted to one
+// repo.
+type teamRepoAccess struct {
+	Team       string // full name, like "parent/child"
+	Secret     bool   // whether the team is secret; see Team
+	Repo       RepoHandle
+	Permission Permission
+}
+
+// pivotByTeam inverts results, to say which repos each team has been
+// granted access to, rather than who has access to each repo.  Only a
+// team's own grants are included, not those it inherits from its
+// parent.  teams is every team in the org; teams that haven't been
+// granted access to any of the repos in results get an
+// entry with an empty Repo, so that they show up too.  Only grants
+// that fall in at least one of grouping's buckets are included.  The
+// result is sorted by team name, and then by repo name.
+func pivotByTeam(results []RepoReport, grouping Grouping, teams []Team) []teamRepoAccess {
+	secret := make(map[string]bool, len(teams))
+	for _, team := range teams {
+		secret[team.Fullname] = team.Secret
+	}
+	var ret []teamRepoAccess
+	granted := make(map[string]bool)
+	for _, result := range results {
+		for principal, perm := range result.Collaborators {
+			if principal.Kind != KindTeam || !grouping.Matches(principal) {
+				continue
+			}
+			ret = append(ret, teamRepoAccess{Team: principal.Name, Secret: secret[principal.Name], Repo: result.Repo, Permission: perm})
+			granted[principal.Name] = true
+		}
+	}
+	for _, team := range teams {
+		if !granted[team.Fullname] && grouping.Matches(Principal{Kind: KindTeam, Name: team.Fullname}) {
+			ret = append(ret, teamRepoAccess{Team: team.Fullname, Secret: team.Secret})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Team != ret[j].Team {
+			return ret[i].Team < ret[j].Team
+		}
+		return ret[i].Repo.Name < ret[j].Repo.Name
+	})
+	return ret
+}
+
+// writeTeamTable writes the per-team report as a table, with each
+// team's repos under it, naming permissions as GitHub's web UI does if
+// uiNames.  Secret teams are marked as such, since their members can
+// see grants that the rest of the org can't.
+func writeTeamTable(w io.Writer, accesses []teamRepoAccess, uiNames bool) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Team\t| Repository URL\t| Permission\n")
+	fmt.Fprintf(output, "----\t| --------------\t| ----------\n")
+	prev := ""
+	for _, access := range accesses {
+		team := access.Team
+		switch {
+		case team == prev:
+			team = ""
+		case access.Secret:
+			team += " (secret)"
+		}
+		prev = access.Team
+		if access.Repo.Name == "" {
+			fmt.Fprintf(output, "%s\t| (no repositories)\t| \n", team)
+			continue
+		}
+		fmt.Fprintf(output, "%s\t| %s\t| %s\n", team, repoLabel(access.Repo), permissionName(access.Permission, uiNames))
+	}
+	output.Flush()
+}
+
+// writeTeamCSV writes the per-team report as CSV, with one row per
+// team and repo, and a row with empty repository columns for each team
+// that has no repos.  The privacy column is "secret" or "visible".
+func writeTeamCSV(w io.Writer, accesses []teamRepoAccess) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"team", "repository", "url", "permission", "privacy"})
+	for _, access := range accesses {
+		perm := ""
+		if access.Repo.Name != "" {
+			perm = access.Permission.String()
+		}
+		privacy := "visible"
+		if access.Secret {
+			privacy = "secret"
+		}
+		_ = output.Write([]string{access.Team, access.Repo.Name, access.Repo.URL, perm, privacy})
+	}
+	output.Flush()
+	return output.Error()
+}
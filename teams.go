@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// teamCounts is how big a team is.
+type teamCounts struct {
+	// Members is the team's immediate members, and AllMembers those
+	// and the members of its child teams, who get its grants too.
+	Members    int
+	AllMembers int
+	// Repos is how many repos the team has been granted access to
+	// itself, not counting those it gets through its parent.
+	Repos int
+}
+
+// getTeamCounts returns the teamCounts of each of an org's teams, by
+// slug.
+func getTeamCounts(ctx context.Context, orgname string) (map[string]teamCounts, error) {
+	query := `
+query getTeamCounts($orgname: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    teams(first: $pageSize, after: $cursor) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        slug
+        members(membership: IMMEDIATE) {
+          totalCount
+        }
+        allMembers: members(membership: ALL) {
+          totalCount
+        }
+        repositories {
+          totalCount
+        }
+      }
+    }
+  }
+}`
+	type count struct {
+		TotalCount int
+	}
+	var rawTeams struct {
+		Organization struct {
+			Teams struct {
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+				Nodes []struct {
+					Slug         string
+					Members      count
+					AllMembers   count
+					Repositories count
+				}
+			}
+		}
+	}
+	args := map[string]interface{}{
+		"orgname": orgname,
+	}
+	ret := make(map[string]teamCounts)
+	for args["cursor"] == nil || rawTeams.Organization.Teams.PageInfo.HasNextPage {
+		args["pageSize"] = pageSize.Size()
+		err := graphql(ctx, &rawTeams, query, args)
+		if err != nil {
+			if pageSize.Failed(err) {
+				continue
+			}
+			return nil, fmt.Errorf("getTeamCounts: %w", err)
+		}
+		pageSize.Succeeded()
+		args["cursor"] = rawTeams.Organization.Teams.PageInfo.EndCursor
+
+		for _, team := range rawTeams.Organization.Teams.Nodes {
+			ret[team.Slug] = teamCounts{
+				Members:    team.Members.TotalCount,
+				AllMembers: team.AllMembers.TotalCount,
+				Repos:      team.Repositories.TotalCount,
+			}
+		}
+	}
+	return ret, nil
+}
+
+// getTeamRepos returns the names of the repos that a team can access:
+// those that it has been granted access to, and those that its
+// ancestors (named by its full "parentteam/subteam" name, as
+// getTeamFullnames returns) have, which it gets too.
+func getTeamRepos(ctx context.Context, orgname, fullname string) (map[string]bool, error) {
+	query := `
+query getTeamRepos($orgname: String!, $slug: String!, $pageSize: Int!, $cursor: String) {
+  organization(login: $orgname) {
+    team(slug: $slug) {
+      repositories(first: $pageSize, after: $cursor) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          name
+        }
+      }
+    }
+  }
+}`
+	ret := make(map[string]bool)
+	for _, slug := range strings.Split(fullname, "/") {
+		var rawTeam struct {
+			Organization struct {
+				Team *struct {
+					Repositories struct {
+						PageInfo struct {
+							HasNextPage bool
+							EndCursor   string
+						}
+						Nodes []struct {
+							Name string
+						}
+					}
+				}
+			}
+		}
+		args := map[string]interface{}{
+			"orgname": orgname,
+			"slug":    slug,
+		}
+		for args["cursor"] == nil || rawTeam.Organization.Team.Repositories.PageInfo.HasNextPage {
+			args["pageSize"] = pageSize.Size()
+			err := graphql(ctx, &rawTeam, query, args)
+			if err != nil {
+				if pageSize.Failed(err) {
+					continue
+				}
+				return nil, fmt.Errorf("getTeamRepos: %w", err)
+			}
+			pageSize.Succeeded()
+			if rawTeam.Organization.Team == nil {
+				return nil, fmt.Errorf("getTeamRepos: no team %q in %q that this token can see", slug, orgname)
+			}
+			args["cursor"] = rawTeam.Organization.Team.Repositories.PageInfo.EndCursor
+
+			for _, repo := range rawTeam.Organization.Team.Repositories.Nodes {
+				ret[repo.Name] = true
+			}
+		}
+	}
+	return ret, nil
+}
+
+// sortTeamTree sorts teams so that each comes right after its parent
+// (and its parent's earlier children), which sorting by full name
+// doesn't quite do: "eng-web" sorts between "eng" and "eng/dev".
+func sortTeamTree(teams []Team) {
+	sort.SliceStable(teams, func(i, j int) bool {
+		a, b := strings.Split(teams[i].Fullname, "/"), strings.Split(teams[j].Fullname, "/")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+func writeTeamsTable(w io.Writer, teams []Team, counts map[string]teamCounts, flat bool) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "Team\t| Members\t| With child teams\t| Repositories\n")
+	fmt.Fprintf(output, "----\t| -------\t| ----------------\t| ------------\n")
+	for _, team := range teams {
+		name := team.Fullname
+		if !flat {
+			// Indent each team under its parent.
+			name = strings.Repeat("  ", strings.Count(team.Fullname, "/")) + team.Slug
+		}
+		if team.Secret {
+			name += " (secret)"
+		}
+		c := counts[team.Slug]
+		fmt.Fprintf(output, "%s\t| %d\t| %d\t| %d\n", name, c.Members, c.AllMembers, c.Repos)
+	}
+	output.Flush()
+}
+
+func writeTeamsCSV(w io.Writer, teams []Team, counts map[string]teamCounts) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"team", "slug", "secret", "members", "all_members", "repositories"})
+	for _, team := range teams {
+		c := counts[team.Slug]
+		_ = output.Write([]string{team.Fullname, team.Slug, strconv.FormatBool(team.Secret),
+			strconv.Itoa(c.Members), strconv.Itoa(c.AllMembers), strconv.Itoa(c.Repos)})
+	}
+	output.Flush()
+	return output.Error()
+}
+
+var teamsCommand = &command{
+	Name:    "teams",
+	Args:    []string{"ORGNAME"},
+	Summary: "List the organization's teams, as a tree",
+	Description: `
+Lists every team in the organization, each indented under its parent
+(or, with --flat, by the full name that the report uses, like
+"eng/dev"), with how many immediate members it has, how many it has
+counting the members of its child teams (who get its grants too), and
+how many repositories it has been granted access to itself (not
+counting those it gets through its parent).  Secret teams, which only
+their own members and the org's owners can see, are marked.
+
+It takes two queries per 100 teams.`,
+	Examples: []example{
+		{"Show the datawire organization's team tree.", progName + " teams datawire"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		flat := fs.Bool("flat", false, "list teams by full name, rather than indented under their parents")
+		format := fs.String("format", "table", "output format: 'table' or 'csv' (which is always flat)")
+		return func(ctx context.Context, args []string) error {
+			orgname := args[0]
+			if *format != "table" && *format != "csv" {
+				return usageErrorf("teams: invalid --format %q (must be 'table' or 'csv')", *format)
+			}
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			teams, err := getTeams(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			counts, err := getTeamCounts(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			if !*flat {
+				sortTeamTree(teams)
+			}
+			if *format == "csv" {
+				return writeTeamsCSV(os.Stdout, teams, counts)
+			}
+			writeTeamsTable(os.Stdout, teams, counts, *flat)
+			if len(teams) == 0 {
+				// A plain member can't see secret teams.
+				fmt.Fprintf(os.Stdout, "NOTE: %q has no teams that this token can see\n", orgname)
+			}
+			return nil
+		}
+	},
+}
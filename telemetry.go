@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// telemetry is set if --otlp-endpoint (or $OTEL_EXPORTER_OTLP_ENDPOINT)
+// is, in which case the run's spans, and the per-query metrics that
+// --stats prints, are exported to an OpenTelemetry collector when it
+// is done.
+var telemetry *otlpExporter
+
+// otlpExporter sends spans and metrics to an OpenTelemetry collector
+// with OTLP over HTTP, in its JSON encoding.  That is all this needs
+// of the OpenTelemetry SDK, which would be a lot of dependencies for
+// it.
+type otlpExporter struct {
+	endpoint string // like http://localhost:4318, without /v1/traces
+	headers  map[string]string
+	service  string
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// newOTLPExporter returns an exporter to endpoint, with the headers and
+// service name that the standard $OTEL_EXPORTER_OTLP_HEADERS (like
+// "api-key=secret,tenant=audit") and $OTEL_SERVICE_NAME say.
+func newOTLPExporter(endpoint string) (*otlpExporter, error) {
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --otlp-endpoint %q (must be an http or https URL, like http://localhost:4318)", endpoint)
+	}
+	exp := &otlpExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		headers:  make(map[string]string),
+		service:  os.Getenv("OTEL_SERVICE_NAME"),
+	}
+	if exp.service == "" {
+		exp.service = progName
+	}
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(header, "=")
+		key = strings.TrimSpace(key)
+		val, err := url.QueryUnescape(strings.TrimSpace(val))
+		if !ok || key == "" || err != nil {
+			return nil, fmt.Errorf("invalid $OTEL_EXPORTER_OTLP_HEADERS: %q is not 'key=value'", header)
+		}
+		exp.headers[key] = val
+	}
+	return exp, nil
+}
+
+// span is a timed operation, for tracing.  A nil *span, which is what
+// startSpan returns if telemetry is off, does nothing.
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // all 0 for a root span
+	name     string
+	client   bool // an API request, rather than work of our own
+	start    time.Time
+	end      time.Time
+
+	mu    sync.Mutex
+	attrs map[string]interface{}
+	err   error
+}
+
+type spanKey struct{}
+
+// startSpan starts a span named name, as a child of the span in ctx (if
+// there is one), and returns a ctx with the new span in it.  client
+// says whether it is a request to another service.
+func startSpan(ctx context.Context, name string, client bool) (context.Context, *span) {
+	if telemetry == nil {
+		return ctx, nil
+	}
+	s := &span{name: name, client: client, start: time.Now(), attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttr sets one of the span's attributes, which may be a string, an
+// int, or a bool.
+func (s *span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// End ends the span, marking it as failed if err isn't nil.
+func (s *span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end, s.err = time.Now(), err
+	s.mu.Unlock()
+	telemetry.mu.Lock()
+	defer telemetry.mu.Unlock()
+	telemetry.spans = append(telemetry.spans, s)
+}
+
+// The types below are the parts of the OTLP JSON encoding that are
+// used; see opentelemetry-proto.  Times are in nanoseconds since the
+// epoch, as strings, as are 64-bit integers.
+
+type otlpAttr struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpAttrs(attrs map[string]interface{}) []otlpAttr {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ret := []otlpAttr{}
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attrs[key].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		ret = append(ret, otlpAttr{Key: key, Value: value})
+	}
+	return ret
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+func (exp *otlpExporter) resource() otlpResource {
+	return otlpResource{Attributes: otlpAttrs(map[string]interface{}{"service.name": exp.service})}
+}
+
+var telemetryScope = otlpScope{Name: "github.com/datawire/collaborators"}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+// The span kinds and status codes that are used.
+const (
+	otlpKindInternal = 1
+	otlpKindClient   = 3
+	otlpStatusError  = 2
+)
+
+func (exp *otlpExporter) tracesRequest() interface{} {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	spans := make([]otlpSpan, 0, len(exp.spans))
+	for _, s := range exp.spans {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: otlpTime(s.start),
+			EndTimeUnixNano:   otlpTime(s.end),
+			Attributes:        otlpAttrs(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.client {
+			out.Kind = otlpKindClient
+		}
+		if s.err != nil {
+			out.Status.Code, out.Status.Message = otlpStatusError, s.err.Error()
+		}
+		spans = append(spans, out)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": exp.resource(),
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": telemetryScope,
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// metricsRequest returns the per-query stats as metrics: the number
+// of requests, of retries, and of errors, the rate-limit cost, and a
+// histogram of latency, each with the query's name as its "operation"
+// attribute.
+// They are cumulative from when the program started.
+func (exp *otlpExporter) metricsRequest(s *runStats) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.queries))
+	for name := range s.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	start, now := otlpTime(startTime), otlpTime(time.Now())
+	bounds := make([]float64, len(latencyBuckets))
+	for i, bound := range latencyBuckets {
+		bounds[i] = bound.Seconds()
+	}
+	sum := func(name, unit string, value func(*queryStats) int) interface{} {
+		var points []interface{}
+		for _, query := range names {
+			points = append(points, map[string]interface{}{
+				"attributes":        otlpAttrs(map[string]interface{}{"operation": query}),
+				"startTimeUnixNano": start,
+				"timeUnixNano":      now,
+				"asInt":             strconv.Itoa(value(s.queries[query])),
+			})
+		}
+		return map[string]interface{}{
+			"name": name,
+			"unit": unit,
+			"sum": map[string]interface{}{
+				"aggregationTemporality": 2, // cumulative
+				"isMonotonic":            true,
+				"dataPoints":             points,
+			},
+		}
+	}
+	var latencyPoints []interface{}
+	for _, query := range names {
+		qs := s.queries[query]
+		counts := make([]string, len(latencyBuckets)+1)
+		n := make([]int, len(latencyBuckets)+1)
+		total := 0.0
+		for _, latency := range qs.Latencies {
+			n[sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })]++
+			total += latency.Seconds()
+		}
+		for i := range n {
+			counts[i] = strconv.Itoa(n[i])
+		}
+		latencyPoints = append(latencyPoints, map[string]interface{}{
+			"attributes":        otlpAttrs(map[string]interface{}{"operation": query}),
+			"startTimeUnixNano": start,
+			"timeUnixNano":      now,
+			"count":             strconv.Itoa(len(qs.Latencies)),
+			"sum":               total,
+			"bucketCounts":      counts,
+			"explicitBounds":    bounds,
+		})
+	}
+	metrics := []interface{}{
+		sum("github.api.requests", "{request}", func(qs *queryStats) int { return qs.Requests }),
+		sum("github.api.retries", "{request}", func(qs *queryStats) int { return qs.Retries }),
+		sum("github.api.errors", "{request}", func(qs *queryStats) int { return qs.Errors }),
+		sum("github.api.cost", "{point}", func(qs *queryStats) int { return qs.Cost }),
+		map[string]interface{}{
+			"name": "github.api.duration",
+			"unit": "s",
+			"histogram": map[string]interface{}{
+				"aggregationTemporality": 2,
+				"dataPoints":             latencyPoints,
+			},
+		},
+	}
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": exp.resource(),
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   telemetryScope,
+				"metrics": metrics,
+			}},
+		}},
+	}
+}
+
+// Export sends everything recorded so far to the collector.  It
+// doesn't go through httpClient, so that the headers (which usually
+// have a secret in them) are never written to a --record-bundle.
+func (exp *otlpExporter) Export(ctx context.Context, s *runStats) error {
+	for _, signal := range []struct {
+		path string
+		body interface{}
+	}{
+		{"/v1/traces", exp.tracesRequest()},
+		{"/v1/metrics", exp.metricsRequest(s)},
+	} {
+		reqbody, err := json.Marshal(signal.body)
+		if err != nil {
+			return err
+		}
+		httpreq, err := http.NewRequestWithContext(ctx, http.MethodPost, exp.endpoint+signal.path, bytes.NewReader(reqbody))
+		if err != nil {
+			return err
+		}
+		httpreq.Header.Add("Content-Type", "application/json")
+		for key, val := range exp.headers {
+			httpreq.Header.Set(key, val)
+		}
+		client := &http.Client{Timeout: httpClient.Timeout}
+		httpresp, err := client.Do(httpreq)
+		if err != nil {
+			return err
+		}
+		respbody, _ := ioutil.ReadAll(httpresp.Body)
+		httpresp.Body.Close()
+		if httpresp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: HTTP %s: %s", signal.path, httpresp.Status, bytes.TrimSpace(respbody))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// githubToken is the token that every API request is sent with; it is
+// set by resolveToken.
+var githubToken string
+
+// resolveToken sets githubApp if --app-id is given, and otherwise sets
+// githubToken from the first of these that is set:
+// --token, --token-file, the environment variable named by the
+// profile's token_env (profileTokenEnv), GH_TOKEN, and GITHUB_TOKEN.
+// GH_TOKEN comes before GITHUB_TOKEN, as it does for the gh CLI, so
+// that a token set for this program wins over the one that CI sets for
+// every job.  If none of them is set, requireToken falls back to gh's
+// token.
+func resolveToken(profileTokenEnv string) error {
+	switch {
+	case flagAppID == "" && flagAppKeyFile == "" && flagAppInstallationID == 0:
+	case flagAppID == "" || flagAppKeyFile == "":
+		return fmt.Errorf("--app-id and --app-private-key-file must be given together")
+	case flagToken != "" || flagTokenFile != "":
+		return fmt.Errorf("--app-id can't be used with --token or --token-file")
+	default:
+		app, err := newAppAuth(flagAppID, flagAppKeyFile, flagAppInstallationID)
+		if err != nil {
+			return err
+		}
+		githubApp = app
+		return nil
+	}
+	switch {
+	case flagToken != "":
+		githubToken = flagToken
+	case flagTokenFile != "":
+		content, err := os.ReadFile(flagTokenFile)
+		if err != nil {
+			return fmt.Errorf("--token-file: %w", err)
+		}
+		githubToken = strings.TrimSpace(string(content))
+		if githubToken == "" {
+			return fmt.Errorf("--token-file: %s is empty", flagTokenFile)
+		}
+	case profileTokenEnv != "":
+		githubToken = os.Getenv(profileTokenEnv)
+		if githubToken == "" {
+			return fmt.Errorf("--profile: the profile's token_env, %s, isn't set", profileTokenEnv)
+		}
+	case os.Getenv("GH_TOKEN") != "":
+		githubToken = os.Getenv("GH_TOKEN")
+	default:
+		githubToken = os.Getenv("GITHUB_TOKEN")
+	}
+	return nil
+}
+
+// ghToken returns the token that the gh CLI is logged in to host (""
+// for github.com) with, or "" if it isn't logged in or isn't
+// installed.  It asks "gh auth token", which knows about tokens in the
+// system keyring, and if gh isn't installed, reads gh's hosts.yml.
+func ghToken(host string) string {
+	if host == "" {
+		host = "github.com"
+	}
+	if _, err := exec.LookPath("gh"); err == nil {
+		var stdout bytes.Buffer
+		cmd := exec.Command("gh", "auth", "token", "--hostname", host)
+		cmd.Stdout = &stdout
+		if cmd.Run() == nil {
+			return strings.TrimSpace(stdout.String())
+		}
+		return ""
+	}
+	content, err := os.ReadFile(filepath.Join(ghConfigDir(), "hosts.yml"))
+	if err != nil {
+		return ""
+	}
+	var hosts map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(content, &hosts); err != nil {
+		return ""
+	}
+	return hosts[host].OAuthToken
+}
+
+// ghConfigDir returns the directory that the gh CLI keeps its
+// configuration in, worked out the same way that gh does.
+func ghConfigDir() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh")
+	}
+	if dir := os.Getenv("AppData"); runtime.GOOS == "windows" && dir != "" {
+		return filepath.Join(dir, "GitHub CLI")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gh")
+}
+
+// neededScopes are the OAuth scopes that a classic personal access
+// token needs, each with the broader scopes that include it.
+var neededScopes = []struct {
+	Scope     string
+	ImpliedBy []string
+}{
+	{"repo", nil},
+	{"read:org", []string{"write:org", "admin:org"}},
+}
+
+// tokenChecked is set once checkToken has passed.
+var tokenChecked bool
+
+// checkToken makes sure that githubToken is valid and, if it is a
+// classic personal access token (the only kind that says what its
+// scopes are, in X-OAuth-Scopes), that it has neededScopes.  Otherwise
+// a bad token only shows up as a confusing error from the first query
+// that it can't make.  It asks for the rate limit, which is free.
+func checkToken(ctx context.Context) error {
+	if tokenChecked {
+		return nil
+	}
+	httpreq, err := http.NewRequestWithContext(ctx, http.MethodGet, restURL+"/rate_limit", nil)
+	if err != nil {
+		return err
+	}
+	httpreq.Header.Add("Authorization", "bearer "+githubToken)
+	httpreq.Header.Add("Accept", "application/vnd.github+json")
+	httpresp, err := httpClient.Do(httpreq)
+	if err != nil {
+		return fmt.Errorf("checking the token: %w", err)
+	}
+	httpresp.Body.Close()
+	if httpresp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("the GitHub token isn't valid (HTTP %s); it may have expired or been revoked", httpresp.Status)
+	}
+	// Any other error (GitHub Enterprise Server answers 404 if rate
+	// limiting is turned off) is left for the queries to run in to.
+	if values, ok := httpresp.Header["X-Oauth-Scopes"]; ok {
+		has := make(map[string]bool)
+		var scopes []string
+		for _, value := range values {
+			for _, scope := range strings.Split(value, ",") {
+				if scope = strings.TrimSpace(scope); scope != "" {
+					has[scope] = true
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+		for _, needed := range neededScopes {
+			ok := has[needed.Scope]
+			for _, scope := range needed.ImpliedBy {
+				ok = ok || has[scope]
+			}
+			if !ok {
+				host := apiHostname()
+				if host == "" {
+					host = "github.com"
+				}
+				if len(scopes) == 0 {
+					scopes = []string{"none"}
+				}
+				return fmt.Errorf("the GitHub token doesn't have the '%s' scope, which it needs (its scopes are: %s); add it at https://%s/settings/tokens",
+					needed.Scope, strings.Join(scopes, ", "), host)
+			}
+		}
+	}
+	tokenChecked = true
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// userDetails is what is known about who a user works for, for telling
+// an org's employees from its contractors.
+type userDetails struct {
+	// Company is the company on the user's profile, which they can
+	// set to anything they like.
+	Company string
+	// VerifiedEmails are the user's email addresses in the org's
+	// verified domains.  GitHub only shows them to the org's owners,
+	// and only has them for its members, so an outside collaborator
+	// never has any.
+	VerifiedEmails []string
+}
+
+// userDetailsBatch is how many users getUserDetails asks about in a
+// query.
+const userDetailsBatch = 50
+
+// getUserDetails returns the userDetails of each of logins, in orgname.
+func getUserDetails(ctx context.Context, orgname string, logins []string) (map[string]userDetails, error) {
+	ret := make(map[string]userDetails, len(logins))
+	for start := 0; start < len(logins); start += userDetailsBatch {
+		if ctx.Err() != nil {
+			return ret, errInterrupted
+		}
+		end := start + userDetailsBatch
+		if end > len(logins) {
+			end = len(logins)
+		}
+		fmt.Fprintf(os.Stderr, "getting user details %d/%d\n", start, len(logins))
+		// There is no way to ask for a list of users by login, so
+		// each is an aliased field of its own.
+		var params, fields strings.Builder
+		arguments := map[string]interface{}{"orgname": orgname}
+		for i, login := range logins[start:end] {
+			fmt.Fprintf(&params, ", $login%d: String!", i)
+			fmt.Fprintf(&fields, `
+  user%d: user(login: $login%d) {
+    login
+    company
+    organizationVerifiedDomainEmails(login: $orgname)
+  }`, i, i)
+			arguments[fmt.Sprintf("login%d", i)] = login
+		}
+		query := fmt.Sprintf("\nquery getUserDetails($orgname: String!%s) {%s\n}", params.String(), fields.String())
+		var raw map[string]*struct {
+			Login                            string
+			Company                          string
+			OrganizationVerifiedDomainEmails []string
+		}
+		if err := graphql(ctx, &raw, query, arguments); err != nil {
+			if ctx.Err() != nil {
+				return ret, errInterrupted
+			}
+			return nil, fmt.Errorf("getUserDetails: %w", err)
+		}
+		for _, user := range raw {
+			// The response also has the rate limit info that
+			// graphql asks for.
+			if user == nil || user.Login == "" {
+				continue
+			}
+			ret[user.Login] = userDetails{
+				Company:        strings.TrimSpace(user.Company),
+				VerifiedEmails: user.OrganizationVerifiedDomainEmails,
+			}
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// userRepoAccess is the access that one user has to one repo, and all
+// of the grants that it comes from.
+type userRepoAccess struct {
+	Login string
+	Repo  RepoHandle
+	// Permission is the highest permission of any of Sources.
+	Permission Permission
+	Sources    map[Principal]Permission
+	// Approximate is set if Permission is only the least that the
+	// user has; see repoUser.
+	Approximate bool
+}
+
+// pivotByUser inverts results, to say what each user has access to
+// rather than who has access to each repo.  A team's grant is given to
+// its members and to the members of its child teams, and the org's
+// grant to the org's members.  Only grants that fall in at least one of
+// grouping's buckets are included.  The result is sorted by login,
+// and then by repo name.
+func pivotByUser(results []RepoReport, grouping Grouping, teams teamMembership, members map[string]bool) []*userRepoAccess {
+	teamUsers := teams.Users()
+
+	var ret []*userRepoAccess
+	for _, result := range results {
+		byLogin := make(map[string]*userRepoAccess)
+		grant := func(login string, principal Principal, perm Permission) {
+			access := byLogin[login]
+			if access == nil {
+				access = &userRepoAccess{Login: login, Repo: result.Repo, Sources: make(map[Principal]Permission)}
+				byLogin[login] = access
+				ret = append(ret, access)
+			}
+			access.Sources[principal] = perm
+			if perm > access.Permission {
+				access.Permission = perm
+			}
+		}
+		for principal, perm := range result.Collaborators {
+			if !grouping.Matches(principal) {
+				continue
+			}
+			switch principal.Kind {
+			case KindUser:
+				grant(principal.Name, principal, perm)
+			case KindTeam:
+				for login := range teamUsers[teamSlug(principal.Name)] {
+					grant(login, principal, perm)
+				}
+			case KindOrg:
+				for login := range members {
+					grant(login, principal, perm)
+				}
+			}
+		}
+	}
+	sortUserAccesses(ret)
+	return ret
+}
+
+// sortUserAccesses sorts accesses by login, and then by repo name.
+func sortUserAccesses(accesses []*userRepoAccess) {
+	sort.Slice(accesses, func(i, j int) bool {
+		if accesses[i].Login != accesses[j].Login {
+			return accesses[i].Login < accesses[j].Login
+		}
+		return accesses[i].Repo.Name < accesses[j].Repo.Name
+	})
+}
+
+// effectiveAccess returns each user's effective permission on each
+// repo in results, as GitHub works it out, from the results' Users
+// (so collect has to have been asked for them).  That counts the org's
+// base permission, and the org's owners' ADMIN, as grants from the
+// org, and every member of a team, however many there are.  Only
+// sources that fall in at least one of grouping's buckets are
+// included; a user who has access through others as well gets the
+// permission that repoUser.withSources gives them with only those.
+// The result is sorted by login, and then by repo name.
+func effectiveAccess(results []RepoReport, grouping Grouping) []*userRepoAccess {
+	var ret []*userRepoAccess
+	for _, result := range results {
+		for _, user := range result.Users {
+			var matching []permissionSource
+			for _, source := range user.Sources {
+				if grouping.Matches(source.Principal) {
+					matching = append(matching, source)
+				}
+			}
+			if len(matching) == 0 {
+				continue
+			}
+			user = user.withSources(matching)
+			access := &userRepoAccess{Login: user.Login, Repo: result.Repo, Permission: user.Permission, Sources: make(map[Principal]Permission), Approximate: user.Approximate}
+			for _, source := range user.Sources {
+				if source.Permission > access.Sources[source.Principal] {
+					access.Sources[source.Principal] = source.Permission
+				}
+			}
+			ret = append(ret, access)
+		}
+	}
+	sortUserAccesses(ret)
+	return ret
+}
+
+// expandTeams returns a copy of results with each grant to a team
+// replaced by grants to the users who get it: the team's members, and
+// those of its child teams.  A user who ends up with more than one
+// grant to a repo keeps the highest.  Grants to the org are left as
+// they are.
+func expandTeams(results []RepoReport, teams teamMembership) []RepoReport {
+	teamUsers := teams.Users()
+
+	ret := make([]RepoReport, len(results))
+	for i, result := range results {
+		collaborators := make(map[Principal]Permission, len(result.Collaborators))
+		// A direct grant's principal has a NodeID, and one made
+		// up for a team member doesn't, so look users up by login.
+		byLogin := make(map[string]Principal)
+		grant := func(principal Principal, perm Permission) {
+			if principal.Kind == KindUser {
+				if prev, ok := byLogin[principal.Name]; ok {
+					principal = prev
+				} else {
+					byLogin[principal.Name] = principal
+				}
+			}
+			if perm > collaborators[principal] {
+				collaborators[principal] = perm
+			}
+		}
+		for principal, perm := range result.Collaborators {
+			if principal.Kind == KindUser {
+				grant(principal, perm)
+			}
+		}
+		for principal, perm := range result.Collaborators {
+			switch principal.Kind {
+			case KindTeam:
+				for login := range teamUsers[teamSlug(principal.Name)] {
+					grant(Principal{Kind: KindUser, Name: login}, perm)
+				}
+			case KindOrg:
+				grant(principal, perm)
+			}
+		}
+		result.Collaborators = collaborators
+		ret[i] = result
+	}
+	return ret
+}
+
+// formatSources returns the grants that access comes from, as a
+// space-separated list of "kind:name=PERMISSION".
+func formatSources(access *userRepoAccess, uiNames bool) string {
+	var items []string
+	for _, principal := range sortedPrincipals(access.Sources) {
+		items = append(items, fmt.Sprintf("%s=%s", principal, permissionName(access.Sources[principal], uiNames)))
+	}
+	return strings.Join(items, " ")
+}
+
+// writeUserTable writes the per-user report as a table, with each
+// login's repos under it, naming permissions as GitHub's web UI does
+// if uiNames.
+func writeUserTable(w io.Writer, accesses []*userRepoAccess, uiNames bool) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "User\t| Repository URL\t| Permission\t| Sources\n")
+	fmt.Fprintf(output, "----\t| --------------\t| ----------\t| -------\n")
+	prev := ""
+	for _, access := range accesses {
+		login := access.Login
+		if login == prev {
+			login = ""
+		}
+		prev = access.Login
+		fmt.Fprintf(output, "%s\t| %s\t| %s\t| %s\n", login, repoLabel(access.Repo),
+			permissionName(access.Permission, uiNames), formatSources(access, uiNames))
+	}
+	output.Flush()
+}
+
+// writeUserCSV writes the per-user report as CSV, with one row per
+// user, repo, and source, so that it can be filtered down to one
+// person in a spreadsheet.
+func writeUserCSV(w io.Writer, accesses []*userRepoAccess) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"login", "repository", "url", "permission", "source_kind", "source", "source_permission"})
+	for _, access := range accesses {
+		for _, principal := range sortedPrincipals(access.Sources) {
+			_ = output.Write([]string{
+				access.Login,
+				access.Repo.Name,
+				access.Repo.URL,
+				access.Permission.String(),
+				string(principal.Kind),
+				principal.Name,
+				access.Sources[principal].String(),
+			})
+		}
+	}
+	output.Flush()
+	return output.Error()
+}
+
+// writeEffectiveTable writes each user's effective permission on each
+// repo, without the grants that it comes from, as a table with each
+// login's repos under it.
+func writeEffectiveTable(w io.Writer, accesses []*userRepoAccess, uiNames bool) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "User\t| Repository URL\t| Permission\n")
+	fmt.Fprintf(output, "----\t| --------------\t| ----------\n")
+	prev := ""
+	for _, access := range accesses {
+		login := access.Login
+		if login == prev {
+			login = ""
+		}
+		prev = access.Login
+		perm := permissionName(access.Permission, uiNames)
+		if access.Approximate {
+			perm = "at least " + perm
+		}
+		fmt.Fprintf(output, "%s\t| %s\t| %s\n", login, repoLabel(access.Repo), perm)
+	}
+	output.Flush()
+}
+
+// writeEffectiveCSV writes each user's effective permission on each
+// repo as CSV, with one row per user and repo.
+func writeEffectiveCSV(w io.Writer, accesses []*userRepoAccess) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"login", "repository", "url", "permission", "is_minimum"})
+	for _, access := range accesses {
+		_ = output.Write([]string{access.Login, access.Repo.Name, access.Repo.URL, access.Permission.String(), strconv.FormatBool(access.Approximate)})
+	}
+	output.Flush()
+	return output.Error()
+}
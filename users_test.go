@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEffectiveAccess(t *testing.T) {
+	org := Principal{Kind: KindOrg, Name: "acme", NodeID: "O_acme"}
+	eng := Principal{Kind: KindTeam, Name: "eng", NodeID: "T_eng"}
+	results := []RepoReport{{
+		Repo: RepoHandle{Name: "api"},
+		Users: []repoUser{
+			// MAINTAIN, though no source says so.
+			{Login: "carol", Permission: PermMAINTAIN, Sources: []permissionSource{{org, PermREAD}, {eng, PermWRITE}}},
+		},
+	}}
+	testcases := map[string]struct {
+		sources         []string
+		wantPermission  Permission
+		wantApproximate bool
+	}{
+		"every source":                 {[]string{"org", "team", "user"}, PermMAINTAIN, false},
+		"without a lesser source":      {[]string{"team", "user"}, PermMAINTAIN, false},
+		"without the highest source":   {[]string{"org", "user"}, PermREAD, true},
+		"without any of their sources": {[]string{"user"}, PermNONE, false},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var grouping Grouping
+			for _, name := range tc.sources {
+				grouping.Buckets = append(grouping.Buckets, lookupBucket(name))
+			}
+			accesses := effectiveAccess(results, grouping)
+			if tc.wantPermission == PermNONE {
+				if len(accesses) != 0 {
+					t.Errorf("got %+v, want nothing", accesses[0])
+				}
+				return
+			}
+			if len(accesses) != 1 {
+				t.Fatalf("got %d accesses, want 1", len(accesses))
+			}
+			if got := accesses[0]; got.Permission != tc.wantPermission || got.Approximate != tc.wantApproximate {
+				t.Errorf("got %s (approximate: %v), want %s (approximate: %v)", got.Permission, got.Approximate, tc.wantPermission, tc.wantApproximate)
+			}
+		})
+	}
+}
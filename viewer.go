@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// viewerRole is the role in an org of the user that the token belongs
+// to.  What the API shows depends on it: a plain member can't see
+// secret teams, or repos that they haven't been given access to, and
+// isn't shown the collaborators of repos that they can't administer.
+type viewerRole struct {
+	Login  string
+	Member bool
+	Owner  bool
+	// App is set if the token is a GitHub App installation's rather
+	// than a user's, in which case Login is the app's bot user, and
+	// Owner is set if the installation can see everything that an
+	// owner would.  If it can't, AppLimits says what it is missing.
+	App       bool
+	AppLimits []string
+}
+
+// String returns "owner", "member", or "non-member", or for an app,
+// "app" or (if it can't see everything) "limited-app".
+func (r viewerRole) String() string {
+	switch {
+	case r.App && r.Owner:
+		return "app"
+	case r.App:
+		return "limited-app"
+	case r.Owner:
+		return "owner"
+	case r.Member:
+		return "member"
+	default:
+		return "non-member"
+	}
+}
+
+// Caveat returns why a report made with r's token may be incomplete,
+// or "" if r is an owner.
+func (r viewerRole) Caveat(orgname string) string {
+	switch {
+	case r.Owner:
+		return ""
+	case r.App:
+		return fmt.Sprintf("the token is for %s, whose installation in %q %s, so some repositories, teams, and collaborators may be missing",
+			r.Login, orgname, strings.Join(r.AppLimits, " and "))
+	}
+	return fmt.Sprintf("the token belongs to %s, who is a %s of %q rather than an owner, so secret teams, some repositories, and some collaborators may be missing",
+		r.Login, r, orgname)
+}
+
+// getViewerRole returns the token user's role in an org, and warns on
+// stderr if it isn't an owner.  With --app-id, there is no user, so it
+// returns what the app's installation can see instead.
+func getViewerRole(ctx context.Context, orgname string) (viewerRole, error) {
+	if githubApp != nil {
+		role, err := getAppRole(ctx, orgname)
+		if err != nil {
+			return viewerRole{}, fmt.Errorf("getViewerRole: %w", err)
+		}
+		if caveat := role.Caveat(orgname); caveat != "" {
+			fmt.Fprintf(os.Stderr, "WARNING: %s\n", caveat)
+		}
+		return role, nil
+	}
+	var resp struct {
+		Viewer struct {
+			Login string
+		}
+		Organization struct {
+			ViewerIsAMember     bool
+			ViewerCanAdminister bool
+		}
+	}
+	err := graphql(ctx, &resp, `
+query getViewerRole($orgname: String!) {
+  viewer {
+    login
+  }
+  organization(login: $orgname) {
+    viewerIsAMember
+    viewerCanAdminister
+  }
+}`, map[string]interface{}{
+		"orgname": orgname,
+	})
+	if err != nil {
+		return viewerRole{}, fmt.Errorf("getViewerRole: %w", err)
+	}
+	role := viewerRole{
+		Login:  resp.Viewer.Login,
+		Member: resp.Organization.ViewerIsAMember,
+		Owner:  resp.Organization.ViewerCanAdminister,
+	}
+	if caveat := role.Caveat(orgname); caveat != "" {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", caveat)
+	}
+	return role, nil
+}
+
+// getAppRole returns the role of githubApp's installation in an org:
+// like an owner's if it is installed on all of the org's repositories
+// and can read its members and the repositories' administration (for
+// their collaborators), which is what the report needs.  The viewer
+// query doesn't work with an installation token, so it asks the app's
+// REST API.
+func getAppRole(ctx context.Context, orgname string) (viewerRole, error) {
+	installation, err := githubApp.Installation(ctx)
+	if err != nil {
+		return viewerRole{}, err
+	}
+	if !strings.EqualFold(installation.Account.Login, orgname) {
+		return viewerRole{}, fmt.Errorf("GitHub App %s's installation %d is in %q, not %q",
+			githubApp.id, installation.ID, installation.Account.Login, orgname)
+	}
+	role := viewerRole{
+		Login:  installation.AppSlug + "[bot]",
+		Member: true,
+		App:    true,
+	}
+	if installation.RepositorySelection != "all" {
+		role.AppLimits = append(role.AppLimits, "is only on selected repositories")
+	}
+	for _, perm := range []string{"members", "administration"} {
+		if installation.Permissions[perm] == "" {
+			role.AppLimits = append(role.AppLimits, fmt.Sprintf("can't read %s", perm))
+		}
+	}
+	role.Owner = len(role.AppLimits) == 0
+	return role, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// formatRepoUserSources returns the grants that user's access comes
+// from, highest first, as a space-separated list of
+// "kind:name=PERMISSION".
+func formatRepoUserSources(user repoUser) string {
+	sources := append([]permissionSource(nil), user.Sources...)
+	sort.SliceStable(sources, func(i, j int) bool {
+		if sources[i].Permission != sources[j].Permission {
+			return sources[i].Permission > sources[j].Permission
+		}
+		return sources[i].Principal.String() < sources[j].Principal.String()
+	})
+	items := make([]string, len(sources))
+	for i, source := range sources {
+		items[i] = fmt.Sprintf("%s=%s", source.Principal, source.Permission)
+	}
+	return strings.Join(items, " ")
+}
+
+func writeRepoUsersTable(w io.Writer, users []repoUser) {
+	output := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(output, "User\t| Permission\t| Through\n")
+	fmt.Fprintf(output, "----\t| ----------\t| -------\n")
+	for _, user := range users {
+		fmt.Fprintf(output, "%s\t| %s\t| %s\n", user.Login, user.Permission, formatRepoUserSources(user))
+	}
+	output.Flush()
+}
+
+func writeRepoUsersCSV(w io.Writer, users []repoUser) error {
+	output := csv.NewWriter(w)
+	_ = output.Write([]string{"login", "permission", "through"})
+	for _, user := range users {
+		_ = output.Write([]string{user.Login, user.Permission.String(), formatRepoUserSources(user)})
+	}
+	output.Flush()
+	return output.Error()
+}
+
+var whoHasCommand = &command{
+	Name:    "who-has",
+	Args:    []string{"ORGNAME/REPO"},
+	Summary: "List everyone with access to a single repository",
+	Description: `
+Lists every user who has at least --min-permission on one repository,
+highest permission first, with the grants that their access comes
+through: teams are expanded in to their members (including the members
+of child teams), and the organization's base permission in to its
+members.  It answers "who can push to this repository?" without
+inspecting the whole organization.
+
+It takes a query per 100 teams, and a query per 100 of the
+repository's collaborators.`,
+	Examples: []example{
+		{"List who can push to datawire/telepresence.", progName + " who-has --min-permission=WRITE datawire/telepresence"},
+	},
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		minPermission := fs.String("min-permission", "READ", "only list users with at least this `permission` (READ, TRIAGE, WRITE, MAINTAIN, or ADMIN)")
+		format := fs.String("format", "table", "output format: 'table' or 'csv'")
+		return func(ctx context.Context, args []string) error {
+			orgname, reponame, ok := strings.Cut(args[0], "/")
+			if !ok || orgname == "" || reponame == "" || strings.Contains(reponame, "/") {
+				return usageErrorf("who-has: invalid repository %q (must be 'ORGNAME/REPO')", args[0])
+			}
+			var min Permission
+			if err := min.UnmarshalText([]byte(strings.ToUpper(*minPermission))); err != nil || min == PermNONE {
+				return usageErrorf("who-has: invalid --min-permission %q (must be READ, TRIAGE, WRITE, MAINTAIN, or ADMIN)", *minPermission)
+			}
+			if *format != "table" && *format != "csv" {
+				return usageErrorf("who-has: invalid --format %q (must be 'table' or 'csv')", *format)
+			}
+			if err := requireToken(ctx); err != nil {
+				return err
+			}
+			teamFullnames, err := getTeamFullnames(ctx, orgname)
+			if err != nil {
+				return err
+			}
+			all, count, err := getRepoUsers(ctx, teamFullnames, orgname, reponame)
+			if err != nil {
+				return err
+			}
+			var users []repoUser
+			for _, user := range all {
+				if user.Permission >= min {
+					users = append(users, user)
+				}
+			}
+			sort.SliceStable(users, func(i, j int) bool {
+				if users[i].Permission != users[j].Permission {
+					return users[i].Permission > users[j].Permission
+				}
+				return strings.ToLower(users[i].Login) < strings.ToLower(users[j].Login)
+			})
+
+			if *format == "csv" {
+				if err := writeRepoUsersCSV(os.Stdout, users); err != nil {
+					return err
+				}
+			} else {
+				writeRepoUsersTable(os.Stdout, users)
+			}
+			fmt.Fprintf(os.Stderr, "%d of the %d users with access to %s/%s have at least %s\n", len(users), len(all), orgname, reponame, min)
+			if count.Total != count.Returned {
+				fmt.Fprintf(os.Stderr, "warning: %s/%s: GitHub says there are %d collaborators, but returned %d; the list may be missing some\n",
+					orgname, reponame, count.Total, count.Returned)
+			}
+			return nil
+		}
+	},
+}